@@ -1,6 +1,7 @@
 package schema
 
 import (
+	"database/sql"
 	"log"
 	"strings"
 
@@ -30,7 +31,7 @@ func CreateSchema() error {
 			custom_interval INT DEFAULT NULL,
 
 			last_checked TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			status ENUM('online', 'offline', 'error') DEFAULT 'online',
+			status ENUM('online', 'offline', 'error', 'warning') DEFAULT 'online',
 			response_time INT DEFAULT 0,
 			
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
@@ -44,7 +45,7 @@ func CreateSchema() error {
 		CREATE TABLE IF NOT EXISTS logs(
 			id INT AUTO_INCREMENT PRIMARY KEY,
 			url_id INT NOT NULL,
-			status ENUM('online', 'offline', 'error') NOT NULL,
+			status ENUM('online', 'offline', 'error', 'warning') NOT NULL,
 			response_time INT DEFAULT 0,
 			response_code INT DEFAULT 0,
 			error_message TEXT,
@@ -69,7 +70,261 @@ func CreateSchema() error {
 			INDEX idx_user_active (user_id, is_active)
 		);
 	`
-	schemas := []string{userSchema, urlSchema, logsSchema, authSchema}
+	webhookSchema := `
+		CREATE TABLE IF NOT EXISTS webhooks(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			url VARCHAR(500) NOT NULL,
+			description VARCHAR(255) NULL,
+			secret VARCHAR(255) NOT NULL,
+			is_active BOOLEAN DEFAULT TRUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			INDEX idx_user_active (user_id, is_active)
+		);`
+
+	webhookDeliverySchema := `
+		CREATE TABLE IF NOT EXISTS webhook_deliveries(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			webhook_id INT NOT NULL,
+			delivery_id VARCHAR(64) NOT NULL,
+			event VARCHAR(30) NOT NULL,
+			payload TEXT,
+			attempt INT NOT NULL DEFAULT 1,
+			status_code INT NULL,
+			response_body TEXT,
+			error_message TEXT,
+			duration INT DEFAULT 0,
+			success BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE,
+			INDEX idx_webhook_created (webhook_id, created_at)
+		);`
+	channelSchema := `
+		CREATE TABLE IF NOT EXISTS notification_channels(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			type ENUM('slack','discord','teams','telegram') NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			url VARCHAR(500) NULL,
+			token VARCHAR(255) NULL,
+			chat_id VARCHAR(100) NULL,
+			is_active BOOLEAN DEFAULT TRUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			INDEX idx_user_active (user_id, is_active)
+		);`
+	incidentSchema := `
+		CREATE TABLE IF NOT EXISTS incidents(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			url_id INT NOT NULL,
+			user_id INT NOT NULL,
+			status ENUM('open','acknowledged','resolved') NOT NULL DEFAULT 'open',
+			first_status ENUM('online', 'offline', 'error', 'warning') NOT NULL,
+			cause TEXT,
+			started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			acknowledged_at TIMESTAMP NULL,
+			acknowledged_by INT NULL,
+			resolved_at TIMESTAMP NULL,
+			last_alert_at TIMESTAMP NULL,
+			FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (acknowledged_by) REFERENCES users(id) ON DELETE SET NULL,
+			INDEX idx_url_status (url_id, status),
+			INDEX idx_user_started (user_id, started_at)
+		);`
+
+	incidentEventSchema := `
+		CREATE TABLE IF NOT EXISTS incident_events(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			incident_id INT NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			status VARCHAR(20) NULL,
+			message TEXT,
+			user_id INT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (incident_id) REFERENCES incidents(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+			INDEX idx_incident_created (incident_id, created_at)
+		);`
+
+	statusPageSchema := `
+		CREATE TABLE IF NOT EXISTS status_pages(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			slug VARCHAR(50) NOT NULL UNIQUE,
+			title VARCHAR(100) NOT NULL,
+			description TEXT,
+			logo_url VARCHAR(500) NULL,
+			custom_domain VARCHAR(253) NULL UNIQUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			INDEX idx_user (user_id)
+		);`
+
+	statusPageMonitorSchema := `
+		CREATE TABLE IF NOT EXISTS status_page_monitors(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			page_id INT NOT NULL,
+			url_id INT NOT NULL,
+			component VARCHAR(100) NOT NULL,
+			display_name VARCHAR(100) NULL,
+			position INT NOT NULL DEFAULT 0,
+			FOREIGN KEY (page_id) REFERENCES status_pages(id) ON DELETE CASCADE,
+			FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE,
+			INDEX idx_page_position (page_id, position)
+		);`
+
+	maintenanceSchema := `
+		CREATE TABLE IF NOT EXISTS status_page_maintenance(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			page_id INT NOT NULL,
+			title VARCHAR(200) NOT NULL,
+			description TEXT,
+			starts_at DATETIME NOT NULL,
+			ends_at DATETIME NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (page_id) REFERENCES status_pages(id) ON DELETE CASCADE,
+			INDEX idx_page_ends (page_id, ends_at)
+		);`
+
+	// Aggregates of logs, filled in by the compaction job; latency columns
+	// cover successful checks only.
+	rollupTable := func(name string) string {
+		return `
+		CREATE TABLE IF NOT EXISTS ` + name + `(
+			url_id INT NOT NULL,
+			bucket_start DATETIME NOT NULL,
+			checks INT NOT NULL DEFAULT 0,
+			failures INT NOT NULL DEFAULT 0,
+			samples INT NOT NULL DEFAULT 0,
+			min_time INT NOT NULL DEFAULT 0,
+			avg_time INT NOT NULL DEFAULT 0,
+			p50_time INT NOT NULL DEFAULT 0,
+			p90_time INT NOT NULL DEFAULT 0,
+			p95_time INT NOT NULL DEFAULT 0,
+			p99_time INT NOT NULL DEFAULT 0,
+			max_time INT NOT NULL DEFAULT 0,
+			PRIMARY KEY (url_id, bucket_start),
+			FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE,
+			INDEX idx_bucket_start (bucket_start)
+		);`
+	}
+
+	// Only an HMAC of each token is stored, see utils.HashToken.
+	verificationSchema := `
+		CREATE TABLE IF NOT EXISTS email_verifications(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			token_hash CHAR(64) NOT NULL UNIQUE,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			INDEX idx_user_created (user_id, created_at)
+		);`
+
+	passwordResetSchema := `
+		CREATE TABLE IF NOT EXISTS password_resets(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			token_hash CHAR(64) NOT NULL UNIQUE,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			INDEX idx_user_created (user_id, created_at)
+		);`
+
+	recoveryCodeSchema := `
+		CREATE TABLE IF NOT EXISTS recovery_codes(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			code_hash CHAR(64) NOT NULL,
+			used_at TIMESTAMP NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			UNIQUE KEY idx_user_code (user_id, code_hash)
+		);`
+
+	// Issued by the password step of a two-factor login.
+	loginChallengeSchema := `
+		CREATE TABLE IF NOT EXISTS login_challenges(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			token_hash CHAR(64) NOT NULL UNIQUE,
+			attempts INT NOT NULL DEFAULT 0,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`
+
+	apiKeySchema := `
+		CREATE TABLE IF NOT EXISTS api_keys(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			prefix VARCHAR(16) NOT NULL,
+			key_hash CHAR(64) NOT NULL UNIQUE,
+			scopes VARCHAR(255) NOT NULL,
+			allowed_ips TEXT DEFAULT NULL,
+			expires_at TIMESTAMP NULL DEFAULT NULL,
+			last_used_at TIMESTAMP NULL DEFAULT NULL,
+			last_used_ip VARCHAR(45) DEFAULT NULL,
+			revoked_at TIMESTAMP NULL DEFAULT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`
+
+	organizationSchema := `
+		CREATE TABLE IF NOT EXISTS organizations(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			created_by INT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+		);`
+
+	organizationMemberSchema := `
+		CREATE TABLE IF NOT EXISTS organization_members(
+			organization_id INT NOT NULL,
+			user_id INT NOT NULL,
+			role ENUM('owner', 'admin', 'editor', 'viewer') NOT NULL DEFAULT 'viewer',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (organization_id, user_id),
+			INDEX idx_member_user (user_id),
+			FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`
+
+	invitationSchema := `
+		CREATE TABLE IF NOT EXISTS organization_invitations(
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			organization_id INT NOT NULL,
+			email VARCHAR(255) NOT NULL,
+			role ENUM('owner', 'admin', 'editor', 'viewer') NOT NULL DEFAULT 'viewer',
+			token_hash CHAR(64) NOT NULL UNIQUE,
+			invited_by INT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			accepted_at TIMESTAMP NULL DEFAULT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_invitation_org (organization_id, email),
+			FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+			FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL
+		);`
+
+	rollupStateSchema := `
+		CREATE TABLE IF NOT EXISTS log_rollup_state(
+			level VARCHAR(10) PRIMARY KEY,
+			rolled_until DATETIME NOT NULL
+		);`
+	schemas := []string{userSchema, urlSchema, logsSchema, authSchema, webhookSchema, webhookDeliverySchema, channelSchema,
+		incidentSchema, incidentEventSchema, statusPageSchema, statusPageMonitorSchema, maintenanceSchema,
+		rollupTable("log_rollups_hourly"), rollupTable("log_rollups_daily"), rollupStateSchema, verificationSchema, passwordResetSchema,
+		recoveryCodeSchema, loginChallengeSchema, apiKeySchema, organizationSchema, organizationMemberSchema, invitationSchema}
 
 	for _, schema := range schemas {
 		if _, err := db.DB.Exec((schema)); err != nil {
@@ -81,11 +336,151 @@ func CreateSchema() error {
 	return nil
 }
 
+// verifiedAtMigration is referenced by its backfill as well as the migration list.
+const verifiedAtMigration = `ALTER TABLE users ADD COLUMN verified_at TIMESTAMP NULL DEFAULT NULL`
+
+// Status enum changes, guarded by statusColumnType so they only run once.
+const (
+	urlStatusMigration = `ALTER TABLE urls MODIFY COLUMN status ENUM('online', 'offline', 'error', 'warning') DEFAULT 'online'`
+	logStatusMigration = `ALTER TABLE logs MODIFY COLUMN status ENUM('online', 'offline', 'error', 'warning') NOT NULL`
+	statusColumnType   = `enum('online','offline','error','warning')`
+)
+
+// monitorTypeMigration widens urls.type to every monitor type.
+const (
+	monitorTypeMigration  = `ALTER TABLE urls MODIFY COLUMN type ENUM('http','tcp','dns','heartbeat') NOT NULL DEFAULT 'http'`
+	monitorTypeColumnType = `enum('http','tcp','dns','heartbeat')`
+)
+
+// columnType is the type a MODIFY COLUMN migration leaves behind.
+type columnType struct {
+	table, column, columnType string
+}
+
+// MigrateSchema adds columns introduced after a table was first created.
+// Columns that already exist are skipped, so it is safe to run on every start.
+func MigrateSchema() error {
+	migrations := []string{
+		`ALTER TABLE logs ADD COLUMN dns_time INT DEFAULT NULL`,
+		`ALTER TABLE logs ADD COLUMN connect_time INT DEFAULT NULL`,
+		`ALTER TABLE logs ADD COLUMN tls_time INT DEFAULT NULL`,
+		`ALTER TABLE logs ADD COLUMN ttfb_time INT DEFAULT NULL`,
+		`ALTER TABLE logs ADD COLUMN download_time INT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN content_rules TEXT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN max_body_bytes INT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN json_assertions TEXT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN method VARCHAR(10) DEFAULT 'GET'`,
+		`ALTER TABLE urls ADD COLUMN request_headers TEXT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN request_body TEXT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN accepted_statuses VARCHAR(255) DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN type ENUM('http','tcp') NOT NULL DEFAULT 'http'`,
+		`ALTER TABLE urls ADD COLUMN tcp_payload TEXT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN tcp_expect_banner VARCHAR(255) DEFAULT NULL`,
+		urlStatusMigration,
+		logStatusMigration,
+		`ALTER TABLE urls ADD COLUMN cert_expiry_days INT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN cert_issuer VARCHAR(255) DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN cert_subject VARCHAR(255) DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN cert_sans TEXT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN cert_not_after DATETIME DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN cert_chain_valid BOOLEAN DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN cert_expiring_subject VARCHAR(255) DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN dns_record_type VARCHAR(10) DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN dns_resolver VARCHAR(255) DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN dns_expected TEXT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN dns_answer TEXT DEFAULT NULL`,
+		`ALTER TABLE logs ADD COLUMN dns_answer TEXT DEFAULT NULL`,
+		monitorTypeMigration,
+		`ALTER TABLE urls ADD COLUMN heartbeat_token VARCHAR(64) DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN heartbeat_grace INT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN heartbeat_last_ping TIMESTAMP NULL DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN heartbeat_started_at TIMESTAMP NULL DEFAULT NULL`,
+		// Heartbeat urls used to carry the start of the ping token.
+		`UPDATE urls SET url = CONCAT('heartbeat://', id) WHERE type = 'heartbeat' AND url = CONCAT('heartbeat://', LEFT(heartbeat_token, 12))`,
+		`ALTER TABLE logs ADD COLUMN event VARCHAR(20) DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN retry_count INT NOT NULL DEFAULT 0`,
+		`ALTER TABLE urls ADD COLUMN retry_delay INT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN failure_threshold INT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN consecutive_failures INT NOT NULL DEFAULT 0`,
+		`ALTER TABLE logs ADD COLUMN attempt INT NOT NULL DEFAULT 1`,
+		`ALTER TABLE logs ADD COLUMN confirmed BOOLEAN NOT NULL DEFAULT TRUE`,
+		`ALTER TABLE urls ADD COLUMN down_since TIMESTAMP NULL DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN notification_channels TEXT DEFAULT NULL`,
+		`ALTER TABLE logs ADD COLUMN incident_id INT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN badge_token VARCHAR(64) DEFAULT NULL`,
+		verifiedAtMigration,
+		`ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64) DEFAULT NULL`,
+		`ALTER TABLE users ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE users ADD COLUMN totp_last_step BIGINT DEFAULT NULL`,
+		`ALTER TABLE urls ADD COLUMN organization_id INT DEFAULT NULL`,
+	}
+	// Backfills run once, right after the migration they belong to applies.
+	backfills := map[string]string{
+		// Accounts from before email verification keep receiving alerts.
+		verifiedAtMigration: `UPDATE users SET verified = TRUE, verified_at = created_at`,
+	}
+	// MODIFY COLUMN never fails as a duplicate and rebuilds the table each
+	// time, so these are skipped once the column already has the new type.
+	modifies := map[string]columnType{
+		urlStatusMigration:   {"urls", "status", statusColumnType},
+		logStatusMigration:   {"logs", "status", statusColumnType},
+		monitorTypeMigration: {"urls", "type", monitorTypeColumnType},
+	}
+	for _, migration := range migrations {
+		if want, ok := modifies[migration]; ok {
+			applied, err := hasColumnType(want)
+			if err != nil {
+				log.Printf("Error reading column type: %v", err)
+				return err
+			}
+			if applied {
+				continue
+			}
+		}
+		_, err := db.DB.Exec(migration)
+		if err != nil {
+			if isDuplicateColumnError(err) {
+				continue
+			}
+			log.Printf("Error migrating schema: %v", err)
+			return err
+		}
+		log.Println("Migration applied successfully: ", migration)
+		if backfill, ok := backfills[migration]; ok {
+			if _, err := db.DB.Exec(backfill); err != nil {
+				log.Printf("Error backfilling schema: %v", err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasColumnType reports whether the column already has the wanted type, as
+// information_schema spells it.
+func hasColumnType(want columnType) (bool, error) {
+	var current string
+	err := db.DB.QueryRow(`SELECT COLUMN_TYPE FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`, want.table, want.column).Scan(&current)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(current, want.columnType), nil
+}
+
 func CreateIndex() error {
 	indexes := []string{
 		`CREATE INDEX idx_websites_next_check ON urls(last_checked, ` + "`interval`" + `);`,
 		`CREATE INDEX idx_logs_recent ON logs(checked_at DESC);`,
 		`CREATE INDEX idx_users_email ON users(email);`,
+		`CREATE UNIQUE INDEX idx_urls_heartbeat_token ON urls(heartbeat_token);`,
+		`CREATE INDEX idx_logs_incident ON logs(incident_id);`,
+		`CREATE UNIQUE INDEX idx_urls_badge_token ON urls(badge_token);`,
+		`CREATE INDEX idx_api_keys_user ON api_keys(user_id, revoked_at);`,
+		`CREATE INDEX idx_urls_organization ON urls(organization_id);`,
 	}
 	for _, index := range indexes {
 		_, err := db.DB.Exec(index)
@@ -102,6 +497,14 @@ func CreateIndex() error {
 	return nil
 }
 
+func isDuplicateColumnError(err error) bool {
+	if err == nil {
+		return false
+	}
+	errMsg := err.Error()
+	return strings.Contains(errMsg, "Error 1060") || strings.Contains(errMsg, "Duplicate column name")
+}
+
 func isDuplicateKeyError(err error) bool {
 	if err == nil {
 		return false
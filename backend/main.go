@@ -4,11 +4,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	db "github.com/MrPurushotam/web-visitor/config"
 	schema "github.com/MrPurushotam/web-visitor/libs"
 	"github.com/MrPurushotam/web-visitor/routes"
 	"github.com/MrPurushotam/web-visitor/service"
+	"github.com/MrPurushotam/web-visitor/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -24,6 +26,22 @@ func main() {
 	}
 
 	r := gin.Default()
+	// Only these proxies may set X-Forwarded-For. By default none are trusted,
+	// so ClientIP is the connection's own address and can't be spoofed past
+	// rate limits or API key IP allow-lists.
+	trustedProxies := strings.Fields(strings.ReplaceAll(os.Getenv("TRUSTED_PROXIES"), ",", " "))
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	if err := utils.CheckMailConfig(); err != nil {
+		log.Fatalf("Invalid SMTP settings: %v", err)
+	}
+	// HashToken would otherwise sign emailed tokens with an empty key.
+	if os.Getenv("TOKEN_SECRET") == "" {
+		log.Fatal("TOKEN_SECRET is not set, it signs the tokens sent by email")
+	}
+	// Custom status page domains answer on "/" before the API banner does.
+	r.Use(routes.StatusPageDomain())
 	setupSwaggerRoutes(r)
 
 	log.Println("Connecting to database...")
@@ -37,12 +55,18 @@ func main() {
 		log.Fatalf("Database schema creation failed: %v", err)
 	}
 
+	log.Println("Migrating database schema...")
+	if err := schema.MigrateSchema(); err != nil {
+		log.Fatalf("Database schema migration failed: %v", err)
+	}
+
 	log.Println("Creating database indexes...")
 	if err := schema.CreateIndex(); err != nil {
 		log.Fatalf("Database index creation failed: %v", err)
 	}
 
 	service.InitCornService()
+	service.InitHousekeeping()
 
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "API is running."})
@@ -79,6 +103,21 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"message": "CornJob enabled.", "success": true})
 	})
 
+	r.GET("/stats/:cred", func(c *gin.Context) {
+		cred := c.Param("cred")
+		password := os.Getenv("CORNJOB_PASSWORD")
+		if password == "" {
+			password = "Qwert"
+		}
+
+		if cred != password {
+			log.Printf("Incorrect passowrd can't read CornJob stats.")
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Error reading CornJob stats.", "success": false})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": service.CheckPoolStats(), "success": true})
+	})
+
 	routes.Init(r)
 	port := os.Getenv("PORT")
 	if port == "" {
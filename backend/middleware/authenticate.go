@@ -1,9 +1,10 @@
 package middleware
 
 import (
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/MrPurushotam/web-visitor/utils"
@@ -26,6 +27,16 @@ func AuthMiddleware() gin.HandlerFunc {
 			}
 		}
 
+		if token == "" {
+			token = c.GetHeader("X-API-Key")
+		}
+
+		// API keys are checked against their scopes instead of opening a session.
+		if utils.IsAPIKey(token) {
+			authenticateAPIKey(c, token)
+			return
+		}
+
 		// If no token in header, try cookie
 		if token == "" {
 			cookie, err := c.Cookie("session_token")
@@ -41,10 +52,9 @@ func AuthMiddleware() gin.HandlerFunc {
 			token = cookie
 		}
 
-		userID, err := utils.ValidateSession(token)
-		fmt.Printf("%s, userID=%d, err=%v", token, userID, err)
+		userID, sessionID, err := utils.ValidateSession(token)
 		if err != nil {
-			log.Printf("Invalid token error ", err)
+			log.Printf("Invalid token error: %v", err)
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error":   "Unauthorized",
 				"message": "Invalid or expired session",
@@ -56,6 +66,81 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		// Store user ID in context for use in handlers
 		c.Set("userId", userID)
+		c.Set("sessionId", sessionID)
 		c.Next()
 	}
 }
+
+// apiKeyAreas maps the first path segment after /api/v1 to the area of its
+// scopes. Routes outside these areas, such as account, session and API key
+// management, can't be used with an API key at all.
+var apiKeyAreas = map[string]string{
+	"uri":          "uri",
+	"logs":         "logs",
+	"incidents":    "incidents",
+	"status-pages": "status-pages",
+	"webhooks":     "webhooks",
+	"channels":     "channels",
+}
+
+// requiredScope is the scope a request needs: "<area>:read" for GET and
+// "<area>:write" for everything else.
+func requiredScope(method, route string) (string, bool) {
+	rest, ok := strings.CutPrefix(route, "/api/v1/")
+	if !ok {
+		return "", false
+	}
+	segment, _, _ := strings.Cut(rest, "/")
+	area, ok := apiKeyAreas[segment]
+	if !ok {
+		return "", false
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return area + ":read", true
+	}
+	return area + ":write", true
+}
+
+func authenticateAPIKey(c *gin.Context, token string) {
+	userID, scopes, err := utils.ValidateAPIKey(token, c.ClientIP())
+	if errors.Is(err, utils.ErrAPIKeyForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Forbidden",
+			"message": err.Error(),
+			"success": false,
+		})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		if !errors.Is(err, utils.ErrAPIKeyInvalid) {
+			log.Printf("Error validating API key: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "Invalid, revoked or expired API key",
+			"success": false,
+		})
+		c.Abort()
+		return
+	}
+
+	scope, ok := requiredScope(c.Request.Method, c.FullPath())
+	if !ok || !slices.Contains(scopes, scope) {
+		message := "This endpoint can't be used with an API key"
+		if ok {
+			message = "The API key lacks the " + scope + " scope"
+		}
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Insufficient scope",
+			"message": message,
+			"success": false,
+		})
+		c.Abort()
+		return
+	}
+
+	c.Set("userId", userID)
+	c.Set("apiKeyScopes", scopes)
+	c.Next()
+}
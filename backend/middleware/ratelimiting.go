@@ -1 +1,77 @@
-package middleware
\ No newline at end of file
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTrackedClients caps the counters kept per limiter. Once it's reached
+// expired counters are swept, and if none expired the oldest is evicted.
+const maxTrackedClients = 10000
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// RateLimit allows each client IP at most limit requests per window on the
+// routes it guards and answers 429 beyond that. The IP is the connection's
+// address unless it comes from a proxy listed in TRUSTED_PROXIES, so clients
+// can't pick a fresh one per request. Counters live in memory, so each server
+// process limits on its own.
+func RateLimit(limit int, window time.Duration) gin.HandlerFunc {
+	var (
+		mu      sync.Mutex
+		clients = map[string]*rateWindow{}
+	)
+	return func(c *gin.Context) {
+		now := time.Now()
+		ip := c.ClientIP()
+		mu.Lock()
+		w := clients[ip]
+		if w == nil && len(clients) >= maxTrackedClients {
+			evictClient(clients, now, window)
+		}
+		if w == nil || now.Sub(w.start) >= window {
+			w = &rateWindow{start: now}
+			clients[ip] = w
+		}
+		w.count++
+		count, reset := w.count, w.start.Add(window)
+		mu.Unlock()
+
+		if count > limit {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":   "Too many requests",
+				"message": "Too many attempts, try again later",
+				"success": false,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// evictClient makes room for one more counter: it drops every expired one,
+// or the oldest when all are still running.
+func evictClient(clients map[string]*rateWindow, now time.Time, window time.Duration) {
+	var oldest string
+	for ip, w := range clients {
+		if now.Sub(w.start) >= window {
+			delete(clients, ip)
+			continue
+		}
+		if oldest == "" || w.start.Before(clients[oldest].start) {
+			oldest = ip
+		}
+	}
+	if len(clients) >= maxTrackedClients {
+		delete(clients, oldest)
+	}
+}
@@ -0,0 +1,205 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+	"github.com/MrPurushotam/web-visitor/middleware"
+	"github.com/MrPurushotam/web-visitor/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// maxApiKeysPerUser bounds active keys; revoked ones don't count.
+const maxApiKeysPerUser = 25
+
+type CreateApiKeyRequest struct {
+	Name   string   `json:"name" validate:"required,min=1,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1,max=20,dive,required"`
+	// ExpiresAt is optional; keys without it work until revoked.
+	ExpiresAt *time.Time `json:"expires_at"`
+	// AllowedIPs restricts the key to these IP addresses and CIDR ranges.
+	AllowedIPs []string `json:"allowed_ips" validate:"max=20,dive,required,max=64"`
+}
+
+func createApiKey(c *gin.Context) {
+	var req CreateApiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !utils.ValidAPIKeyScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"message": fmt.Sprintf("Unknown scope %q, scopes must be among: %s", scope, strings.Join(utils.APIKeyScopes, ", ")),
+				"success": false,
+			})
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	allowedIPs, err := utils.NormalizeAllowedIPs(req.AllowedIPs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"message": "expires_at must be in the future",
+			"success": false,
+		})
+		return
+	}
+
+	var count int
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM api_keys WHERE user_id = ? AND revoked_at IS NULL", userID).Scan(&count)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to count API keys",
+			"success": false,
+		})
+		return
+	}
+	if count >= maxApiKeysPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Limit reached",
+			"message": fmt.Sprintf("You can have at most %d API keys, revoke one first", maxApiKeysPerUser),
+			"success": false,
+		})
+		return
+	}
+
+	key, secret, err := utils.CreateAPIKey(userID.(int), strings.TrimSpace(req.Name), scopes, allowedIPs, req.ExpiresAt)
+	if err != nil {
+		log.Printf("Error creating API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to save API key",
+			"success": false,
+		})
+		return
+	}
+
+	// The key is only returned here; only its hash is stored.
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API key created, copy it now as it won't be shown again",
+		"success": true,
+		"data": gin.H{
+			"api_key": key,
+			"key":     secret,
+		},
+	})
+}
+
+func getAllApiKeys(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	keys, err := utils.ListAPIKeys(userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve API keys",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "API keys retrieved successfully",
+		"data": gin.H{
+			"api_keys": keys,
+			"scopes":   utils.APIKeyScopes,
+		},
+	})
+}
+
+func revokeApiKey(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	revoked, err := utils.RevokeAPIKey(userID.(int), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to revoke API key",
+			"success": false,
+		})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "API key not found",
+			"message": "The API key doesn't exist, is already revoked or doesn't belong to you",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key revoked",
+		"success": true,
+		"data":    gin.H{"api_key_id": c.Param("id")},
+	})
+}
+
+// InitApiKeyRouter registers key management. API keys themselves can't call
+// these routes, so a leaked key can't mint or keep itself alive.
+func InitApiKeyRouter(rg *gin.RouterGroup) {
+	router := rg.Group("/api-keys")
+	router.Use(middleware.AuthMiddleware())
+
+	{
+		router.POST("/", createApiKey)
+		router.GET("/", getAllApiKeys)
+		router.DELETE("/:id", revokeApiKey)
+	}
+}
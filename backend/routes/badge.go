@@ -0,0 +1,236 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+	"github.com/MrPurushotam/web-visitor/service"
+	"github.com/MrPurushotam/web-visitor/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Badges are cached briefly by browsers and README proxies such as GitHub's camo.
+const (
+	statusBadgeMaxAge = 60
+	statsBadgeMaxAge  = 300
+)
+
+// defaultResponseTimeWindow is shorter than the uptime default so the badge
+// follows recent performance.
+const defaultResponseTimeWindow = "24h"
+
+// maxBadgeLabel caps the ?label override.
+const maxBadgeLabel = 50
+
+// badgeURLs lists the public badge addresses of a token, nil when badges are off.
+func badgeURLs(token sql.NullString) gin.H {
+	if !token.Valid || token.String == "" {
+		return nil
+	}
+	base := "/badge/" + token.String
+	return gin.H{
+		"status":        base + "/status.svg",
+		"uptime":        base + "/uptime.svg",
+		"response_time": base + "/response-time.svg",
+	}
+}
+
+func writeBadge(c *gin.Context, code, maxAge int, label, message, color string) {
+	if custom := strings.TrimSpace(c.Query("label")); custom != "" && len(custom) <= maxBadgeLabel {
+		label = custom
+	}
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d, s-maxage=%d", maxAge, maxAge))
+	c.Header("Expires", time.Now().Add(time.Duration(maxAge)*time.Second).UTC().Format(http.TimeFormat))
+	c.Data(code, "image/svg+xml; charset=utf-8", service.RenderBadge(label, message, color))
+}
+
+// loadBadge resolves the token of a badge request. Failures are answered
+// with a grey badge so an embedded image still shows what went wrong.
+func loadBadge(c *gin.Context, label string) (service.BadgeMonitor, bool) {
+	m, err := service.LoadBadgeMonitor(c.Param("token"))
+	if err == sql.ErrNoRows {
+		writeBadge(c, http.StatusNotFound, statusBadgeMaxAge, label, "not found", service.BadgeGrey)
+		return m, false
+	}
+	if err != nil {
+		writeBadge(c, http.StatusInternalServerError, 0, label, "unavailable", service.BadgeGrey)
+		return m, false
+	}
+	return m, true
+}
+
+// badgeWindow reads ?window, answering bad values with a grey badge.
+func badgeWindow(c *gin.Context, label, fallback string) (string, time.Duration, bool) {
+	raw := c.DefaultQuery("window", fallback)
+	window, err := service.ParseBadgeWindow(raw)
+	if err != nil {
+		writeBadge(c, http.StatusBadRequest, 0, label, "invalid window", service.BadgeGrey)
+		return raw, 0, false
+	}
+	return raw, window, true
+}
+
+func statusBadge(c *gin.Context) {
+	m, ok := loadBadge(c, "status")
+	if !ok {
+		return
+	}
+	message, color := service.StatusBadgeMessage(m.Status)
+	writeBadge(c, http.StatusOK, statusBadgeMaxAge, "status", message, color)
+}
+
+func uptimeBadge(c *gin.Context) {
+	raw, window, ok := badgeWindow(c, "uptime", service.DefaultBadgeWindow)
+	if !ok {
+		return
+	}
+	label := "uptime " + raw
+	m, ok := loadBadge(c, label)
+	if !ok {
+		return
+	}
+	pct, err := service.WindowUptime(m.ID, time.Now().Add(-window))
+	if err != nil {
+		writeBadge(c, http.StatusInternalServerError, 0, label, "unavailable", service.BadgeGrey)
+		return
+	}
+	if pct == nil {
+		writeBadge(c, http.StatusOK, statsBadgeMaxAge, label, "no data", service.BadgeGrey)
+		return
+	}
+	writeBadge(c, http.StatusOK, statsBadgeMaxAge, label, service.FormatUptime(*pct), service.UptimeBadgeColor(*pct))
+}
+
+func responseTimeBadge(c *gin.Context) {
+	_, window, ok := badgeWindow(c, "response time", defaultResponseTimeWindow)
+	if !ok {
+		return
+	}
+	label := "response time"
+	m, ok := loadBadge(c, label)
+	if !ok {
+		return
+	}
+	avg, found, err := service.AverageResponseTime(m.ID, time.Now().Add(-window))
+	if err != nil {
+		writeBadge(c, http.StatusInternalServerError, 0, label, "unavailable", service.BadgeGrey)
+		return
+	}
+	if !found {
+		writeBadge(c, http.StatusOK, statsBadgeMaxAge, label, "no data", service.BadgeGrey)
+		return
+	}
+	writeBadge(c, http.StatusOK, statsBadgeMaxAge, label, fmt.Sprintf("%d ms", avg), service.ResponseTimeBadgeColor(avg))
+}
+
+// enableBadge gives a monitor a badge token, replacing the existing one so a
+// leaked badge URL can be revoked.
+func enableBadge(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	if !authorizeMonitor(c, userID, c.Param("id"), utils.RoleEditor) {
+		return
+	}
+
+	token, err := utils.GenerateSessionToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Token error",
+			"message": "Failed to generate badge token",
+			"success": false,
+		})
+		return
+	}
+	result, err := db.DB.Exec("UPDATE urls SET badge_token = ? WHERE id = ?", token, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to save badge token",
+			"success": false,
+		})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "URL not found",
+			"message": "The URL doesn't exist or doesn't belong to you",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Badges enabled",
+		"success": true,
+		"data": gin.H{
+			"badges": badgeURLs(sql.NullString{String: token, Valid: true}),
+		},
+	})
+}
+
+// disableBadge removes the badge token, after which every badge URL of the
+// monitor answers "not found".
+func disableBadge(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	if !authorizeMonitor(c, userID, c.Param("id"), utils.RoleEditor) {
+		return
+	}
+
+	var id int
+	err := db.DB.QueryRow("SELECT id FROM urls WHERE id = ?", c.Param("id")).Scan(&id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "URL not found",
+			"message": "The URL doesn't exist or doesn't belong to you",
+			"success": false,
+		})
+		return
+	}
+	if err == nil {
+		_, err = db.DB.Exec("UPDATE urls SET badge_token = NULL WHERE id = ?", id)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to disable badges",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Badges disabled",
+		"success": true,
+	})
+}
+
+// InitBadgeRouter registers the public badge images. They are authenticated
+// by the token alone so they can be embedded anywhere.
+func InitBadgeRouter(rg *gin.RouterGroup) {
+	router := rg.Group("/badge")
+
+	{
+		router.GET("/:token/status.svg", statusBadge)
+		router.GET("/:token/uptime.svg", uptimeBadge)
+		router.GET("/:token/response-time.svg", responseTimeBadge)
+	}
+}
@@ -0,0 +1,529 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+	"github.com/MrPurushotam/web-visitor/middleware"
+	"github.com/MrPurushotam/web-visitor/service"
+	"github.com/gin-gonic/gin"
+)
+
+// maxChannelsPerUser limits how many chat channels one user can configure.
+const maxChannelsPerUser = 20
+
+type CreateChannelRequest struct {
+	Type string `json:"type" validate:"required,oneof=slack discord teams telegram"`
+	Name string `json:"name" validate:"required,min=3,max=100"`
+	// Url is the incoming webhook URL of slack, discord and teams channels.
+	Url string `json:"url" validate:"required_unless=Type telegram,omitempty,min=5,max=500"`
+	// Token and ChatID address a telegram bot and the chat it posts to.
+	Token  string `json:"token" validate:"required_if=Type telegram,omitempty,min=10,max=255"`
+	ChatID string `json:"chat_id" validate:"required_if=Type telegram,omitempty,max=100"`
+}
+
+type EditChannelRequest struct {
+	Name     string `json:"name" validate:"omitempty,min=3,max=100"`
+	Url      string `json:"url" validate:"omitempty,min=5,max=500"`
+	Token    string `json:"token" validate:"omitempty,min=10,max=255"`
+	ChatID   string `json:"chat_id" validate:"omitempty,max=100"`
+	IsActive *bool  `json:"is_active"`
+}
+
+// checkTelegramToken rejects tokens that would change the Bot API path.
+func checkTelegramToken(token string) error {
+	if strings.ContainsAny(token, "/?#% ") {
+		return fmt.Errorf("token must be a Telegram bot token such as 123456:ABC-DEF")
+	}
+	return nil
+}
+
+// maskToken hides all but the bot id of a telegram token.
+func maskToken(token string) string {
+	if id, _, ok := strings.Cut(token, ":"); ok {
+		return id + ":****"
+	}
+	return "****"
+}
+
+// channelData is a channel as returned by the API.
+func channelData(ch service.Channel, isActive bool) gin.H {
+	data := gin.H{
+		"id":        ch.ID,
+		"type":      ch.Type,
+		"name":      ch.Name,
+		"is_active": isActive,
+	}
+	if ch.Type == service.ChannelTelegram {
+		data["token"] = maskToken(ch.Token)
+		data["chat_id"] = ch.ChatID
+	} else {
+		data["url"] = ch.URL
+	}
+	return data
+}
+
+// checkChannelsOwned verifies that every channel id belongs to the user who
+// owns the monitor, whose channels dispatchChannels sends alerts to.
+func checkChannelsOwned(userID any, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	unique := map[int]bool{}
+	args := []any{userID}
+	for _, id := range ids {
+		if !unique[id] {
+			unique[id] = true
+			args = append(args, id)
+		}
+	}
+	var count int
+	err := db.DB.QueryRow(
+		"SELECT COUNT(*) FROM notification_channels WHERE user_id = ? AND id IN (?"+strings.Repeat(", ?", len(unique)-1)+")",
+		args...,
+	).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to verify channels")
+	}
+	if count != len(unique) {
+		return fmt.Errorf("channels must be ids of the monitor owner's notification channels")
+	}
+	return nil
+}
+
+// loadChannel reads a channel of the authenticated user, writing the error
+// response itself when it can't.
+func loadChannel(c *gin.Context, userID any) (service.Channel, bool) {
+	ch, err := service.ScanChannel(db.DB.QueryRow(
+		"SELECT id, type, name, url, token, chat_id FROM notification_channels WHERE id = ? AND user_id = ?",
+		c.Param("id"), userID,
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Channel not found",
+			"message": "The channel doesn't exist or doesn't belong to you",
+			"success": false,
+		})
+		return ch, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve channel",
+			"success": false,
+		})
+		return ch, false
+	}
+	return ch, true
+}
+
+func createChannel(c *gin.Context) {
+	var req CreateChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	ch := service.Channel{Type: req.Type, Name: req.Name}
+	if req.Type == service.ChannelTelegram {
+		if err := checkTelegramToken(req.Token); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"message": err.Error(),
+				"success": false,
+			})
+			return
+		}
+		ch.Token, ch.ChatID = req.Token, req.ChatID
+	} else {
+		// Messages are posted from the server, so the same host rules as monitors apply.
+		normalizedURL, err := normalizeURL(req.Url)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid URL format",
+				"message": err.Error(),
+				"success": false,
+			})
+			return
+		}
+		ch.URL = normalizedURL
+	}
+
+	var count int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM notification_channels WHERE user_id = ?", userID).Scan(&count); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to count channels",
+			"success": false,
+		})
+		return
+	}
+	if count >= maxChannelsPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Limit reached",
+			"message": fmt.Sprintf("You can have at most %d channels", maxChannelsPerUser),
+			"success": false,
+		})
+		return
+	}
+
+	result, err := db.DB.Exec(
+		"INSERT INTO notification_channels (user_id, type, name, url, token, chat_id) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, ch.Type, ch.Name,
+		sql.NullString{String: ch.URL, Valid: ch.URL != ""},
+		sql.NullString{String: ch.Token, Valid: ch.Token != ""},
+		sql.NullString{String: ch.ChatID, Valid: ch.ChatID != ""},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to save channel",
+			"success": false,
+		})
+		return
+	}
+	id, _ := result.LastInsertId()
+	ch.ID = int(id)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Channel created successfully",
+		"success": true,
+		"data":    channelData(ch, true),
+	})
+}
+
+func getAllChannels(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	rows, err := db.DB.Query(`
+        SELECT id, type, name, url, token, chat_id, is_active, created_at
+        FROM notification_channels
+        WHERE user_id = ?
+        ORDER BY created_at DESC
+    `, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve channels",
+			"success": false,
+		})
+		return
+	}
+	defer rows.Close()
+
+	channels := []gin.H{}
+	for rows.Next() {
+		var (
+			ch                      service.Channel
+			webhookURL, token, chat sql.NullString
+			isActive                bool
+			createdAt               time.Time
+		)
+		if err := rows.Scan(&ch.ID, &ch.Type, &ch.Name, &webhookURL, &token, &chat, &isActive, &createdAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Database error",
+				"message": "Failed to parse channel data",
+				"success": false,
+			})
+			return
+		}
+		ch.URL, ch.Token, ch.ChatID = webhookURL.String, token.String, chat.String
+		data := channelData(ch, isActive)
+		data["created_at"] = createdAt.Format(time.RFC3339)
+		channels = append(channels, data)
+	}
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Error iterating through channels",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Channels retrieved successfully",
+		"data":    gin.H{"channels": channels},
+	})
+}
+
+func editChannel(c *gin.Context) {
+	var req EditChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if req == (EditChannelRequest{}) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": "At least one field must be provided",
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	ch, ok := loadChannel(c, userID)
+	if !ok {
+		return
+	}
+
+	telegram := ch.Type == service.ChannelTelegram
+	if (telegram && req.Url != "") || (!telegram && (req.Token != "" || req.ChatID != "")) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"message": "url only applies to slack, discord and teams channels, token and chat_id only to telegram",
+			"success": false,
+		})
+		return
+	}
+
+	if req.Name != "" {
+		ch.Name = req.Name
+	}
+	if req.Url != "" {
+		normalizedURL, err := normalizeURL(req.Url)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid URL format",
+				"message": err.Error(),
+				"success": false,
+			})
+			return
+		}
+		ch.URL = normalizedURL
+	}
+	if req.Token != "" {
+		if err := checkTelegramToken(req.Token); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"message": err.Error(),
+				"success": false,
+			})
+			return
+		}
+		ch.Token = req.Token
+	}
+	if req.ChatID != "" {
+		ch.ChatID = req.ChatID
+	}
+
+	var isActive bool
+	err := db.DB.QueryRow("SELECT is_active FROM notification_channels WHERE id = ?", ch.ID).Scan(&isActive)
+	if err == nil && req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+	if err == nil {
+		_, err = db.DB.Exec(
+			"UPDATE notification_channels SET name = ?, url = ?, token = ?, chat_id = ?, is_active = ? WHERE id = ? AND user_id = ?",
+			ch.Name,
+			sql.NullString{String: ch.URL, Valid: ch.URL != ""},
+			sql.NullString{String: ch.Token, Valid: ch.Token != ""},
+			sql.NullString{String: ch.ChatID, Valid: ch.ChatID != ""},
+			isActive, ch.ID, userID,
+		)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to update channel",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Channel updated successfully",
+		"success": true,
+		"data":    channelData(ch, isActive),
+	})
+}
+
+// deleteChannel removes a channel and drops it from the monitors that selected it.
+func deleteChannel(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	ch, ok := loadChannel(c, userID)
+	if !ok {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to start transaction",
+			"success": false,
+		})
+		return
+	}
+
+	rows, err := tx.Query("SELECT id, notification_channels FROM urls WHERE user_id = ? AND notification_channels IS NOT NULL", userID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve monitors using the channel",
+			"success": false,
+		})
+		return
+	}
+	selections := map[int][]int{}
+	for rows.Next() {
+		var (
+			urlID int
+			raw   sql.NullString
+		)
+		if err := rows.Scan(&urlID, &raw); err != nil {
+			continue
+		}
+		selections[urlID] = service.DecodeChannelIDs(raw)
+	}
+	rows.Close()
+
+	for urlID, ids := range selections {
+		kept := []int{}
+		for _, id := range ids {
+			if id != ch.ID {
+				kept = append(kept, id)
+			}
+		}
+		if len(kept) == len(ids) {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE urls SET notification_channels = ? WHERE id = ?", service.EncodeChannelIDs(kept), urlID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Database error",
+				"message": "Failed to update monitors using the channel",
+				"success": false,
+			})
+			return
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM notification_channels WHERE id = ? AND user_id = ?", ch.ID, userID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to delete channel",
+			"success": false,
+		})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to commit changes",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Channel deleted successfully",
+		"success": true,
+		"data":    gin.H{"channel_id": ch.ID},
+	})
+}
+
+// testChannel sends one sample alert without retries and reports the result.
+func testChannel(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	ch, ok := loadChannel(c, userID)
+	if !ok {
+		return
+	}
+
+	d := service.SendChannel(ch, service.TestAlert(), 1)
+	message := "Test message delivered"
+	if !d.Success {
+		message = "Test message delivery failed"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"success": true,
+		"data": gin.H{
+			"delivered":     d.Success,
+			"status_code":   d.StatusCode,
+			"response_body": d.Response,
+			"error_message": d.ErrorMessage,
+			"duration":      d.Duration,
+		},
+	})
+}
+
+func InitChannelRouter(rg *gin.RouterGroup) {
+	router := rg.Group("/channels")
+	router.Use(middleware.AuthMiddleware())
+
+	{
+		router.POST("/", createChannel)
+		router.GET("/", getAllChannels)
+		router.PUT("/:id", editChannel)
+		router.DELETE("/:id", deleteChannel)
+		router.POST("/:id/test", testChannel)
+	}
+}
@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/MrPurushotam/web-visitor/service"
+	"github.com/gin-gonic/gin"
+)
+
+// maxFailMessage caps how much of a /fail request body is kept as the error message.
+const maxFailMessage = 1000
+
+func heartbeatHandler(event string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Param("token")
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Missing parameter",
+				"message": "Heartbeat token is required",
+				"success": false,
+			})
+			return
+		}
+
+		// Jobs can explain a failure in the request body
+		var message string
+		if event == service.HeartbeatFail && c.Request.Body != nil {
+			body, _ := io.ReadAll(io.LimitReader(c.Request.Body, maxFailMessage))
+			message = strings.TrimSpace(string(body))
+		}
+
+		status, err := service.RecordHeartbeat(token, event, message)
+		if err == service.ErrHeartbeatNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Heartbeat not found",
+				"message": "No heartbeat monitor uses this token",
+				"success": false,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Database error",
+				"message": "Failed to record heartbeat",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Heartbeat recorded",
+			"success": true,
+			"data": gin.H{
+				"event":  event,
+				"status": status,
+			},
+		})
+	}
+}
+
+// InitHeartbeatRouter registers the ping URLs. They are authenticated by the
+// token alone so cron jobs can call them with a plain curl. GET is accepted
+// alongside POST for tools that can't send anything else.
+func InitHeartbeatRouter(rg *gin.RouterGroup) {
+	router := rg.Group("/heartbeat")
+	{
+		for _, method := range []string{http.MethodPost, http.MethodGet} {
+			router.Handle(method, "/:token", heartbeatHandler(service.HeartbeatPing))
+			router.Handle(method, "/:token/start", heartbeatHandler(service.HeartbeatStart))
+			router.Handle(method, "/:token/fail", heartbeatHandler(service.HeartbeatFail))
+		}
+	}
+}
@@ -0,0 +1,465 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+	"github.com/MrPurushotam/web-visitor/middleware"
+	"github.com/MrPurushotam/web-visitor/service"
+	"github.com/MrPurushotam/web-visitor/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type AcknowledgeIncidentRequest struct {
+	Note string `json:"note" validate:"omitempty,max=500"`
+}
+
+// incidentColumns are read by scanIncident. duration is computed by MySQL so
+// it doesn't depend on the time zone of the connection.
+const incidentColumns = `
+	i.id, i.url_id, urls.name, urls.url, i.status, i.first_status, i.cause,
+	i.started_at, i.acknowledged_at, i.acknowledged_by, i.resolved_at,
+	TIMESTAMPDIFF(SECOND, i.started_at, COALESCE(i.resolved_at, NOW()))`
+
+func scanIncident(row interface{ Scan(...any) error }) (int, gin.H, error) {
+	var (
+		id, urlID              int
+		name, cause            sql.NullString
+		url, status, firstStat string
+		startedAt              time.Time
+		acknowledgedAt         sql.NullTime
+		acknowledgedBy         sql.NullInt64
+		resolvedAt             sql.NullTime
+		duration               int64
+	)
+	if err := row.Scan(&id, &urlID, &name, &url, &status, &firstStat, &cause,
+		&startedAt, &acknowledgedAt, &acknowledgedBy, &resolvedAt, &duration); err != nil {
+		return 0, nil, err
+	}
+
+	incident := gin.H{
+		"id":              id,
+		"url_id":          urlID,
+		"name":            name.String,
+		"url":             url,
+		"status":          status,
+		"first_status":    firstStat,
+		"first_error":     cause.String,
+		"started_at":      startedAt.Format(time.RFC3339),
+		"acknowledged_at": nil,
+		"acknowledged_by": nil,
+		"resolved_at":     nil,
+		"duration":        duration,
+	}
+	if acknowledgedAt.Valid {
+		incident["acknowledged_at"] = acknowledgedAt.Time.Format(time.RFC3339)
+		if acknowledgedBy.Valid {
+			incident["acknowledged_by"] = acknowledgedBy.Int64
+		}
+	}
+	if resolvedAt.Valid {
+		incident["resolved_at"] = resolvedAt.Time.Format(time.RFC3339)
+	}
+	return id, incident, nil
+}
+
+// incidentTimelines loads the events of several incidents in one query,
+// oldest first.
+func incidentTimelines(ids []int) (map[int][]gin.H, error) {
+	timelines := make(map[int][]gin.H, len(ids))
+	if len(ids) == 0 {
+		return timelines, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+		timelines[id] = []gin.H{}
+	}
+
+	rows, err := db.DB.Query(`
+        SELECT incident_id, type, status, message, user_id, created_at
+        FROM incident_events
+        WHERE incident_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+        ORDER BY created_at ASC, id ASC
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			incidentID int
+			eventType  string
+			status     sql.NullString
+			message    sql.NullString
+			userID     sql.NullInt64
+			createdAt  time.Time
+		)
+		if err := rows.Scan(&incidentID, &eventType, &status, &message, &userID, &createdAt); err != nil {
+			return nil, err
+		}
+		event := gin.H{
+			"type":       eventType,
+			"status":     status.String,
+			"message":    message.String,
+			"user_id":    nil,
+			"created_at": createdAt.Format(time.RFC3339),
+		}
+		if userID.Valid {
+			event["user_id"] = userID.Int64
+		}
+		timelines[incidentID] = append(timelines[incidentID], event)
+	}
+	return timelines, rows.Err()
+}
+
+func getAllIncidents(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	// Incidents are visible to everyone who can see their monitor.
+	where := utils.MonitorAccess
+	args := []any{userID, userID}
+
+	// "active" covers every incident that isn't resolved yet.
+	switch status := c.Query("status"); status {
+	case "":
+	case "active":
+		where += " AND i.status <> ?"
+		args = append(args, service.IncidentResolved)
+	case service.IncidentOpen, service.IncidentAcknowledged, service.IncidentResolved:
+		where += " AND i.status = ?"
+		args = append(args, status)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid status",
+			"message": "status must be one of: open, acknowledged, resolved, active",
+			"success": false,
+		})
+		return
+	}
+
+	if urlParam := c.Query("url_id"); urlParam != "" {
+		urlID, err := strconv.Atoi(urlParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid url_id",
+				"message": "url_id must be a number",
+				"success": false,
+			})
+			return
+		}
+		where += " AND i.url_id = ?"
+		args = append(args, urlID)
+	}
+
+	// Handle pagination
+	limit := 10 // Default limit
+	offset := 0 // Default offset
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	if pageParam := c.Query("page"); pageParam != "" {
+		if parsedPage, err := strconv.Atoi(pageParam); err == nil && parsedPage > 0 {
+			offset = (parsedPage - 1) * limit
+		}
+	}
+
+	var totalCount int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM incidents i JOIN urls ON urls.id = i.url_id WHERE "+where, args...).Scan(&totalCount); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to get total incident count",
+			"success": false,
+		})
+		return
+	}
+
+	rows, err := db.DB.Query(`
+        SELECT `+incidentColumns+`
+        FROM incidents i
+        JOIN urls ON urls.id = i.url_id
+        WHERE `+where+`
+        ORDER BY i.started_at DESC, i.id DESC
+        LIMIT ? OFFSET ?
+    `, append(args, limit, offset)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve incidents",
+			"success": false,
+		})
+		return
+	}
+	defer rows.Close()
+
+	incidents := []gin.H{}
+	var ids []int
+	for rows.Next() {
+		id, incident, err := scanIncident(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Database error",
+				"message": "Failed to parse incident data",
+				"success": false,
+			})
+			return
+		}
+		ids = append(ids, id)
+		incidents = append(incidents, incident)
+	}
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Error iterating through incidents",
+			"success": false,
+		})
+		return
+	}
+
+	timelines, err := incidentTimelines(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve incident timelines",
+			"success": false,
+		})
+		return
+	}
+	for i, id := range ids {
+		incidents[i]["timeline"] = timelines[id]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Incidents retrieved successfully",
+		"data": gin.H{
+			"incidents": incidents,
+			"pagination": gin.H{
+				"total":  totalCount,
+				"limit":  limit,
+				"offset": offset,
+				"pages":  (totalCount + limit - 1) / limit,
+			},
+		},
+	})
+}
+
+// getIncident returns one incident with its timeline and the failing checks
+// that were logged while it was active.
+func getIncident(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	id, incident, err := scanIncident(db.DB.QueryRow(`
+        SELECT `+incidentColumns+`
+        FROM incidents i
+        JOIN urls ON urls.id = i.url_id
+        WHERE i.id = ? AND `+utils.MonitorAccess+`
+    `, c.Param("id"), userID, userID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Incident not found",
+			"message": "The incident doesn't exist or you can't see its monitor",
+			"success": false,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve incident",
+			"success": false,
+		})
+		return
+	}
+
+	timelines, err := incidentTimelines([]int{id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve incident timeline",
+			"success": false,
+		})
+		return
+	}
+	incident["timeline"] = timelines[id]
+
+	rows, err := db.DB.Query(`
+        SELECT id, status, response_time, response_code, error_message, checked_at
+        FROM logs
+        WHERE incident_id = ?
+        ORDER BY checked_at DESC, id DESC
+        LIMIT 100
+    `, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve incident logs",
+			"success": false,
+		})
+		return
+	}
+	defer rows.Close()
+
+	logs := []gin.H{}
+	for rows.Next() {
+		var (
+			logID        int
+			status       string
+			responseTime int
+			responseCode int
+			errorMessage sql.NullString
+			checkedAt    time.Time
+		)
+		if err := rows.Scan(&logID, &status, &responseTime, &responseCode, &errorMessage, &checkedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Database error",
+				"message": "Failed to parse log data",
+				"success": false,
+			})
+			return
+		}
+		logs = append(logs, gin.H{
+			"id":            logID,
+			"status":        status,
+			"response_time": responseTime,
+			"response_code": responseCode,
+			"error_message": errorMessage.String,
+			"checked_at":    checkedAt.Format(time.RFC3339),
+		})
+	}
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Error iterating through logs",
+			"success": false,
+		})
+		return
+	}
+	incident["logs"] = logs
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Incident retrieved successfully",
+		"data":    incident,
+	})
+}
+
+// acknowledgeIncident stops the repeat alerts of an active incident.
+func acknowledgeIncident(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	var req AcknowledgeIncidentRequest
+	// The body is optional, an empty one acknowledges without a note.
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"message": err.Error(),
+				"success": false,
+			})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			validationFailed(c, err)
+			return
+		}
+	}
+
+	incidentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid ID",
+			"message": "Incident ID must be a number",
+			"success": false,
+		})
+		return
+	}
+
+	// Viewers of the monitor see its incidents, acknowledging needs an editor.
+	var urlID string
+	err = db.DB.QueryRow(
+		"SELECT i.url_id FROM incidents i JOIN urls ON urls.id = i.url_id WHERE i.id = ? AND "+utils.MonitorAccess,
+		incidentID, userID, userID,
+	).Scan(&urlID)
+	if err == sql.ErrNoRows {
+		err = service.ErrIncidentNotFound
+	} else if err == nil {
+		if !authorizeMonitor(c, userID, urlID, utils.RoleEditor) {
+			return
+		}
+		err = service.AcknowledgeIncident(incidentID, userID.(int), strings.TrimSpace(req.Note))
+	}
+	switch {
+	case errors.Is(err, service.ErrIncidentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Incident not found",
+			"message": "The incident doesn't exist or you can't see its monitor",
+			"success": false,
+		})
+		return
+	case errors.Is(err, service.ErrIncidentResolved):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Incident resolved",
+			"message": "The incident is already resolved",
+			"success": false,
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to acknowledge incident",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Incident acknowledged, repeat alerts are stopped",
+		"success": true,
+	})
+}
+
+func InitIncidentRouter(rg *gin.RouterGroup) {
+	router := rg.Group("/incidents")
+	router.Use(middleware.AuthMiddleware())
+
+	{
+		router.GET("/", getAllIncidents)
+		router.GET("/:id", getIncident)
+		router.POST("/:id/acknowledge", acknowledgeIncident)
+	}
+}
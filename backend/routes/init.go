@@ -10,4 +10,15 @@ func Init(r *gin.Engine) {
 	InitUserRouter(v1)
 	InitUriRouter(v1)
 	InitLogsRouter(v1)
+	InitHeartbeatRouter(v1)
+	InitWebhookRouter(v1)
+	InitChannelRouter(v1)
+	InitIncidentRouter(v1)
+	InitStatusPageRouter(v1)
+	InitApiKeyRouter(v1)
+	InitOrganizationRouter(v1)
+
+	// Public status pages and badges live outside the API prefix.
+	InitStatusRouter(&r.RouterGroup)
+	InitBadgeRouter(&r.RouterGroup)
 }
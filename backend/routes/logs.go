@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -8,6 +9,8 @@ import (
 
 	db "github.com/MrPurushotam/web-visitor/config"
 	"github.com/MrPurushotam/web-visitor/middleware"
+	"github.com/MrPurushotam/web-visitor/service"
+	"github.com/MrPurushotam/web-visitor/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -57,9 +60,9 @@ func getAllLogs(c *gin.Context) {
 		return
 	}
 
-	var urlBelongsToUser bool
-	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM urls WHERE id = ? AND user_id = ?)", urlId, userID).Scan(&urlBelongsToUser)
-	if err != nil {
+	// Every role of an organization may read its monitors' logs.
+	_, err = utils.MonitorRole(userID.(int), urlId)
+	if err != nil && err != sql.ErrNoRows {
 		fmt.Printf("Database error checking URL ownership: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Database error",
@@ -69,8 +72,8 @@ func getAllLogs(c *gin.Context) {
 		return
 	}
 
-	// If URL exists but doesn't belong to the user
-	if !urlBelongsToUser {
+	// If URL exists but the user can't see it
+	if err == sql.ErrNoRows {
 		fmt.Printf("URL %s exists but doesn't belong to user %v\n", urlId, userID)
 		c.JSON(http.StatusForbidden, gin.H{
 			"error":   "Access denied",
@@ -96,6 +99,26 @@ func getAllLogs(c *gin.Context) {
 		}
 	}
 
+	switch granularity := c.Query("granularity"); granularity {
+	case "":
+		getTieredLogs(c, urlId, limit, offset)
+		return
+	case "raw":
+	case service.BucketHour:
+		getRollupLogs(c, urlId, service.HourlyRollup, limit, offset)
+		return
+	case service.BucketDay:
+		getRollupLogs(c, urlId, service.DailyRollup, limit, offset)
+		return
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid granularity",
+			"message": "granularity must be one of: raw, hour, day",
+			"success": false,
+		})
+		return
+	}
+
 	var totalCount int
 	err = db.DB.QueryRow("SELECT COUNT(*) FROM logs WHERE url_id=?", urlId).Scan(&totalCount)
 
@@ -108,15 +131,7 @@ func getAllLogs(c *gin.Context) {
 		return
 	}
 
-	// Query to get URLs with pagination
-    rows, err := db.DB.Query(`
-        SELECT id, url_id, status, response_time, response_code, error_message, checked_at 
-        FROM logs 
-        WHERE url_id = ? 
-        ORDER BY checked_at DESC 
-        LIMIT ? OFFSET ?
-    `, urlId, limit, offset)
-
+	logs, err := rawLogs(urlId, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Database error",
@@ -126,6 +141,37 @@ func getAllLogs(c *gin.Context) {
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Logs retrieved successfully",
+		"data": gin.H{
+			"logs": logs,
+			"pagination": gin.H{
+				"total":  totalCount,
+				"limit":  limit,
+				"offset": offset,
+				"pages":  (totalCount + limit - 1) / limit,
+			},
+		},
+	})
+
+}
+
+// rawLogs reads one page of the raw checks of a monitor, newest first.
+func rawLogs(urlId string, limit, offset int) ([]gin.H, error) {
+	// Query to get URLs with pagination
+	rows, err := db.DB.Query(`
+        SELECT id, url_id, status, response_time, response_code, error_message, checked_at,
+            dns_time, connect_time, tls_time, ttfb_time, download_time, dns_answer, event, attempt, confirmed
+        FROM logs 
+        WHERE url_id = ? 
+        ORDER BY checked_at DESC 
+        LIMIT ? OFFSET ?
+    `, urlId, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
 	defer rows.Close()
 
 	logs := []gin.H{}
@@ -137,17 +183,19 @@ func getAllLogs(c *gin.Context) {
 			status        string
 			response_time int
 			response_code int
-			error_message string
+			error_message sql.NullString
 			checked_at    time.Time
+			timings       service.NullTimings
+			dns_answer    sql.NullString
+			event         sql.NullString
+			attempt       int
+			confirmed     bool
 		)
 
-		if err := rows.Scan(&id, &url_id, &status, &response_time, &response_code, &error_message, &checked_at); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Database error",
-				"message": "Failed to parse log data",
-				"success": false,
-			})
-			return
+		dest := []any{&id, &url_id, &status, &response_time, &response_code, &error_message, &checked_at}
+		dest = append(dest, timings.Dest()...)
+		if err := rows.Scan(append(dest, &dns_answer, &event, &attempt, &confirmed)...); err != nil {
+			return nil, err
 		}
 
 		// Append log data to the slice
@@ -157,17 +205,46 @@ func getAllLogs(c *gin.Context) {
 			"status":        status,
 			"response_time": response_time,
 			"response_code": response_code,
-			"error_message": error_message,
+			"error_message": error_message.String,
 			"checked_at":    checked_at.Format(time.RFC3339),
+			"attempt":       attempt,
+			"confirmed":     confirmed,
+		}
+		if t, ok := timings.Get(); ok {
+			logData["timings"] = t
+		}
+		if event.Valid {
+			logData["event"] = event.String
+		}
+		if dns_answer.Valid {
+			logData["dns_answer"] = service.DecodeAnswer(dns_answer)
 		}
 
 		logs = append(logs, logData)
 	}
 	// Check for errors from iterating over rows
-	if err = rows.Err(); err != nil {
+	return logs, rows.Err()
+}
+
+// getRollupLogs pages through the hourly or daily aggregates of a monitor,
+// which outlive the raw logs.
+func getRollupLogs(c *gin.Context, urlId string, level service.RollupLevel, limit, offset int) {
+	var totalCount int
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM "+level.Table+" WHERE url_id = ?", urlId).Scan(&totalCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to get total log count",
+			"success": false,
+		})
+		return
+	}
+
+	logs, err := rollupLogs(urlId, level, time.Time{}, limit, offset)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Database error",
-			"message": "Error iterating through logs",
+			"message": "Failed to retrieve logs",
 			"success": false,
 		})
 		return
@@ -177,7 +254,8 @@ func getAllLogs(c *gin.Context) {
 		"success": true,
 		"message": "Logs retrieved successfully",
 		"data": gin.H{
-			"logs": logs,
+			"granularity": level.Bucket,
+			"logs":        logs,
 			"pagination": gin.H{
 				"total":  totalCount,
 				"limit":  limit,
@@ -186,7 +264,152 @@ func getAllLogs(c *gin.Context) {
 			},
 		},
 	})
+}
+
+// rollupLogs reads one page of the aggregates of a monitor, newest first.
+// A non-zero latest leaves out buckets that start after it.
+func rollupLogs(urlId string, level service.RollupLevel, latest time.Time, limit, offset int) ([]gin.H, error) {
+	where, args := "url_id = ?", []any{urlId}
+	if !latest.IsZero() {
+		where, args = where+" AND bucket_start <= ?", append(args, latest)
+	}
+	rows, err := db.DB.Query(
+		"SELECT "+service.RollupColumns+" FROM "+level.Table+" WHERE "+where+" ORDER BY bucket_start DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []gin.H{}
+	for rows.Next() {
+		r, err := service.ScanRollup(rows)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, gin.H{
+			"bucket_start":  r.BucketStart.UTC().Format(time.RFC3339),
+			"checks":        r.Checks,
+			"failures":      r.Failures,
+			"uptime":        r.Uptime(),
+			"response_time": r.Latency,
+		})
+	}
+	return logs, rows.Err()
+}
+
+// logTier is one granularity of the history paged through by getTieredLogs.
+type logTier struct {
+	// level is nil for raw logs.
+	level *service.RollupLevel
+	// latest is the newest bucket start taken from the rollup.
+	latest time.Time
+	count  int
+}
+
+// logTiers lays out the history of a monitor newest first, the way
+// retention leaves it behind: raw logs, then the whole hours before the
+// oldest of them, then the whole days before the oldest of those hours.
+func logTiers(urlId string) ([]logTier, error) {
+	var (
+		raw    logTier
+		oldest sql.NullTime
+	)
+	err := db.DB.QueryRow("SELECT COUNT(*), MIN(checked_at) FROM logs WHERE url_id = ?", urlId).Scan(&raw.count, &oldest)
+	if err != nil {
+		return nil, err
+	}
+	tiers := []logTier{raw}
+
+	// covered is where the finer tiers read so far start.
+	covered := time.Now().UTC()
+	if oldest.Valid {
+		covered = oldest.Time.UTC()
+	}
+	for _, level := range service.RollupLevels {
+		tier := logTier{level: &level, latest: covered.Add(-time.Hour)}
+		if level == service.DailyRollup {
+			tier.latest = covered.AddDate(0, 0, -1)
+		}
+		err := db.DB.QueryRow(
+			"SELECT COUNT(*), MIN(bucket_start) FROM "+level.Table+" WHERE url_id = ? AND bucket_start <= ?",
+			urlId, tier.latest,
+		).Scan(&tier.count, &oldest)
+		if err != nil {
+			return nil, err
+		}
+		if oldest.Valid {
+			covered = oldest.Time.UTC()
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers, nil
+}
 
+// getTieredLogs pages through raw logs and carries on with hourly and then
+// daily rollups once a page goes past the raw retention window. Every entry
+// says which granularity it is.
+func getTieredLogs(c *gin.Context, urlId string, limit, offset int) {
+	tiers, err := logTiers(urlId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to get total log count",
+			"success": false,
+		})
+		return
+	}
+
+	totalCount := 0
+	logs := []gin.H{}
+	skip := offset
+	for _, tier := range tiers {
+		totalCount += tier.count
+		if len(logs) == limit || tier.count == 0 {
+			continue
+		}
+		if skip >= tier.count {
+			skip -= tier.count
+			continue
+		}
+
+		var page []gin.H
+		granularity := "raw"
+		if tier.level == nil {
+			page, err = rawLogs(urlId, limit-len(logs), skip)
+		} else {
+			granularity = tier.level.Bucket
+			page, err = rollupLogs(urlId, *tier.level, tier.latest, limit-len(logs), skip)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Database error",
+				"message": "Failed to retrieve logs",
+				"success": false,
+			})
+			return
+		}
+		for _, entry := range page {
+			entry["granularity"] = granularity
+		}
+		logs = append(logs, page...)
+		skip = 0
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Logs retrieved successfully",
+		"data": gin.H{
+			"logs": logs,
+			"pagination": gin.H{
+				"total":  totalCount,
+				"limit":  limit,
+				"offset": offset,
+				"pages":  (totalCount + limit - 1) / limit,
+			},
+		},
+	})
 }
 
 func InitLogsRouter(rg *gin.RouterGroup) {
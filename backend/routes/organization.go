@@ -0,0 +1,626 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MrPurushotam/web-visitor/middleware"
+	"github.com/MrPurushotam/web-visitor/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type OrganizationRequest struct {
+	Name string `json:"name" validate:"required,min=2,max=100"`
+}
+
+type InvitationRequest struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+	Role  string `json:"role" validate:"required,oneof=owner admin editor viewer"`
+}
+
+type MemberRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner admin editor viewer"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// authorizeMonitor checks that the authenticated user has at least role min
+// on a monitor, writing the error response itself when not. Monitors the
+// user can't see at all answer 404 as if they didn't exist.
+func authorizeMonitor(c *gin.Context, userID any, uriID string, min utils.Role) bool {
+	role, err := utils.MonitorRole(userID.(int), uriID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "URI not found",
+			"message": "The URI doesn't exist or doesn't belong to you",
+			"success": false,
+		})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to verify URI access",
+			"success": false,
+		})
+		return false
+	}
+	if !role.Can(min) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Access denied",
+			"message": "Your role " + string(role) + " can't do this, it needs " + string(min),
+			"success": false,
+		})
+		return false
+	}
+	return true
+}
+
+// loadMembership resolves the organization in the path and the role of the
+// authenticated user in it, writing the error response itself when the user
+// isn't a member or has less than role min.
+func loadMembership(c *gin.Context, min utils.Role) (orgID, userID int, role utils.Role, ok bool) {
+	id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return 0, 0, "", false
+	}
+	userID = id.(int)
+
+	orgID, err := strconv.Atoi(c.Param("id"))
+	if err == nil {
+		role, err = utils.MemberRole(orgID, userID)
+	} else {
+		err = utils.ErrNotMember
+	}
+	if errors.Is(err, utils.ErrNotMember) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Organization not found",
+			"message": "The organization doesn't exist or you aren't a member",
+			"success": false,
+		})
+		return 0, 0, "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to verify membership",
+			"success": false,
+		})
+		return 0, 0, "", false
+	}
+	if !role.Can(min) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Access denied",
+			"message": "Your role " + string(role) + " can't do this, it needs " + string(min),
+			"success": false,
+		})
+		return 0, 0, "", false
+	}
+	return orgID, userID, role, true
+}
+
+// canManage reports whether a member with role actor may change a member
+// with role target. Owners manage everyone, others only lower roles.
+func canManage(actor, target utils.Role) bool {
+	return actor == utils.RoleOwner || (actor.Can(utils.RoleAdmin) && !target.Can(actor))
+}
+
+// memberError answers the errors shared by the member endpoints.
+func memberError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, utils.ErrNotMember):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Member not found",
+			"message": "The user isn't a member of this organization",
+			"success": false,
+		})
+	case errors.Is(err, utils.ErrLastOwner):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Last owner",
+			"message": "Make another member owner first, an organization needs at least one owner",
+			"success": false,
+		})
+	default:
+		log.Printf("Error trying to %s: %v", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to " + action,
+			"success": false,
+		})
+	}
+}
+
+func createOrganization(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	org, err := utils.CreateOrganization(userID.(int), strings.TrimSpace(req.Name))
+	if err != nil {
+		log.Printf("Error creating organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to create organization",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Organization created",
+		"success": true,
+		"data":    org,
+	})
+}
+
+func getAllOrganizations(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	orgs, err := utils.ListOrganizations(userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve organizations",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Organizations retrieved successfully",
+		"data": gin.H{
+			"organizations": orgs,
+		},
+	})
+}
+
+// getOrganization returns an organization with its members. Any member may
+// see who else is in it.
+func getOrganization(c *gin.Context) {
+	orgID, userID, _, ok := loadMembership(c, utils.RoleViewer)
+	if !ok {
+		return
+	}
+
+	org, err := utils.GetOrganization(orgID, userID)
+	var members []utils.Member
+	if err == nil {
+		members, err = utils.ListMembers(orgID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve organization",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Organization retrieved successfully",
+		"data": gin.H{
+			"organization": org,
+			"members":      members,
+		},
+	})
+}
+
+func renameOrganization(c *gin.Context) {
+	orgID, _, _, ok := loadMembership(c, utils.RoleAdmin)
+	if !ok {
+		return
+	}
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	if err := utils.RenameOrganization(orgID, strings.TrimSpace(req.Name)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to update organization",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Organization updated",
+		"success": true,
+		"data":    gin.H{"id": orgID, "name": strings.TrimSpace(req.Name)},
+	})
+}
+
+// deleteOrganization is for owners, once the organization has no monitors.
+func deleteOrganization(c *gin.Context) {
+	orgID, _, _, ok := loadMembership(c, utils.RoleOwner)
+	if !ok {
+		return
+	}
+
+	err := utils.DeleteOrganization(orgID)
+	if errors.Is(err, utils.ErrOrganizationHasMonitors) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Organization has monitors",
+			"message": "Delete the organization's monitors or move them to a personal account first",
+			"success": false,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting organization %d: %v", orgID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to delete organization",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Organization deleted",
+		"success": true,
+		"data":    gin.H{"organization_id": orgID},
+	})
+}
+
+// updateMember changes the role of a member. Owners change anyone; admins
+// only change lower roles and grant at most their own role.
+func updateMember(c *gin.Context) {
+	orgID, _, role, ok := loadMembership(c, utils.RoleAdmin)
+	if !ok {
+		return
+	}
+	var req MemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	memberID, err := strconv.Atoi(c.Param("user_id"))
+	var current utils.Role
+	if err == nil {
+		current, err = utils.MemberRole(orgID, memberID)
+	} else {
+		err = utils.ErrNotMember
+	}
+	if err != nil {
+		memberError(c, err, "update member")
+		return
+	}
+	newRole := utils.Role(req.Role)
+	if !canManage(role, current) || !role.Can(newRole) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Access denied",
+			"message": "Only owners can change admins and owners or grant a role above their own",
+			"success": false,
+		})
+		return
+	}
+
+	if err := utils.SetMemberRole(orgID, memberID, newRole); err != nil {
+		memberError(c, err, "update member")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Member updated",
+		"success": true,
+		"data":    gin.H{"user_id": memberID, "role": newRole},
+	})
+}
+
+// removeMember takes a member out of the organization. Every member may
+// leave by removing themselves.
+func removeMember(c *gin.Context) {
+	orgID, userID, role, ok := loadMembership(c, utils.RoleViewer)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.Atoi(c.Param("user_id"))
+	var current utils.Role
+	if err == nil {
+		current, err = utils.MemberRole(orgID, memberID)
+	} else {
+		err = utils.ErrNotMember
+	}
+	if err != nil {
+		memberError(c, err, "remove member")
+		return
+	}
+	if memberID != userID && !canManage(role, current) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Access denied",
+			"message": "Only admins can remove members, and only owners can remove admins and owners",
+			"success": false,
+		})
+		return
+	}
+
+	if err := utils.RemoveMember(orgID, memberID); err != nil {
+		memberError(c, err, "remove member")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Member removed",
+		"success": true,
+		"data":    gin.H{"user_id": memberID},
+	})
+}
+
+// inviteMember emails an invitation. Admins invite with at most their own
+// role, so only owners can invite owners.
+func inviteMember(c *gin.Context) {
+	orgID, userID, role, ok := loadMembership(c, utils.RoleAdmin)
+	if !ok {
+		return
+	}
+	var req InvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		validationFailed(c, err)
+		return
+	}
+	if !role.Can(utils.Role(req.Role)) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Access denied",
+			"message": "You can't invite with a role above your own",
+			"success": false,
+		})
+		return
+	}
+
+	invitation, err := utils.CreateInvitation(orgID, userID, strings.TrimSpace(req.Email), utils.Role(req.Role))
+	switch {
+	case errors.Is(err, utils.ErrAlreadyMember):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Already a member",
+			"message": "This email address already belongs to a member",
+			"success": false,
+		})
+		return
+	case errors.Is(err, utils.ErrInvitationsExceeded):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Limit reached",
+			"message": "Too many pending invitations, revoke some first",
+			"success": false,
+		})
+		return
+	case err != nil && invitation.ID == 0:
+		log.Printf("Error creating invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to create invitation",
+			"success": false,
+		})
+		return
+	case err != nil:
+		// The invitation is saved; it can be sent again by inviting anew.
+		log.Printf("Error sending invitation %d: %v", invitation.ID, err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Invitation sent",
+		"success": true,
+		"data":    invitation,
+	})
+}
+
+func getInvitations(c *gin.Context) {
+	orgID, _, _, ok := loadMembership(c, utils.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	invitations, err := utils.ListInvitations(orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve invitations",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Invitations retrieved successfully",
+		"data": gin.H{
+			"invitations": invitations,
+		},
+	})
+}
+
+func revokeInvitation(c *gin.Context) {
+	orgID, _, _, ok := loadMembership(c, utils.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	revoked, err := utils.RevokeInvitation(orgID, c.Param("invitation_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to revoke invitation",
+			"success": false,
+		})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Invitation not found",
+			"message": "The invitation doesn't exist or was already accepted",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Invitation revoked",
+		"success": true,
+		"data":    gin.H{"invitation_id": c.Param("invitation_id")},
+	})
+}
+
+// acceptInvitation joins the organization of an emailed invitation. The
+// logged in account must have the address the invitation was sent to.
+func acceptInvitation(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	orgID, err := utils.AcceptInvitation(req.Token, userID.(int))
+	switch {
+	case errors.Is(err, utils.ErrTokenInvalid), errors.Is(err, utils.ErrTokenExpired):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid invitation",
+			"message": "The invitation is invalid, expired or already used, ask for a new one",
+			"success": false,
+		})
+		return
+	case errors.Is(err, utils.ErrInvitationEmail):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Wrong account",
+			"message": "Log in with the email address the invitation was sent to",
+			"success": false,
+		})
+		return
+	case errors.Is(err, utils.ErrAlreadyMember):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Already a member",
+			"message": "You are already a member of this organization",
+			"success": false,
+		})
+		return
+	case err != nil:
+		log.Printf("Error accepting invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to accept invitation",
+			"success": false,
+		})
+		return
+	}
+
+	org, err := utils.GetOrganization(orgID, userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve organization",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "You joined " + org.Name,
+		"success": true,
+		"data":    org,
+	})
+}
+
+func InitOrganizationRouter(rg *gin.RouterGroup) {
+	router := rg.Group("/organizations")
+	router.Use(middleware.AuthMiddleware())
+
+	{
+		router.POST("/", createOrganization)
+		router.GET("/", getAllOrganizations)
+		router.POST("/invitations/accept", acceptInvitation)
+		router.GET("/:id", getOrganization)
+		router.PUT("/:id", renameOrganization)
+		router.DELETE("/:id", deleteOrganization)
+		router.PUT("/:id/members/:user_id", updateMember)
+		router.DELETE("/:id/members/:user_id", removeMember)
+		router.POST("/:id/invitations", inviteMember)
+		router.GET("/:id/invitations", getInvitations)
+		router.DELETE("/:id/invitations/:invitation_id", revokeInvitation)
+	}
+}
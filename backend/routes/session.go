@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/MrPurushotam/web-visitor/utils"
+	"github.com/gin-gonic/gin"
+)
+
+func getSessions(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	sessions, err := utils.ListSessions(userID.(int), c.GetInt("sessionId"))
+	if err != nil {
+		log.Printf("Error listing sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve sessions",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Sessions retrieved successfully",
+		"data": gin.H{
+			"sessions": sessions,
+		},
+	})
+}
+
+// revokeSession logs out one session, which may be the current one.
+func revokeSession(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	revoked := false
+	if err == nil {
+		revoked, err = utils.RevokeSession(userID.(int), sessionID)
+		if err != nil {
+			log.Printf("Error revoking session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Database error",
+				"message": "Failed to revoke session",
+				"success": false,
+			})
+			return
+		}
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Session not found",
+			"message": "The session doesn't exist, has ended or doesn't belong to you",
+			"success": false,
+		})
+		return
+	}
+
+	if sessionID == c.GetInt("sessionId") {
+		c.SetCookie("session_token", "", -1, "/", "", false, true)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Session revoked",
+		"data":    gin.H{"session_id": sessionID},
+	})
+}
+
+// revokeAllSessions logs out everywhere. With ?keep_current=true the session
+// making the request stays logged in.
+func revokeAllSessions(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	keepCurrent := c.Query("keep_current") == "true"
+	keepID := 0
+	if keepCurrent {
+		keepID = c.GetInt("sessionId")
+	}
+
+	count, err := utils.RevokeAllSessions(userID.(int), keepID)
+	if err != nil {
+		log.Printf("Error revoking sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to revoke sessions",
+			"success": false,
+		})
+		return
+	}
+
+	if !keepCurrent {
+		c.SetCookie("session_token", "", -1, "/", "", false, true)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Sessions revoked",
+		"data":    gin.H{"revoked": count},
+	})
+}
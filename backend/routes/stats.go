@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+	"github.com/MrPurushotam/web-visitor/service"
+	"github.com/MrPurushotam/web-visitor/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultStatsRange is covered when the request has no from.
+const defaultStatsRange = 7 * 24 * time.Hour
+
+// parseStatsTime accepts RFC 3339 timestamps and plain dates, which mean
+// midnight UTC.
+func parseStatsTime(name, raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp or a date such as 2024-01-31", name)
+}
+
+// getUriStats summarizes the history of a monitor: uptime, incidents,
+// downtime, MTTR, MTBF and response time percentiles, overall and per bucket.
+func getUriStats(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	var urlID int
+	err := db.DB.QueryRow("SELECT id FROM urls WHERE id = ? AND "+utils.MonitorAccess, c.Param("id"), userID, userID).Scan(&urlID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "URL not found",
+			"message": "The URL doesn't exist or doesn't belong to you",
+			"success": false,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to verify URL ownership",
+			"success": false,
+		})
+		return
+	}
+
+	to := time.Now()
+	if raw := c.Query("to"); raw != "" {
+		if to, err = parseStatsTime("to", raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid period",
+				"message": err.Error(),
+				"success": false,
+			})
+			return
+		}
+	}
+	from := to.Add(-defaultStatsRange)
+	if raw := c.Query("from"); raw != "" {
+		if from, err = parseStatsTime("from", raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid period",
+				"message": err.Error(),
+				"success": false,
+			})
+			return
+		}
+	}
+	bucket := c.DefaultQuery("bucket", service.DefaultBucket(from, to))
+	if err := service.CheckStatsPeriod(from, to, bucket); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid period",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+
+	stats, err := service.MonitorStats(urlID, from, to, bucket)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to compute statistics",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Statistics retrieved successfully",
+		"data":    stats,
+	})
+}
@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/MrPurushotam/web-visitor/service"
+	"github.com/gin-gonic/gin"
+)
+
+var stateLabels = map[string]string{
+	service.StateOperational: "Operational",
+	service.StateDegraded:    "Degraded performance",
+	service.StateOutage:      "Outage",
+	service.StateMaintenance: "Under maintenance",
+}
+
+var pageStateLabels = map[string]string{
+	service.StateOperational: "All systems operational",
+	service.StateDegraded:    "Some systems are degraded",
+	service.StateOutage:      "Some systems are down",
+	service.StateMaintenance: "Scheduled maintenance in progress",
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"state":     func(s string) string { return stateLabels[s] },
+	"pageState": func(s string) string { return pageStateLabels[s] },
+	"uptime": func(p *float64) string {
+		if p == nil {
+			return "No data"
+		}
+		return fmt.Sprintf("%.2f%%", *p)
+	},
+	"date": func(t time.Time) string { return t.UTC().Format("Jan 2, 15:04 MST") },
+	"days": func() int { return service.UptimeDays },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; color: #1f2328; background: #f6f8fa; margin: 0; }
+main { max-width: 860px; margin: 0 auto; padding: 32px 16px; }
+header { display: flex; align-items: center; gap: 12px; margin-bottom: 8px; }
+header img { max-height: 40px; }
+h1 { font-size: 24px; margin: 0; }
+.description { color: #59636e; margin: 0 0 24px; }
+.banner { padding: 16px; border-radius: 6px; color: #fff; font-weight: 600; margin-bottom: 24px; }
+.operational { background: #1a7f37; } .degraded { background: #bf8700; }
+.outage { background: #cf222e; } .maintenance { background: #0969da; }
+section { background: #fff; border: 1px solid #d1d9e0; border-radius: 6px; padding: 16px; margin-bottom: 16px; }
+h2 { font-size: 16px; margin: 0 0 12px; }
+.row { display: flex; justify-content: space-between; font-size: 14px; margin: 12px 0 6px; }
+.state-operational { color: #1a7f37; } .state-degraded { color: #bf8700; } .state-outage { color: #cf222e; }
+.bars { display: flex; gap: 2px; height: 32px; }
+.bars span { flex: 1; border-radius: 2px; }
+.up { background: #2da44e; } .partial { background: #d4a72c; } .down { background: #cf222e; } .none { background: #d1d9e0; }
+.legend { display: flex; justify-content: space-between; color: #59636e; font-size: 12px; margin-top: 4px; }
+.notice h3 { font-size: 14px; margin: 0 0 4px; } .notice p { margin: 0 0 12px; color: #59636e; font-size: 14px; }
+footer { color: #59636e; font-size: 12px; text-align: center; margin-top: 24px; }
+</style>
+</head>
+<body>
+<main>
+<header>{{if .LogoURL}}<img src="{{.LogoURL}}" alt="">{{end}}<h1>{{.Title}}</h1></header>
+{{if .Description}}<p class="description">{{.Description}}</p>{{end}}
+<div class="banner {{.Status}}">{{pageState .Status}}</div>
+{{if .Maintenance}}<section class="notice"><h2>Maintenance</h2>
+{{range .Maintenance}}<h3>{{.Title}}{{if .Active}} (in progress){{end}}</h3>
+<p>{{date .StartsAt}} to {{date .EndsAt}}{{if .Description}}: {{.Description}}{{end}}</p>
+{{end}}</section>{{end}}
+{{if .Incidents}}<section class="notice"><h2>Active incidents</h2>
+{{range .Incidents}}<h3>{{.Monitor}}: {{state .Status}}</h3>
+<p>Since {{date .StartedAt}}{{if .Acknowledged}}, we are working on it{{else}}, investigating{{end}}</p>
+{{end}}</section>{{end}}
+{{range .Components}}<section>
+<h2>{{.Name}} <span class="state-{{.Status}}">· {{state .Status}}</span></h2>
+{{range .Monitors}}<div class="row"><span>{{.Name}}</span><span class="state-{{.Status}}">{{state .Status}}</span></div>
+<div class="bars">{{range .Days}}<span class="{{.Level}}" title="{{.Date}}: {{uptime .Uptime}}"></span>{{end}}</div>
+<div class="legend"><span>{{days}} days ago</span><span>{{uptime .Uptime}} uptime</span><span>Today</span></div>
+{{end}}</section>
+{{end}}
+<footer>Updated {{date .UpdatedAt}} · Powered by Web Visitor</footer>
+</main>
+</body>
+</html>
+`))
+
+// renderStatusPage answers with the HTML page, or with JSON when the client
+// asks for it through ?format=json or the Accept header.
+func renderStatusPage(c *gin.Context, page service.StatusPage) {
+	view, err := service.BuildStatusPageView(page)
+	if err != nil {
+		log.Printf("Error building status page %s: %v", page.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to load status page",
+			"success": false,
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=60")
+	if c.Query("format") == "json" || c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "Status page retrieved successfully",
+			"data":    view,
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := statusPageTemplate.Execute(&buf, view); err != nil {
+		log.Printf("Error rendering status page %s: %v", page.Slug, err)
+		c.String(http.StatusInternalServerError, "Failed to render status page")
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+func publicStatusPage(c *gin.Context) {
+	page, err := service.LoadStatusPage("slug", c.Param("slug"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Status page not found",
+			"message": "No status page is published at this address",
+			"success": false,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to load status page",
+			"success": false,
+		})
+		return
+	}
+	renderStatusPage(c, page)
+}
+
+// StatusPageDomain serves a status page on the root of its custom domain.
+// Requests on any other host, or for other paths, go on as usual.
+func StatusPageDomain() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet || c.Request.URL.Path != "/" {
+			c.Next()
+			return
+		}
+		id := service.StatusPageForHost(c.Request.Host)
+		if id == 0 {
+			c.Next()
+			return
+		}
+		page, err := service.LoadStatusPage("id", id)
+		if err != nil {
+			c.Next()
+			return
+		}
+		renderStatusPage(c, page)
+		c.Abort()
+	}
+}
+
+func InitStatusRouter(rg *gin.RouterGroup) {
+	router := rg.Group("/status")
+
+	{
+		router.GET("/:slug", publicStatusPage)
+	}
+}
@@ -0,0 +1,699 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+	"github.com/MrPurushotam/web-visitor/middleware"
+	"github.com/MrPurushotam/web-visitor/service"
+	"github.com/MrPurushotam/web-visitor/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// maxStatusPagesPerUser keeps slugs from being squatted in bulk.
+const maxStatusPagesPerUser = 5
+
+type CreateStatusPageRequest struct {
+	Slug        string `json:"slug" validate:"required,min=3,max=50"`
+	Title       string `json:"title" validate:"required,min=1,max=100"`
+	Description string `json:"description" validate:"omitempty,max=1000"`
+	LogoURL     string `json:"logo_url" validate:"omitempty,max=500"`
+	// CustomDomain serves the page on its own host, e.g. status.example.com,
+	// once a CNAME points it at this server.
+	CustomDomain string                    `json:"custom_domain" validate:"omitempty,max=253"`
+	Components   []service.StatusComponent `json:"components" validate:"required,min=1,dive"`
+}
+
+type EditStatusPageRequest struct {
+	Slug         string                    `json:"slug" validate:"omitempty,min=3,max=50"`
+	Title        string                    `json:"title" validate:"omitempty,min=1,max=100"`
+	Description  *string                   `json:"description" validate:"omitempty,max=1000"`
+	LogoURL      *string                   `json:"logo_url" validate:"omitempty,max=500"`
+	CustomDomain *string                   `json:"custom_domain" validate:"omitempty,max=253"`
+	Components   []service.StatusComponent `json:"components" validate:"omitempty,min=1,dive"`
+}
+
+type CreateMaintenanceRequest struct {
+	Title       string    `json:"title" validate:"required,min=1,max=200"`
+	Description string    `json:"description" validate:"omitempty,max=2000"`
+	StartsAt    time.Time `json:"starts_at" validate:"required"`
+	EndsAt      time.Time `json:"ends_at" validate:"required"`
+}
+
+// checkStatusPage validates the fields shared by create and edit and
+// normalizes them in place.
+func checkStatusPage(userID any, pageID int, slug, logoURL, domain *string, components []service.StatusComponent) error {
+	if slug != nil {
+		*slug = strings.ToLower(strings.TrimSpace(*slug))
+		if !service.SlugPattern.MatchString(*slug) {
+			return fmt.Errorf("slug may only contain lowercase letters, digits and dashes")
+		}
+		var taken int
+		if err := db.DB.QueryRow("SELECT COUNT(*) FROM status_pages WHERE slug = ? AND id <> ?", *slug, pageID).Scan(&taken); err != nil {
+			return fmt.Errorf("failed to verify slug")
+		}
+		if taken > 0 {
+			return fmt.Errorf("slug %q is already taken", *slug)
+		}
+	}
+	if logoURL != nil && *logoURL != "" {
+		normalized, err := normalizeURL(*logoURL)
+		if err != nil {
+			return fmt.Errorf("logo_url: %v", err)
+		}
+		*logoURL = normalized
+	}
+	if domain != nil && *domain != "" {
+		normalized, err := service.NormalizeDomain(*domain)
+		if err != nil {
+			return err
+		}
+		*domain = normalized
+		var taken int
+		if err := db.DB.QueryRow("SELECT COUNT(*) FROM status_pages WHERE custom_domain = ? AND id <> ?", *domain, pageID).Scan(&taken); err != nil {
+			return fmt.Errorf("failed to verify custom domain")
+		}
+		if taken > 0 {
+			return fmt.Errorf("custom domain %s is used by another status page", *domain)
+		}
+	}
+	if components != nil {
+		page := service.StatusPage{Components: components}
+		if err := checkMonitorsVisible(userID, page.MonitorIDs()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMonitorsVisible makes sure a status page only lists monitors the user
+// can see, at least as a viewer of their organization, each once.
+func checkMonitorsVisible(userID any, ids []int) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("components must list at least one monitor")
+	}
+	if len(ids) > service.MaxStatusPageMonitors {
+		return fmt.Errorf("a status page can show at most %d monitors", service.MaxStatusPageMonitors)
+	}
+	unique := map[int]bool{}
+	args := []any{userID, userID}
+	for _, id := range ids {
+		if unique[id] {
+			return fmt.Errorf("monitor %d is listed more than once", id)
+		}
+		unique[id] = true
+		args = append(args, id)
+	}
+	var count int
+	err := db.DB.QueryRow(
+		"SELECT COUNT(*) FROM urls WHERE "+utils.MonitorAccess+" AND id IN (?"+strings.Repeat(", ?", len(ids)-1)+")",
+		args...,
+	).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to verify monitors")
+	}
+	if count != len(ids) {
+		return fmt.Errorf("url_id must be the id of a monitor you can see")
+	}
+	return nil
+}
+
+// loadStatusPage reads a page of the authenticated user, writing the error
+// response itself when it can't.
+func loadStatusPage(c *gin.Context, userID any) (service.StatusPage, bool) {
+	page, err := service.LoadStatusPage("id", c.Param("id"))
+	if err == nil && page.UserID != userID.(int) {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Status page not found",
+			"message": "The status page doesn't exist or doesn't belong to you",
+			"success": false,
+		})
+		return page, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve status page",
+			"success": false,
+		})
+		return page, false
+	}
+	return page, true
+}
+
+func statusPageData(p service.StatusPage) gin.H {
+	components := p.Components
+	if components == nil {
+		components = []service.StatusComponent{}
+	}
+	return gin.H{
+		"id":            p.ID,
+		"slug":          p.Slug,
+		"title":         p.Title,
+		"description":   p.Description,
+		"logo_url":      p.LogoURL,
+		"custom_domain": p.CustomDomain,
+		"public_url":    "/status/" + p.Slug,
+		"components":    components,
+	}
+}
+
+func createStatusPage(c *gin.Context) {
+	var req CreateStatusPageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	var count int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM status_pages WHERE user_id = ?", userID).Scan(&count); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to check status page limit",
+			"success": false,
+		})
+		return
+	}
+	if count >= maxStatusPagesPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Limit reached",
+			"message": fmt.Sprintf("You can have at most %d status pages", maxStatusPagesPerUser),
+			"success": false,
+		})
+		return
+	}
+
+	if err := checkStatusPage(userID, 0, &req.Slug, &req.LogoURL, &req.CustomDomain, req.Components); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid status page",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to start transaction",
+			"success": false,
+		})
+		return
+	}
+	result, err := tx.Exec(
+		"INSERT INTO status_pages (user_id, slug, title, description, logo_url, custom_domain) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, req.Slug, req.Title,
+		sql.NullString{String: req.Description, Valid: req.Description != ""},
+		sql.NullString{String: req.LogoURL, Valid: req.LogoURL != ""},
+		sql.NullString{String: req.CustomDomain, Valid: req.CustomDomain != ""},
+	)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to save status page",
+			"success": false,
+		})
+		return
+	}
+	id, _ := result.LastInsertId()
+	if err := service.SaveStatusPageMonitors(tx, int(id), req.Components); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to save status page components",
+			"success": false,
+		})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to commit changes",
+			"success": false,
+		})
+		return
+	}
+	if req.CustomDomain != "" {
+		service.ForgetStatusDomains()
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Status page created successfully",
+		"success": true,
+		"data": statusPageData(service.StatusPage{
+			ID:           int(id),
+			Slug:         req.Slug,
+			Title:        req.Title,
+			Description:  req.Description,
+			LogoURL:      req.LogoURL,
+			CustomDomain: req.CustomDomain,
+			Components:   req.Components,
+		}),
+	})
+}
+
+func getAllStatusPages(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT id FROM status_pages WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve status pages",
+			"success": false,
+		})
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	pages := []gin.H{}
+	for _, id := range ids {
+		page, err := service.LoadStatusPage("id", id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Database error",
+				"message": "Failed to retrieve status page",
+				"success": false,
+			})
+			return
+		}
+		pages = append(pages, statusPageData(page))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Status pages retrieved successfully",
+		"data":    pages,
+	})
+}
+
+func getStatusPage(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	page, ok := loadStatusPage(c, userID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Status page retrieved successfully",
+		"data":    statusPageData(page),
+	})
+}
+
+func editStatusPage(c *gin.Context) {
+	var req EditStatusPageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	page, ok := loadStatusPage(c, userID)
+	if !ok {
+		return
+	}
+
+	var slug *string
+	if req.Slug != "" {
+		slug = &req.Slug
+	}
+	if err := checkStatusPage(userID, page.ID, slug, req.LogoURL, req.CustomDomain, req.Components); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid status page",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+
+	if slug != nil {
+		page.Slug = *slug
+	}
+	if req.Title != "" {
+		page.Title = req.Title
+	}
+	if req.Description != nil {
+		page.Description = *req.Description
+	}
+	if req.LogoURL != nil {
+		page.LogoURL = *req.LogoURL
+	}
+	domainChanged := req.CustomDomain != nil && *req.CustomDomain != page.CustomDomain
+	if req.CustomDomain != nil {
+		page.CustomDomain = *req.CustomDomain
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to start transaction",
+			"success": false,
+		})
+		return
+	}
+	_, err = tx.Exec(
+		"UPDATE status_pages SET slug = ?, title = ?, description = ?, logo_url = ?, custom_domain = ? WHERE id = ?",
+		page.Slug, page.Title,
+		sql.NullString{String: page.Description, Valid: page.Description != ""},
+		sql.NullString{String: page.LogoURL, Valid: page.LogoURL != ""},
+		sql.NullString{String: page.CustomDomain, Valid: page.CustomDomain != ""},
+		page.ID,
+	)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to update status page",
+			"success": false,
+		})
+		return
+	}
+	if req.Components != nil {
+		if err := service.SaveStatusPageMonitors(tx, page.ID, req.Components); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Database error",
+				"message": "Failed to save status page components",
+				"success": false,
+			})
+			return
+		}
+		page.Components = req.Components
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to commit changes",
+			"success": false,
+		})
+		return
+	}
+	if domainChanged {
+		service.ForgetStatusDomains()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Status page updated successfully",
+		"success": true,
+		"data":    statusPageData(page),
+	})
+}
+
+func deleteStatusPage(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	page, ok := loadStatusPage(c, userID)
+	if !ok {
+		return
+	}
+
+	if _, err := db.DB.Exec("DELETE FROM status_pages WHERE id = ? AND user_id = ?", page.ID, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to delete status page",
+			"success": false,
+		})
+		return
+	}
+	if page.CustomDomain != "" {
+		service.ForgetStatusDomains()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Status page deleted successfully",
+		"success": true,
+	})
+}
+
+func createMaintenance(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	page, ok := loadStatusPage(c, userID)
+	if !ok {
+		return
+	}
+
+	var req CreateMaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		validationFailed(c, err)
+		return
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid maintenance window",
+			"message": "ends_at must be after starts_at",
+			"success": false,
+		})
+		return
+	}
+	if req.EndsAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid maintenance window",
+			"message": "ends_at is in the past",
+			"success": false,
+		})
+		return
+	}
+
+	result, err := db.DB.Exec(
+		"INSERT INTO status_page_maintenance (page_id, title, description, starts_at, ends_at) VALUES (?, ?, ?, ?, ?)",
+		page.ID, req.Title, sql.NullString{String: req.Description, Valid: req.Description != ""},
+		req.StartsAt.UTC(), req.EndsAt.UTC(),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to save maintenance window",
+			"success": false,
+		})
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Maintenance scheduled successfully",
+		"success": true,
+		"data": gin.H{
+			"id":          id,
+			"title":       req.Title,
+			"description": req.Description,
+			"starts_at":   req.StartsAt.UTC().Format(time.RFC3339),
+			"ends_at":     req.EndsAt.UTC().Format(time.RFC3339),
+		},
+	})
+}
+
+func getMaintenance(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	page, ok := loadStatusPage(c, userID)
+	if !ok {
+		return
+	}
+
+	rows, err := db.DB.Query(
+		"SELECT id, title, description, starts_at, ends_at FROM status_page_maintenance WHERE page_id = ? ORDER BY starts_at DESC",
+		page.ID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve maintenance windows",
+			"success": false,
+		})
+		return
+	}
+	defer rows.Close()
+
+	windows := []gin.H{}
+	for rows.Next() {
+		var (
+			id               int
+			title            string
+			description      sql.NullString
+			startsAt, endsAt time.Time
+		)
+		if err := rows.Scan(&id, &title, &description, &startsAt, &endsAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Database error",
+				"message": "Failed to parse maintenance data",
+				"success": false,
+			})
+			return
+		}
+		windows = append(windows, gin.H{
+			"id":          id,
+			"title":       title,
+			"description": description.String,
+			"starts_at":   startsAt.Format(time.RFC3339),
+			"ends_at":     endsAt.Format(time.RFC3339),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Maintenance windows retrieved successfully",
+		"data":    windows,
+	})
+}
+
+func deleteMaintenance(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	page, ok := loadStatusPage(c, userID)
+	if !ok {
+		return
+	}
+	maintenanceID, err := strconv.Atoi(c.Param("maintenance_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid ID",
+			"message": "Maintenance ID must be a number",
+			"success": false,
+		})
+		return
+	}
+
+	result, err := db.DB.Exec("DELETE FROM status_page_maintenance WHERE id = ? AND page_id = ?", maintenanceID, page.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to delete maintenance window",
+			"success": false,
+		})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Maintenance not found",
+			"message": "The maintenance window doesn't exist on this status page",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Maintenance window deleted successfully",
+		"success": true,
+	})
+}
+
+func InitStatusPageRouter(rg *gin.RouterGroup) {
+	router := rg.Group("/status-pages")
+	router.Use(middleware.AuthMiddleware())
+
+	{
+		router.POST("/", createStatusPage)
+		router.GET("/", getAllStatusPages)
+		router.GET("/:id", getStatusPage)
+		router.PUT("/:id", editStatusPage)
+		router.DELETE("/:id", deleteStatusPage)
+		router.POST("/:id/maintenance", createMaintenance)
+		router.GET("/:id/maintenance", getMaintenance)
+		router.DELETE("/:id/maintenance/:maintenance_id", deleteMaintenance)
+	}
+}
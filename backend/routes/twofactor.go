@@ -0,0 +1,244 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+	"github.com/MrPurushotam/web-visitor/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type TwoFactorCodeRequest struct {
+	// Code is a 6 digit TOTP code or, where accepted, a recovery code.
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required,max=32"`
+}
+
+func bindTwoFactorCode(c *gin.Context) (string, bool) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return "", false
+	}
+	if err := validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"message": "Code is required",
+			"success": false,
+		})
+		return "", false
+	}
+	return req.Code, true
+}
+
+// twoFactorError answers the errors shared by the two-factor endpoints.
+func twoFactorError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, utils.ErrInvalidCode):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid code",
+			"message": "The code is invalid or was already used",
+			"success": false,
+		})
+	case errors.Is(err, utils.ErrTwoFactorEnabled), errors.Is(err, utils.ErrTwoFactorDisabled), errors.Is(err, utils.ErrTwoFactorNotStarted):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Two-factor state",
+			"message": err.Error(),
+			"success": false,
+		})
+	default:
+		log.Printf("Error trying to %s: %v", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal server error",
+			"message": "Failed to " + action,
+			"success": false,
+		})
+	}
+}
+
+// setupTwoFactor starts enrollment. The secret only takes effect once a
+// code from it is confirmed.
+func setupTwoFactor(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	secret, uri, err := utils.BeginTOTPEnrollment(userID.(int))
+	if err != nil {
+		twoFactorError(c, err, "start two-factor setup")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Add the secret to your authenticator app, then confirm a code",
+		"data": gin.H{
+			"secret":      secret,
+			"otpauth_uri": uri,
+		},
+	})
+}
+
+// confirmTwoFactor enables two-factor and returns the recovery codes, which
+// are shown this once.
+func confirmTwoFactor(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	code, ok := bindTwoFactorCode(c)
+	if !ok {
+		return
+	}
+
+	codes, err := utils.ConfirmTOTPEnrollment(userID.(int), code)
+	if err != nil {
+		twoFactorError(c, err, "confirm two-factor setup")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Two-factor authentication enabled, store the recovery codes somewhere safe",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+func disableTwoFactor(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	code, ok := bindTwoFactorCode(c)
+	if !ok {
+		return
+	}
+
+	if err := utils.DisableTwoFactor(userID.(int), code); err != nil {
+		twoFactorError(c, err, "disable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// regenerateRecoveryCodes replaces all recovery codes, used or not.
+func regenerateRecoveryCodes(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	code, ok := bindTwoFactorCode(c)
+	if !ok {
+		return
+	}
+
+	codes, err := utils.RegenerateRecoveryCodes(userID.(int), code)
+	if err != nil {
+		twoFactorError(c, err, "regenerate recovery codes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Recovery codes replaced, the old ones no longer work",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// loginTwoFactor is the second login step: the challenge from the password
+// step plus a TOTP or recovery code opens the session.
+func loginTwoFactor(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"message": "challenge_token and code are required",
+			"success": false,
+		})
+		return
+	}
+
+	userID, err := utils.CompleteLoginChallenge(req.ChallengeToken, req.Code)
+	if errors.Is(err, utils.ErrTokenInvalid) || errors.Is(err, utils.ErrTokenExpired) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid challenge",
+			"message": "The login challenge is invalid or expired, log in again",
+			"success": false,
+		})
+		return
+	}
+	if errors.Is(err, utils.ErrInvalidCode) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid code",
+			"message": "The code is invalid or was already used",
+			"success": false,
+		})
+		return
+	}
+	if err != nil {
+		twoFactorError(c, err, "complete login")
+		return
+	}
+
+	var user User
+	err = db.DB.QueryRow(
+		"SELECT id, name, email, COALESCE(verified, FALSE), totp_enabled FROM users WHERE id = ?", userID,
+	).Scan(&user.ID, &user.Name, &user.Email, &user.Verified, &user.TwoFactor)
+	if err != nil {
+		log.Printf("Error fetching user details: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal server error",
+			"message": "Failed to create session",
+			"success": false,
+		})
+		return
+	}
+	startSession(c, user)
+}
@@ -2,26 +2,358 @@ package routes
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	db "github.com/MrPurushotam/web-visitor/config"
 	"github.com/MrPurushotam/web-visitor/middleware"
+	"github.com/MrPurushotam/web-visitor/service"
+	"github.com/MrPurushotam/web-visitor/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 )
 
 type AddUriRequest struct {
-	Url  string `json:"url" validate:"required,min=5,max=500"`
+	Url  string `json:"url" validate:"required_unless=Type heartbeat,omitempty,min=5,max=500"`
 	Name string `json:"name" validate:"required,min=3,max=100"`
+	// Type is http (default), tcp where Url is host:port, dns where Url is a
+	// hostname, or heartbeat which needs no Url and is pinged by the job.
+	Type           string `json:"type" validate:"omitempty,oneof=http tcp dns heartbeat"`
+	Interval       string `json:"interval" validate:"omitempty,oneof=6hr 12hr"`
+	CustomInterval int    `json:"custom_interval" validate:"omitempty,min=30,max=86400"`
+	// ContentRules are evaluated against the first MaxBodyBytes of the response body.
+	ContentRules []service.ContentRule `json:"content_rules" validate:"omitempty,max=20,dive"`
+	MaxBodyBytes int                   `json:"max_body_bytes" validate:"omitempty,min=1,max=5242880"`
+	// JSONAssertions make this an API monitor evaluated against a JSON body.
+	JSONAssertions []service.JSONAssertion `json:"json_assertions" validate:"omitempty,max=20,dive"`
+	Method         string                  `json:"method" validate:"omitempty,oneof=GET POST PUT HEAD OPTIONS"`
+	Headers        map[string]string       `json:"headers" validate:"omitempty,max=30,dive,keys,min=1,max=100,endkeys,max=1000"`
+	Body           string                  `json:"body" validate:"omitempty,max=65535"`
+	// AcceptedStatuses is a list of codes and ranges, e.g. "200,204,401" or "200-299".
+	AcceptedStatuses string `json:"accepted_statuses" validate:"omitempty,max=255"`
+	// Payload is sent after a TCP connect; the reply must start with ExpectBanner.
+	Payload      string `json:"payload" validate:"omitempty,max=4096"`
+	ExpectBanner string `json:"expect_banner" validate:"omitempty,max=255"`
+	// CertExpiryDays raises a warning when the certificate expires within that many days.
+	CertExpiryDays int `json:"cert_expiry_days" validate:"omitempty,min=1,max=365"`
+	// RecordType, Resolver (host[:port]) and ExpectedAnswers configure dns monitors.
+	RecordType      string   `json:"record_type" validate:"omitempty,oneof=A AAAA CNAME MX TXT NS"`
+	Resolver        string   `json:"resolver" validate:"omitempty,max=255"`
+	ExpectedAnswers []string `json:"expected_answers" validate:"omitempty,max=50,dive,min=1,max=255"`
+	// GracePeriod is how many seconds a heartbeat ping may be late.
+	GracePeriod int `json:"grace_period" validate:"omitempty,min=0,max=86400"`
+	// RetryCount retries a failed check RetryDelay seconds later; the status
+	// only changes after FailureThreshold failed checks in a row.
+	RetryCount       int `json:"retry_count" validate:"omitempty,min=0,max=5"`
+	RetryDelay       int `json:"retry_delay" validate:"omitempty,min=1,max=60"`
+	FailureThreshold int `json:"failure_threshold" validate:"omitempty,min=1,max=10"`
+	// Channels are ids of the user's notification channels alerted on status changes.
+	Channels []int `json:"channels" validate:"omitempty,max=10,dive,min=1"`
+	// OrganizationID adds the monitor to an organization the user edits
+	// rather than to the user's own monitors.
+	OrganizationID int `json:"organization_id" validate:"omitempty,min=1"`
 }
 type EditUriRequest struct {
-	Url  string `json:"url" validate:"omitempty,min=5,max=500"`
-	Name string `json:"name" validate:"omitempty,min=3,max=100"`
+	Url      string `json:"url" validate:"omitempty,min=5,max=500"`
+	Name     string `json:"name" validate:"omitempty,min=3,max=100"`
+	Interval string `json:"interval" validate:"omitempty,oneof=6hr 12hr"`
+	// CustomInterval is in seconds; 0 clears it and falls back to Interval.
+	CustomInterval *int `json:"custom_interval" validate:"omitempty,eq=0|min=30,max=86400"`
+	// ContentRules replaces the stored rules; an empty list removes them.
+	ContentRules *[]service.ContentRule `json:"content_rules" validate:"omitempty,max=20,dive"`
+	MaxBodyBytes *int                   `json:"max_body_bytes" validate:"omitempty,eq=0|min=1,max=5242880"`
+	// JSONAssertions replaces the stored assertions; an empty list removes them.
+	JSONAssertions *[]service.JSONAssertion `json:"json_assertions" validate:"omitempty,max=20,dive"`
+	Method         string                   `json:"method" validate:"omitempty,oneof=GET POST PUT HEAD OPTIONS"`
+	// Headers replaces the stored headers; an empty object removes them.
+	Headers          *map[string]string `json:"headers" validate:"omitempty,max=30,dive,keys,min=1,max=100,endkeys,max=1000"`
+	Body             *string            `json:"body" validate:"omitempty,max=65535"`
+	AcceptedStatuses *string            `json:"accepted_statuses" validate:"omitempty,max=255"`
+	Payload          *string            `json:"payload" validate:"omitempty,max=4096"`
+	ExpectBanner     *string            `json:"expect_banner" validate:"omitempty,max=255"`
+	// CertExpiryDays of 0 resets the warning threshold to the default.
+	CertExpiryDays *int    `json:"cert_expiry_days" validate:"omitempty,eq=0|min=1,max=365"`
+	RecordType     string  `json:"record_type" validate:"omitempty,oneof=A AAAA CNAME MX TXT NS"`
+	Resolver       *string `json:"resolver" validate:"omitempty,max=255"`
+	// ExpectedAnswers replaces the stored list; an empty list switches to change detection.
+	ExpectedAnswers *[]string `json:"expected_answers" validate:"omitempty,max=50,dive,min=1,max=255"`
+	GracePeriod     *int      `json:"grace_period" validate:"omitempty,min=0,max=86400"`
+	// RetryDelay and FailureThreshold of 0 reset them to their defaults.
+	RetryCount       *int `json:"retry_count" validate:"omitempty,min=0,max=5"`
+	RetryDelay       *int `json:"retry_delay" validate:"omitempty,eq=0|min=1,max=60"`
+	FailureThreshold *int `json:"failure_threshold" validate:"omitempty,eq=0|min=1,max=10"`
+	// Channels replaces the selected channels; an empty list stops chat alerts.
+	Channels *[]int `json:"channels" validate:"omitempty,max=10,dive,min=1"`
+	// OrganizationID moves the monitor to an organization, or back to the
+	// user's own monitors with 0. Moving needs admin rights on the monitor.
+	OrganizationID *int `json:"organization_id" validate:"omitempty,min=0"`
+}
+
+// monitorOwner is the SQL condition and argument selecting the monitors that
+// share an owner with a monitor of orgID, for duplicate checks.
+func monitorOwner(userID any, orgID sql.NullInt64) (string, any) {
+	if orgID.Valid {
+		return "organization_id = ?", orgID.Int64
+	}
+	return "organization_id IS NULL AND user_id = ?", userID
+}
+
+// checkOrganizationEditor checks that the user may add monitors to an
+// organization, writing the error response itself when not.
+func checkOrganizationEditor(c *gin.Context, userID any, orgID int) bool {
+	role, err := utils.MemberRole(orgID, userID.(int))
+	if err != nil && !errors.Is(err, utils.ErrNotMember) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to verify membership",
+			"success": false,
+		})
+		return false
+	}
+	if !role.Can(utils.RoleEditor) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Access denied",
+			"message": "You need to be an editor of the organization to add monitors to it",
+			"success": false,
+		})
+		return false
+	}
+	return true
+}
+
+// monitor builds the check configuration described by the request.
+func (req AddUriRequest) monitor(normalizedURL string) service.Monitor {
+	recordType := req.RecordType
+	if req.Type == service.TypeDNS && recordType == "" {
+		recordType = "A"
+	}
+	return service.Monitor{
+		URL:              normalizedURL,
+		Type:             req.Type,
+		ContentRules:     req.ContentRules,
+		MaxBodyBytes:     req.MaxBodyBytes,
+		JSONAssertions:   req.JSONAssertions,
+		Method:           req.Method,
+		Headers:          req.Headers,
+		Body:             req.Body,
+		AcceptedStatuses: req.AcceptedStatuses,
+		Payload:          req.Payload,
+		ExpectBanner:     req.ExpectBanner,
+		CertExpiryDays:   req.CertExpiryDays,
+		DNSRecordType:    recordType,
+		DNSResolver:      req.Resolver,
+		DNSExpected:      req.ExpectedAnswers,
+		HeartbeatGrace:   req.GracePeriod,
+		RetryCount:       req.RetryCount,
+		RetryDelay:       req.RetryDelay,
+		FailureThreshold: req.FailureThreshold,
+		Channels:         req.Channels,
+	}
+}
+
+// applyTo copies the check settings present in the request onto m and
+// reports whether any of them were given.
+func (req EditUriRequest) applyTo(m *service.Monitor) bool {
+	changed := false
+	if req.ContentRules != nil {
+		m.ContentRules = *req.ContentRules
+		changed = true
+	}
+	if req.MaxBodyBytes != nil {
+		m.MaxBodyBytes = *req.MaxBodyBytes
+		changed = true
+	}
+	if req.JSONAssertions != nil {
+		m.JSONAssertions = *req.JSONAssertions
+		changed = true
+	}
+	if req.Method != "" {
+		m.Method = req.Method
+		changed = true
+	}
+	if req.Headers != nil {
+		m.Headers = *req.Headers
+		changed = true
+	}
+	if req.Body != nil {
+		m.Body = *req.Body
+		changed = true
+	}
+	if req.AcceptedStatuses != nil {
+		m.AcceptedStatuses = *req.AcceptedStatuses
+		changed = true
+	}
+	if req.Payload != nil {
+		m.Payload = *req.Payload
+		changed = true
+	}
+	if req.ExpectBanner != nil {
+		m.ExpectBanner = *req.ExpectBanner
+		changed = true
+	}
+	if req.CertExpiryDays != nil {
+		m.CertExpiryDays = *req.CertExpiryDays
+		changed = true
+	}
+	dnsChanged := false
+	if req.RecordType != "" && req.RecordType != m.DNSRecordType {
+		m.DNSRecordType = req.RecordType
+		dnsChanged = true
+	}
+	if req.Resolver != nil {
+		m.DNSResolver = *req.Resolver
+		dnsChanged = true
+	}
+	if req.ExpectedAnswers != nil {
+		m.DNSExpected = *req.ExpectedAnswers
+		dnsChanged = true
+	}
+	if req.GracePeriod != nil {
+		m.HeartbeatGrace = *req.GracePeriod
+		changed = true
+	}
+	if req.RetryCount != nil {
+		m.RetryCount = *req.RetryCount
+		changed = true
+	}
+	if req.RetryDelay != nil {
+		m.RetryDelay = *req.RetryDelay
+		changed = true
+	}
+	if req.FailureThreshold != nil {
+		m.FailureThreshold = *req.FailureThreshold
+		changed = true
+	}
+	if req.Channels != nil {
+		// Only affects alerting, so it doesn't count as a change that needs a recheck.
+		m.Channels = *req.Channels
+	}
+	if dnsChanged {
+		// A different question has a different answer; start change detection over.
+		m.DNSPrevious = nil
+		changed = true
+	}
+	return changed
+}
+
+// monitorConfig is the check configuration as returned by the API.
+func monitorConfig(m service.Monitor) gin.H {
+	config := typeConfig(m)
+	channels := m.Channels
+	if channels == nil {
+		channels = []int{}
+	}
+	config["channels"] = channels
+	if m.MonitorType() == service.TypeHeartbeat {
+		return config
+	}
+	retryDelay := m.RetryDelay
+	if retryDelay == 0 {
+		retryDelay = service.DefaultRetryDelay
+	}
+	failureThreshold := m.FailureThreshold
+	if failureThreshold == 0 {
+		failureThreshold = 1
+	}
+	config["retry_count"] = m.RetryCount
+	config["retry_delay"] = retryDelay
+	config["failure_threshold"] = failureThreshold
+	return config
+}
+
+// typeConfig is the part of monitorConfig specific to the monitor type.
+func typeConfig(m service.Monitor) gin.H {
+	switch m.MonitorType() {
+	case service.TypeHeartbeat:
+		var lastPing any
+		if m.HeartbeatLastPing.Valid {
+			lastPing = m.HeartbeatLastPing.Time.Format(time.RFC3339)
+		}
+		return gin.H{
+			"type":         service.TypeHeartbeat,
+			"ping_url":     "/api/v1/heartbeat/" + m.HeartbeatToken,
+			"grace_period": m.HeartbeatGrace,
+			"last_ping":    lastPing,
+		}
+	case service.TypeDNS:
+		expected := m.DNSExpected
+		if expected == nil {
+			expected = []string{}
+		}
+		return gin.H{
+			"type":             service.TypeDNS,
+			"record_type":      m.DNSRecordType,
+			"resolver":         m.DNSResolver,
+			"expected_answers": expected,
+			"last_answer":      m.DNSPrevious,
+		}
+	case service.TypeTCP:
+		return gin.H{
+			"type":          service.TypeTCP,
+			"payload":       m.Payload,
+			"expect_banner": m.ExpectBanner,
+		}
+	}
+
+	method := m.Method
+	if method == "" {
+		method = "GET"
+	}
+	acceptedStatuses := m.AcceptedStatuses
+	if acceptedStatuses == "" {
+		acceptedStatuses = service.DefaultAcceptedStatuses
+	}
+	certExpiryDays := m.CertExpiryDays
+	if certExpiryDays == 0 {
+		certExpiryDays = service.DefaultCertExpiryDays
+	}
+	return gin.H{
+		"type":              service.TypeHTTP,
+		"content_rules":     m.ContentRules,
+		"max_body_bytes":    m.MaxBodyBytes,
+		"json_assertions":   m.JSONAssertions,
+		"method":            method,
+		"headers":           m.Headers,
+		"body":              m.Body,
+		"accepted_statuses": acceptedStatuses,
+		"cert_expiry_days":  certExpiryDays,
+	}
+}
+
+// certificateData is the stored certificate as returned by the API.
+func certificateData(cert *service.CertInfo) gin.H {
+	if cert == nil {
+		return nil
+	}
+	return gin.H{
+		"issuer":            cert.Issuer,
+		"subject":           cert.Subject,
+		"sans":              cert.SANs,
+		"not_after":         cert.NotAfter.Format(time.RFC3339),
+		"expiring_subject":  cert.ExpiringCert(),
+		"chain_valid":       cert.ChainValid,
+		"days_until_expiry": cert.DaysUntilExpiry(time.Now()),
+	}
+}
+
+// nullableID is the JSON value of an optional ID: the number or null.
+func nullableID(id sql.NullInt64) any {
+	if !id.Valid {
+		return nil
+	}
+	return id.Int64
+}
+
+// nullableInt stores 0 as NULL for optional integer columns.
+func nullableInt(v int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(v), Valid: v > 0}
 }
 
 // normalizeURL validates and normalizes the URL
@@ -56,84 +388,80 @@ func normalizeURL(rawURL string) (string, error) {
 	return parsedURL.String(), nil
 }
 
-// testURLAccessibility tests if the URL is accessible
-func testURLAccessibility(testURL string) (status string, responseTime int, responseCode int, errorMessage string) {
-	client := &http.Client{
-		Timeout: 15 * time.Second, // Increased timeout for better reliability
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Allow up to 10 redirects
-			if len(via) >= 10 {
-				return http.ErrUseLastResponse
-			}
-			return nil
-		},
+// normalizeMonitorURL validates the target according to the monitor type
+func normalizeMonitorURL(monitorType, rawURL string) (string, error) {
+	switch monitorType {
+	case service.TypeTCP:
+		return normalizeTCPAddress(rawURL)
+	case service.TypeDNS:
+		return normalizeDNSName(rawURL)
+	case service.TypeHeartbeat:
+		return "", fmt.Errorf("heartbeat monitors have no URL, they are pinged at their ping_url")
 	}
+	return normalizeURL(rawURL)
+}
 
-	// Create HEAD request first (lightweight)
-	request, err := http.NewRequest("HEAD", testURL, nil)
-	if err != nil {
-		return "error", 0, 0, fmt.Sprintf("Failed to create request: %v", err)
+// normalizeDNSName validates a hostname to resolve and returns it as dns://host
+func normalizeDNSName(rawName string) (string, error) {
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(rawName, "dns://"), "."))
+	if name == "" || len(name) > 253 || strings.ContainsAny(name, "/:@?# ") {
+		return "", fmt.Errorf("DNS monitors need a plain hostname such as example.com")
 	}
-
-	// Set realistic browser headers
-	setHTTPHeaders(request)
-
-	start := time.Now()
-	resp, err := client.Do(request)
-	responseTime = int(time.Since(start).Milliseconds())
-
-	if err != nil {
-		// Try GET request if HEAD fails (some servers don't support HEAD)
-		request, err = http.NewRequest("GET", testURL, nil)
-		if err != nil {
-			return "error", responseTime, 0, fmt.Sprintf("Failed to create GET request: %v", err)
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return "", fmt.Errorf("DNS monitors need a plain hostname such as example.com")
 		}
+	}
+	return "dns://" + name, nil
+}
 
-		setHTTPHeaders(request)
-
-		start = time.Now()
-		resp, err = client.Do(request)
-		responseTime = int(time.Since(start).Milliseconds())
-
-		if err != nil {
-			return "error", responseTime, 0, err.Error()
-		}
+// normalizeResolver defaults the resolver port to 53 and applies the same
+// private address rules as monitored hosts
+func normalizeResolver(addr string) (string, error) {
+	if addr == "" {
+		return "", nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = strings.Trim(addr, "[]"), "53"
 	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 || host == "" {
+		return "", fmt.Errorf("resolver must be host or host:port")
+	}
+	if isBlockedDomain(host) {
+		return "", fmt.Errorf("resolver is not allowed")
+	}
+	return net.JoinHostPort(host, port), nil
+}
 
-	defer resp.Body.Close()
-	responseCode = resp.StatusCode
+// normalizeTCPAddress validates host:port targets and returns them as tcp://host:port
+func normalizeTCPAddress(rawAddr string) (string, error) {
+	rawAddr = strings.TrimPrefix(rawAddr, "tcp://")
 
-	// Determine status based on response code
-	switch {
-	case responseCode >= 200 && responseCode < 300:
-		return "online", responseTime, responseCode, ""
-	case responseCode >= 300 && responseCode < 400:
-		return "online", responseTime, responseCode, "" // Redirects are OK
-	case responseCode >= 400 && responseCode < 500:
-		return "offline", responseTime, responseCode, fmt.Sprintf("Client error: %s", resp.Status)
-	case responseCode >= 500:
-		return "offline", responseTime, responseCode, fmt.Sprintf("Server error: %s", resp.Status)
-	default:
-		return "error", responseTime, responseCode, fmt.Sprintf("Unexpected response: %s", resp.Status)
+	host, port, err := net.SplitHostPort(rawAddr)
+	if err != nil {
+		return "", fmt.Errorf("TCP address must be host:port: %v", err)
+	}
+	if host == "" {
+		return "", fmt.Errorf("TCP address must have a valid host")
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return "", fmt.Errorf("TCP port must be between 1 and 65535")
 	}
-}
 
-// setHTTPHeaders sets realistic browser headers
-func setHTTPHeaders(request *http.Request) {
-	request.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	request.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
-	request.Header.Set("Accept-Language", "en-US,en;q=0.9")
-	request.Header.Set("Accept-Encoding", "gzip, deflate, br")
-	request.Header.Set("Connection", "keep-alive")
-	request.Header.Set("Upgrade-Insecure-Requests", "1")
-	request.Header.Set("Sec-Fetch-Dest", "document")
-	request.Header.Set("Sec-Fetch-Mode", "navigate")
-	request.Header.Set("Sec-Fetch-Site", "none")
-	request.Header.Set("DNT", "1")
+	if isBlockedDomain(host) {
+		return "", fmt.Errorf("domain is not allowed")
+	}
+	return "tcp://" + net.JoinHostPort(strings.ToLower(host), port), nil
 }
 
-// isBlockedDomain checks if a domain should be blocked (optional security measure)
+// isBlockedDomain checks if a domain should be blocked (optional security measure).
+// Self-hosted setups that watch internal services can set ALLOW_PRIVATE_TARGETS=true.
 func isBlockedDomain(host string) bool {
+	if os.Getenv("ALLOW_PRIVATE_TARGETS") == "true" {
+		return false
+	}
+
 	// Remove port if present
 	if colonIndex := strings.LastIndex(host, ":"); colonIndex != -1 {
 		host = host[:colonIndex]
@@ -191,7 +519,7 @@ func addUri(c *gin.Context) {
 		var validationErrors []string
 		for _, err := range err.(validator.ValidationErrors) {
 			switch err.Tag() {
-			case "required":
+			case "required", "required_unless":
 				validationErrors = append(validationErrors, fmt.Sprintf("%s is required", err.Field()))
 			case "min":
 				validationErrors = append(validationErrors, fmt.Sprintf("%s is too short (minimum %s characters)", err.Field(), err.Param()))
@@ -199,6 +527,8 @@ func addUri(c *gin.Context) {
 				validationErrors = append(validationErrors, fmt.Sprintf("%s is too long (maximum %s characters)", err.Field(), err.Param()))
 			case "url":
 				validationErrors = append(validationErrors, "Invalid URL format")
+			case "oneof":
+				validationErrors = append(validationErrors, fmt.Sprintf("%s must be one of: %s", err.Field(), err.Param()))
 			default:
 				validationErrors = append(validationErrors, fmt.Sprintf("%s is invalid", err.Field()))
 			}
@@ -222,33 +552,112 @@ func addUri(c *gin.Context) {
 		return
 	}
 
+	// Unverified accounts get a small allowance of personal monitors until
+	// they confirm their email; monitors they added to organizations don't count.
+	verified, err := utils.IsVerified(userID.(int))
+	if err == nil && !verified {
+		var count int
+		personal, ownerID := monitorOwner(userID, sql.NullInt64{})
+		if err = db.DB.QueryRow("SELECT COUNT(*) FROM urls WHERE "+personal, ownerID).Scan(&count); err == nil && count >= utils.UnverifiedMonitorLimit {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Email not verified",
+				"message": fmt.Sprintf("Verify your email address to add more than %d monitors", utils.UnverifiedMonitorLimit),
+				"success": false,
+			})
+			return
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to check monitor allowance",
+			"success": false,
+		})
+		return
+	}
+
+	orgID := sql.NullInt64{Int64: int64(req.OrganizationID), Valid: req.OrganizationID != 0}
+	if orgID.Valid && !checkOrganizationEditor(c, userID, req.OrganizationID) {
+		return
+	}
+
 	// Parse and validate URL before making a request
-	parsedURL, err := url.Parse(req.Url)
-	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+	if req.Type == "" || req.Type == service.TypeHTTP {
+		parsedURL, err := url.Parse(req.Url)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid URL format",
+				"message": "URL must be a valid HTTP or HTTPS URL",
+				"success": false,
+			})
+			return
+		}
+	}
+
+	// Normalize and validate URL. Heartbeats get a secret ping token instead,
+	// their url only holds a random public id so it never reveals the token.
+	var normalizedURL, heartbeatToken string
+	if req.Type == service.TypeHeartbeat {
+		var publicID string
+		heartbeatToken, err = utils.GenerateSessionToken()
+		if err == nil {
+			publicID, err = utils.GenerateSessionToken()
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Internal server error",
+				"message": "Failed to generate heartbeat token",
+				"success": false,
+			})
+			return
+		}
+		normalizedURL = "heartbeat://" + publicID[:12]
+	} else {
+		normalizedURL, err = normalizeMonitorURL(req.Type, req.Url)
+	}
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Invalid URL format",
-			"message": "URL must be a valid HTTP or HTTPS URL",
+			"message": err.Error(),
 			"success": false,
 		})
 		return
 	}
 
-	// Normalize and validate URL
-	normalizedURL, err := normalizeURL(req.Url)
-	if err != nil {
+	monitor := req.monitor(normalizedURL)
+	monitor.HeartbeatToken = heartbeatToken
+	if monitor.DNSResolver, err = normalizeResolver(monitor.DNSResolver); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid URL format",
+			"error":   "Validation failed",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := service.ValidateMonitor(monitor); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := checkChannelsOwned(userID, monitor.Channels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
 			"message": err.Error(),
 			"success": false,
 		})
 		return
 	}
 
-	// Check if URL already exists for this user
+	// Check if URL already exists for this user or organization. DNS monitors
+	// of one name may watch different record types.
 	var existingID int
+	owner, ownerID := monitorOwner(userID, orgID)
 	err = db.DB.QueryRow(
-		"SELECT id FROM urls WHERE user_id = ? AND url = ?",
-		userID, normalizedURL,
+		"SELECT id FROM urls WHERE "+owner+" AND url = ? AND (type <> 'dns' OR dns_record_type = ?)",
+		ownerID, normalizedURL, monitor.DNSRecordType,
 	).Scan(&existingID)
 
 	if err == nil {
@@ -267,13 +676,27 @@ func addUri(c *gin.Context) {
 		return
 	}
 
-	// Test URL accessibility
-	urlStatus, responseTime, responseCode, errorMessage := testURLAccessibility(normalizedURL)
+	// Run the same check the scheduler will run. A heartbeat's first window
+	// starts now, so it counts as online until that window is missed.
+	check := service.CheckResult{Status: "online"}
+	if monitor.MonitorType() != service.TypeHeartbeat {
+		check = service.CheckMonitor(monitor)
+	}
+
+	interval := req.Interval
+	if interval == "" {
+		interval = "6hr"
+	}
 
 	// Insert URL into database
+	args := append([]any{userID, orgID, normalizedURL, req.Name, interval, nullableInt(req.CustomInterval), check.Status, check.ResponseTime}, monitor.ConfigValues()...)
+	args = append(args, check.CertValues()...)
 	result, err := db.DB.Exec(
-		"INSERT INTO urls (user_id, url, name, status, response_time, last_checked) VALUES (?, ?, ?, ?, ?, NOW())",
-		userID, normalizedURL, req.Name, urlStatus, responseTime,
+		"INSERT INTO urls (user_id, organization_id, url, name, `interval`, custom_interval, status, response_time, last_checked, "+
+			strings.Join(service.ConfigColumns, ", ")+", "+strings.Join(service.CertColumns, ", ")+
+			") VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW()"+
+			strings.Repeat(", ?", len(service.ConfigColumns)+len(service.CertColumns))+")",
+		args...,
 	)
 
 	if err != nil {
@@ -287,29 +710,47 @@ func addUri(c *gin.Context) {
 
 	urlID, _ := result.LastInsertId()
 
-	// Log the first check
-	_, err = db.DB.Exec(
-		"INSERT INTO logs (url_id, status, response_time, response_code, error_message, checked_at) VALUES (?, ?, ?, ?, ?, NOW())",
-		urlID, urlStatus, responseTime, responseCode, errorMessage,
-	)
+	if check.DNSAnswer != nil {
+		if err := service.SaveDNSAnswer(db.DB, urlID, check.DNSAnswer); err != nil {
+			fmt.Printf("Warning: Failed to save DNS answer: %v\n", err)
+		}
+	}
 
-	if err != nil {
-		// Log error but don't fail the request since URL was created successfully
-		fmt.Printf("Warning: Failed to log initial URL check: %v\n", err)
+	// Log the first check. Heartbeat logs start with the first ping or missed window.
+	if monitor.MonitorType() != service.TypeHeartbeat {
+		if err := service.InsertLog(db.DB, urlID, check); err != nil {
+			// Log error but don't fail the request since URL was created successfully
+			fmt.Printf("Warning: Failed to log initial URL check: %v\n", err)
+		}
+	}
+
+	if err := service.ScheduleMonitor(int(urlID)); err != nil {
+		fmt.Printf("Warning: Failed to schedule URL %d: %v\n", urlID, err)
+	}
+
+	data := gin.H{
+		"id":              urlID,
+		"organization_id": nullableID(orgID),
+		"url":             normalizedURL,
+		"name":            req.Name,
+		"interval":        interval,
+		"custom_interval": req.CustomInterval,
+		"status":          check.Status,
+		"response_time":   check.ResponseTime,
+		"response_code":   check.ResponseCode,
+		"error_message":   check.ErrorMessage.String,
+		"timings":         check.Timings,
+		"certificate":     certificateData(check.Cert),
+	}
+	for k, v := range monitorConfig(monitor) {
+		data[k] = v
 	}
 
 	// Return success response
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "URL added successfully",
 		"success": true,
-		"data": gin.H{
-			"id":            urlID,
-			"url":           normalizedURL,
-			"name":          req.Name,
-			"status":        urlStatus,
-			"response_time": responseTime,
-			"response_code": responseCode,
-		},
+		"data":    data,
 	})
 }
 
@@ -336,10 +777,10 @@ func editUri(c *gin.Context) {
 	}
 
 	// Check if at least one field is provided
-	if req.Url == "" && req.Name == "" {
+	if req == (EditUriRequest{}) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Invalid request",
-			"message": "At least one field (URL or name) must be provided",
+			"message": "At least one field must be provided",
 			"success": false,
 		})
 		return
@@ -356,6 +797,8 @@ func editUri(c *gin.Context) {
 				validationErrors = append(validationErrors, fmt.Sprintf("%s is too long (maximum %s characters)", err.Field(), err.Param()))
 			case "url":
 				validationErrors = append(validationErrors, "Invalid URL format")
+			case "oneof":
+				validationErrors = append(validationErrors, fmt.Sprintf("%s must be one of: %s", err.Field(), err.Param()))
 			default:
 				validationErrors = append(validationErrors, fmt.Sprintf("%s is invalid", err.Field()))
 			}
@@ -378,13 +821,27 @@ func editUri(c *gin.Context) {
 		})
 		return
 	}
-	var existingURL, existingName, existingStatus string
+
+	// Moving a monitor between owners takes more than editing it.
+	minRole := utils.RoleEditor
+	if req.OrganizationID != nil {
+		minRole = utils.RoleAdmin
+	}
+	if !authorizeMonitor(c, userID, uriID, minRole) {
+		return
+	}
+
+	var existingURL, existingName, existingStatus, existingInterval string
 	var existingResponseTime, existingResponseCode int
+	var existingCustomInterval, existingOrgID sql.NullInt64
+	var existingOwner int
+	var existing service.MonitorRow
 
 	err := db.DB.QueryRow(
-		"SELECT url, name, status, response_time, 0 FROM urls WHERE id = ? AND user_id = ?",
-		uriID, userID,
-	).Scan(&existingURL, &existingName, &existingStatus, &existingResponseTime, &existingResponseCode)
+		"SELECT name, status, response_time, 0, `interval`, custom_interval, user_id, organization_id, "+service.MonitorColumns+" FROM urls WHERE id = ?",
+		uriID,
+	).Scan(append([]any{&existingName, &existingStatus, &existingResponseTime, &existingResponseCode,
+		&existingInterval, &existingCustomInterval, &existingOwner, &existingOrgID}, existing.Dest()...)...)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -402,18 +859,36 @@ func editUri(c *gin.Context) {
 		}
 		return
 	}
+	monitor := existing.Monitor()
+	existingURL = monitor.URL
+
 	// Variables to store the values we'll update
 	normalizedURL := existingURL
 	newName := existingName
 	status := existingStatus
 	responseTime := existingResponseTime
 	responseCode := existingResponseCode
-	var errorMessage string
+	var check service.CheckResult
+
+	urlChanged := req.Url != "" && req.Url != existingURL
+
+	// A monitor moved out of an organization becomes the mover's own.
+	newOwner, newOrgID := existingOwner, existingOrgID
+	if req.OrganizationID != nil {
+		newOrgID = sql.NullInt64{Int64: int64(*req.OrganizationID), Valid: *req.OrganizationID != 0}
+		if newOrgID.Valid && !checkOrganizationEditor(c, userID, *req.OrganizationID) {
+			return
+		}
+		if !newOrgID.Valid {
+			newOwner = userID.(int)
+		}
+	}
+	moved := newOrgID != existingOrgID || newOwner != existingOwner
 
 	// If URL is being updated, validate and normalize it
-	if req.Url != "" && req.Url != existingURL {
+	if urlChanged {
 		var err error
-		normalizedURL, err = normalizeURL(req.Url)
+		normalizedURL, err = normalizeMonitorURL(monitor.MonitorType(), req.Url)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error":   "Invalid URL format",
@@ -422,12 +897,15 @@ func editUri(c *gin.Context) {
 			})
 			return
 		}
+	}
 
-		// Check if the new URL already exists for this user
+	// Check if the URL already exists for the (new) owner
+	if urlChanged || moved {
 		var duplicateID int
+		owner, ownerID := monitorOwner(newOwner, newOrgID)
 		err = db.DB.QueryRow(
-			"SELECT id FROM urls WHERE user_id = ? AND url = ? AND id != ?",
-			userID, normalizedURL, uriID,
+			"SELECT id FROM urls WHERE "+owner+" AND url = ? AND (type <> 'dns' OR dns_record_type = ?) AND id != ?",
+			ownerID, normalizedURL, monitor.DNSRecordType, uriID,
 		).Scan(&duplicateID)
 
 		if err == nil {
@@ -445,15 +923,61 @@ func editUri(c *gin.Context) {
 			})
 			return
 		}
-
-		// Test the new URL's accessibility
-		status, responseTime, responseCode, errorMessage = testURLAccessibility(normalizedURL)
 	}
+	monitor.URL = normalizedURL
 
 	if req.Name != "" {
 		newName = req.Name
 	}
 
+	newInterval := existingInterval
+	if req.Interval != "" {
+		newInterval = req.Interval
+	}
+	newCustomInterval := existingCustomInterval
+	if req.CustomInterval != nil {
+		newCustomInterval = nullableInt(*req.CustomInterval)
+	}
+
+	configChanged := req.applyTo(&monitor)
+	if monitor.DNSResolver, err = normalizeResolver(monitor.DNSResolver); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := service.ValidateMonitor(monitor); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	// Alerts go to the channels of the monitor's owner, its creator on an
+	// organization monitor, so the selection must be theirs and is checked
+	// again when a move hands the monitor to someone else.
+	if req.Channels != nil || newOwner != existingOwner {
+		if err := checkChannelsOwned(newOwner, monitor.Channels); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"message": err.Error(),
+				"success": false,
+			})
+			return
+		}
+	}
+
+	// Re-run the check whenever something that affects its outcome changed.
+	// Heartbeats can't be checked, their new settings apply from the next window.
+	recheck := (urlChanged || configChanged) && monitor.MonitorType() != service.TypeHeartbeat
+	if recheck {
+		check = service.CheckMonitor(monitor)
+		status, responseTime, responseCode = check.Status, check.ResponseTime, check.ResponseCode
+	}
+
 	tx, err := db.DB.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -464,14 +988,19 @@ func editUri(c *gin.Context) {
 		return
 	}
 	var result sql.Result
-	if req.Url != "" && req.Url != existingURL {
+	if recheck {
+		args := append([]any{normalizedURL, newName, newInterval, newCustomInterval, newOwner, newOrgID, status, responseTime}, monitor.ConfigValues()...)
+		args = append(args, check.CertValues()...)
 		result, err = tx.Exec(
-			"UPDATE urls SET url = ?, name = ?, status = ?, response_time = ?, last_checked = NOW() WHERE id = ? AND user_id = ?",
-			normalizedURL, newName, status, responseTime, uriID, userID,
+			"UPDATE urls SET url = ?, name = ?, `interval` = ?, custom_interval = ?, user_id = ?, organization_id = ?, status = ?, response_time = ?, last_checked = NOW(), consecutive_failures = 0, "+
+				service.Assignments(service.ConfigColumns)+", "+service.Assignments(service.CertColumns)+" WHERE id = ?",
+			append(args, uriID)...,
 		)
 	} else {
+		args := append([]any{newName, newInterval, newCustomInterval, newOwner, newOrgID}, monitor.ConfigValues()...)
 		result, err = tx.Exec(
-			"UPDATE urls SET name=? WHERE id=? AND user_id=?", newName, uriID, userID,
+			"UPDATE urls SET name=?, `interval`=?, custom_interval=?, user_id=?, organization_id=?, "+service.Assignments(service.ConfigColumns)+" WHERE id=?",
+			append(args, uriID)...,
 		)
 	}
 
@@ -496,13 +1025,15 @@ func editUri(c *gin.Context) {
 		return
 	}
 
-	if req.Url != "" && req.Url != existingURL {
-		_, err := tx.Exec(
-			"INSERT INTO logs (url_id, status, response_time, response_code, error_message, checked_at) VALUES (?, ?, ?, ?, ?, NOW())",
-			uriID, status, responseTime, responseCode, errorMessage,
-		)
+	if recheck {
+		// Keep the previous answer on a failed lookup unless the question changed
+		if check.DNSAnswer != nil || (monitor.MonitorType() == service.TypeDNS && monitor.DNSPrevious == nil) {
+			if err := service.SaveDNSAnswer(tx, uriID, check.DNSAnswer); err != nil {
+				fmt.Printf("Warning: Failed to save DNS answer after edit: %v\n", err)
+			}
+		}
 
-		if err != nil {
+		if err := service.InsertLog(tx, uriID, check); err != nil {
 			// Log error but don't fail the request
 			fmt.Printf("Warning: Failed to log URL check after edit: %v\n", err)
 		}
@@ -518,18 +1049,37 @@ func editUri(c *gin.Context) {
 		return
 	}
 
+	if id, err := strconv.Atoi(uriID); err == nil {
+		if err := service.ScheduleMonitor(id); err != nil {
+			fmt.Printf("Warning: Failed to reschedule URL %d: %v\n", id, err)
+		}
+	}
+
+	data := gin.H{
+		"id":              uriID,
+		"organization_id": nullableID(newOrgID),
+		"url":             normalizedURL,
+		"name":            newName,
+		"interval":        newInterval,
+		"custom_interval": newCustomInterval.Int64,
+		"status":          status,
+		"response_time":   responseTime,
+		"response_code":   responseCode,
+	}
+	if recheck {
+		data["error_message"] = check.ErrorMessage.String
+		data["timings"] = check.Timings
+		data["certificate"] = certificateData(check.Cert)
+	}
+	for k, v := range monitorConfig(monitor) {
+		data[k] = v
+	}
+
 	// Return success response
 	c.JSON(http.StatusOK, gin.H{
 		"message": "URL updated successfully",
 		"success": true,
-		"data": gin.H{
-			"id":            uriID,
-			"url":           normalizedURL,
-			"name":          newName,
-			"status":        status,
-			"response_time": responseTime,
-			"response_code": responseCode,
-		},
+		"data":    data,
 	})
 }
 
@@ -559,9 +1109,21 @@ func getAllUri(c *gin.Context) {
 		}
 	}
 
+	// Personal monitors and those of the user's organizations, optionally
+	// only personal ones or one organization's.
+	where, args := utils.MonitorAccess, []any{userID, userID}
+	switch org := c.Query("organization_id"); org {
+	case "":
+	case "personal":
+		where += " AND urls.organization_id IS NULL"
+	default:
+		where += " AND urls.organization_id = ?"
+		args = append(args, org)
+	}
+
 	// Query to get total count
 	var totalCount int
-	err := db.DB.QueryRow("SELECT COUNT(*) FROM urls WHERE user_id = ?", userID).Scan(&totalCount)
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM urls WHERE "+where, args...).Scan(&totalCount)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Database error",
@@ -573,12 +1135,13 @@ func getAllUri(c *gin.Context) {
 
 	// Query to get URLs with pagination
 	rows, err := db.DB.Query(`
-        SELECT id, url, name, status, response_time, last_checked, created_at 
+        SELECT name, `+"`interval`"+`, custom_interval, status, response_time, last_checked, created_at, badge_token, organization_id, `+
+		strings.Join(service.CertColumns, ", ")+`, `+service.MonitorColumns+`
         FROM urls 
-        WHERE user_id = ? 
+        WHERE `+where+` 
         ORDER BY created_at DESC 
         LIMIT ? OFFSET ?
-    `, userID, limit, offset)
+    `, append(args, limit, offset)...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Database error",
@@ -593,16 +1156,21 @@ func getAllUri(c *gin.Context) {
 
 	for rows.Next() {
 		var (
-			id           int64
-			url          string
-			name         string
-			status       string
-			responseTime int
-			lastChecked  time.Time
-			createdAt    time.Time
+			name           string
+			interval       string
+			customInterval sql.NullInt64
+			status         string
+			responseTime   int
+			lastChecked    time.Time
+			createdAt      time.Time
+			badgeToken     sql.NullString
+			orgID          sql.NullInt64
+			cert           service.NullCert
+			row            service.MonitorRow
 		)
 
-		if err := rows.Scan(&id, &url, &name, &status, &responseTime, &lastChecked, &createdAt); err != nil {
+		dest := append([]any{&name, &interval, &customInterval, &status, &responseTime, &lastChecked, &createdAt, &badgeToken, &orgID}, cert.Dest()...)
+		if err := rows.Scan(append(dest, row.Dest()...)...); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Database error",
 				"message": "Failed to parse URL data",
@@ -610,42 +1178,61 @@ func getAllUri(c *gin.Context) {
 			})
 			return
 		}
+		monitor := row.Monitor()
+		id := monitor.ID
+
 		// Get the latest log entry for this URL
 		var (
 			latestStatus    string
 			latestResTime   int
 			latestResCode   int
 			latestCheckedAt time.Time
+			latestTimings   service.NullTimings
 		)
 
 		// Query to get the latest log entry
 		logErr := db.DB.QueryRow(`
-            SELECT status, response_time, response_code, checked_at 
+            SELECT status, response_time, response_code, checked_at,
+                dns_time, connect_time, tls_time, ttfb_time, download_time
             FROM logs 
             WHERE url_id = ? 
             ORDER BY checked_at DESC 
             LIMIT 1
-        `, id).Scan(&latestStatus, &latestResTime, &latestResCode, &latestCheckedAt)
+        `, id).Scan(append([]any{&latestStatus, &latestResTime, &latestResCode, &latestCheckedAt}, latestTimings.Dest()...)...)
 
 		// Add URL data to the slice
+		every := service.CheckInterval(interval, customInterval)
 		urlData := gin.H{
-			"id":            id,
-			"url":           url,
-			"name":          name,
-			"status":        status,
-			"response_time": responseTime,
-			"last_checked":  lastChecked.Format(time.RFC3339),
-			"created_at":    createdAt.Format(time.RFC3339),
+			"id":              id,
+			"organization_id": nullableID(orgID),
+			"url":             monitor.URL,
+			"name":            name,
+			"interval":        interval,
+			"custom_interval": customInterval.Int64,
+			"status":          status,
+			"response_time":   responseTime,
+			"last_checked":    lastChecked.Format(time.RFC3339),
+			"next_check":      lastChecked.Add(every).Format(time.RFC3339),
+			"created_at":      createdAt.Format(time.RFC3339),
+			"certificate":     certificateData(cert.Get()),
+			"badges":          badgeURLs(badgeToken),
+		}
+		for k, v := range monitorConfig(monitor) {
+			urlData[k] = v
 		}
 
 		// Add latest log data if available
 		if logErr == nil {
-			urlData["latest_check"] = gin.H{
+			latestCheck := gin.H{
 				"status":        latestStatus,
 				"response_time": latestResTime,
 				"response_code": latestResCode,
 				"checked_at":    latestCheckedAt.Format(time.RFC3339),
 			}
+			if timings, ok := latestTimings.Get(); ok {
+				latestCheck["timings"] = timings
+			}
+			urlData["latest_check"] = latestCheck
 		}
 
 		urls = append(urls, urlData)
@@ -701,6 +1288,10 @@ func deleteUri(c *gin.Context) {
 		return
 	}
 
+	if !authorizeMonitor(c, userID, uriID, utils.RoleEditor) {
+		return
+	}
+
 	// Start a transaction
 	tx, err := db.DB.Begin()
 	if err != nil {
@@ -712,13 +1303,12 @@ func deleteUri(c *gin.Context) {
 		return
 	}
 
-	// First, verify the URL exists and belongs to the user
+	// First, verify the URL still exists
 	var urlName string
-	var logCount int
 
 	err = tx.QueryRow(
-		"SELECT name FROM urls WHERE id = ? AND user_id = ?",
-		uriID, userID,
+		"SELECT name FROM urls WHERE id = ?",
+		uriID,
 	).Scan(&urlName)
 
 	if err != nil {
@@ -739,20 +1329,8 @@ func deleteUri(c *gin.Context) {
 		return
 	}
 
-	// Count how many logs will be deleted
-	err = tx.QueryRow("SELECT COUNT(*) FROM logs WHERE url_id = ?", uriID).Scan(&logCount)
-	if err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Database error",
-			"message": "Failed to count logs",
-			"success": false,
-		})
-		return
-	}
-
 	// Delete the URI (logs will be deleted via ON DELETE CASCADE)
-	result, err := tx.Exec("DELETE FROM urls WHERE id = ? AND user_id = ?", uriID, userID)
+	result, err := tx.Exec("DELETE FROM urls WHERE id = ?", uriID)
 	if err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -784,14 +1362,17 @@ func deleteUri(c *gin.Context) {
 		return
 	}
 
+	if id, err := strconv.Atoi(uriID); err == nil {
+		service.UnscheduleMonitor(id)
+	}
+
 	// Return success response with information about deleted items
 	c.JSON(http.StatusOK, gin.H{
 		"message": "URL and all associated logs deleted successfully",
 		"success": true,
 		"data": gin.H{
-			"url_id":     uriID,
-			"url_name":   urlName,
-			"logs_count": logCount,
+			"url_id":   uriID,
+			"url_name": urlName,
 		},
 	})
 }
@@ -805,5 +1386,8 @@ func InitUriRouter(rg *gin.RouterGroup) {
 		router.GET("/", getAllUri)
 		router.PUT("/:id", editUri)
 		router.DELETE("/:id", deleteUri)
+		router.GET("/:id/stats", getUriStats)
+		router.POST("/:id/badge", enableBadge)
+		router.DELETE("/:id/badge", disableBadge)
 	}
 }
@@ -1,9 +1,12 @@
 package routes
 
 import (
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	db "github.com/MrPurushotam/web-visitor/config"
 	"github.com/MrPurushotam/web-visitor/middleware"
@@ -15,22 +18,43 @@ import (
 
 var validate *validator.Validate
 
+// Requests per client IP to the password reset and two-factor login endpoints.
+const (
+	authRateLimit  = 10
+	authRateWindow = 15 * time.Minute
+)
+
 type CreateUserRequest struct {
 	Name     string `json:"name" validate:"required,min=3,max=50"`
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=8"`
 }
 
+type VerifyUserRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
 type LoginUserRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 }
 
 type User struct {
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	Verified  bool   `json:"verified"`
+	TwoFactor bool   `json:"two_factor_enabled"` // login asks for a TOTP code after the password
 }
 
 func getUserDetails(c *gin.Context) {
@@ -45,8 +69,8 @@ func getUserDetails(c *gin.Context) {
 	}
 
 	var user User
-	query := "SELECT id, name, email FROM users WHERE id = ?"
-	err := db.DB.QueryRow(query, userID).Scan(&user.ID, &user.Name, &user.Email)
+	query := "SELECT id, name, email, COALESCE(verified, FALSE), totp_enabled FROM users WHERE id = ?"
+	err := db.DB.QueryRow(query, userID).Scan(&user.ID, &user.Name, &user.Email, &user.Verified, &user.TwoFactor)
 	if err != nil {
 		log.Printf("Error fetching user details: %v", err)
 		c.JSON(http.StatusNotFound, gin.H{
@@ -60,9 +84,11 @@ func getUserDetails(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"user": gin.H{
-			"id":    user.ID,
-			"name":  user.Name,
-			"email": user.Email,
+			"id":                 user.ID,
+			"name":               user.Name,
+			"email":              user.Email,
+			"verified":           user.Verified,
+			"two_factor_enabled": user.TwoFactor,
 		},
 	})
 
@@ -138,7 +164,7 @@ func createUser(c *gin.Context) {
 	}
 
 	query = "INSERT INTO users(name,email,password) VALUES(?,?,?)"
-	_, err = db.DB.Exec(query, req.Name, req.Email, string(hashedPassword))
+	result, err := db.DB.Exec(query, req.Name, req.Email, string(hashedPassword))
 	if err != nil {
 		log.Printf("Error creating user: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -148,10 +174,13 @@ func createUser(c *gin.Context) {
 		})
 		return
 	}
-	newUser := gin.H{"name": req.Name, "email": req.Email}
+	if id, err := result.LastInsertId(); err == nil {
+		go sendVerification(int(id))
+	}
+	newUser := gin.H{"name": req.Name, "email": req.Email, "verified": false}
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
-		"message": "User created",
+		"message": "User created, check your email to verify your account",
 		"user":    newUser,
 	})
 }
@@ -188,9 +217,9 @@ func userLogin(c *gin.Context) {
 	}
 
 	var user User
-	query := "SELECT id,name,email,password FROM users WHERE email = ? "
+	query := "SELECT id,name,email,password,COALESCE(verified, FALSE),totp_enabled FROM users WHERE email = ? "
 
-	err := db.DB.QueryRow(query, req.Email).Scan(&user.ID, &user.Name, &user.Email, &user.Password)
+	err := db.DB.QueryRow(query, req.Email).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Verified, &user.TwoFactor)
 	if err != nil {
 		log.Printf("User doesn't exist: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -210,8 +239,34 @@ func userLogin(c *gin.Context) {
 		return
 	}
 
-	// Create session
-	token, err := utils.CreateSession(user.ID)
+	// With two-factor on, the password only earns a challenge for the second step.
+	if user.TwoFactor {
+		challenge, err := utils.CreateLoginChallenge(user.ID)
+		if err != nil {
+			log.Printf("Error creating login challenge: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Internal server error",
+				"message": "Failed to create session",
+				"success": false,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success":             true,
+			"message":             "Enter the code from your authenticator app",
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int(utils.LoginChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	startSession(c, user)
+}
+
+// startSession creates the session of a logged in user and sets its cookie.
+func startSession(c *gin.Context, user User) {
+	token, err := utils.CreateSession(user.ID, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		log.Printf("Error creating session: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -226,9 +281,11 @@ func userLogin(c *gin.Context) {
 	c.SetCookie("session_token", token, 60*60*1000, "/", "", false, true)
 
 	userData := gin.H{
-		"id":    user.ID,
-		"name":  user.Name,
-		"email": user.Email,
+		"id":                 user.ID,
+		"name":               user.Name,
+		"email":              user.Email,
+		"verified":           user.Verified,
+		"two_factor_enabled": user.TwoFactor,
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -239,25 +296,17 @@ func userLogin(c *gin.Context) {
 }
 
 func logoutUser(c *gin.Context) {
-	token := c.GetHeader("Authorization")
-	if token == "" {
-		cookie, err := c.Cookie("session_token")
-		if err == nil {
-			token = cookie
-		}
-	}
+	userID, _ := c.Get("userId")
+	sessionID, _ := c.Get("sessionId")
 
-	if token != "" {
-		// This should handle removing the token from auth_token table
-		if err := utils.InvalidateSession(token); err != nil {
-			log.Printf("Error invalidating session: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Internal server error",
-				"message": "Error logging out",
-				"success": false,
-			})
-			return
-		}
+	if _, err := utils.RevokeSession(userID.(int), sessionID.(int)); err != nil {
+		log.Printf("Error invalidating session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal server error",
+			"message": "Error logging out",
+			"success": false,
+		})
+		return
 	}
 
 	// Clear cookie
@@ -270,20 +319,194 @@ func logoutUser(c *gin.Context) {
 
 }
 
+// sendVerification runs in the background so slow SMTP servers, and whether
+// an email was sent at all, don't show in response times.
+func sendVerification(userID int) {
+	err := utils.SendVerification(userID)
+	switch {
+	case err == nil:
+		log.Printf("Sent verification email to user %d", userID)
+	case errors.Is(err, utils.ErrAlreadyVerified), errors.Is(err, utils.ErrVerificationThrottled):
+		log.Printf("Skipped verification email to user %d: %v", userID, err)
+	default:
+		log.Printf("Error sending verification email to user %d: %v", userID, err)
+	}
+}
+
+// verifyUser accepts the token from the emailed link, either as ?token= when
+// the link is opened or as JSON from a frontend.
 func verifyUser(c *gin.Context) {
-	// Implement user verification logic here
+	req := VerifyUserRequest{Token: c.Query("token")}
+	if req.Token == "" && c.Request.Method == http.MethodPost {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"message": err.Error(),
+				"success": false,
+			})
+			return
+		}
+	}
+	if err := validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"message": "Token is required",
+			"success": false,
+		})
+		return
+	}
+
+	_, err := utils.VerifyEmail(req.Token)
+	if errors.Is(err, utils.ErrTokenInvalid) || errors.Is(err, utils.ErrTokenExpired) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid token",
+			"message": err.Error() + ", request a new one",
+			"success": false,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal server error",
+			"message": "Failed to verify email",
+			"success": false,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Verification endpoint",
+		"message": "Email verified",
 	})
 }
 
+// resendVerification answers the same whether or not the address belongs to
+// an unverified account, so it can't be used to probe for accounts.
 func resendVerification(c *gin.Context) {
-	email := c.Param("email")
-	// Implement resend verification logic here
+	email := strings.TrimSpace(c.Param("email"))
+	if err := validate.Var(email, "required,email"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"message": "Invalid email format",
+			"success": false,
+		})
+		return
+	}
+
+	var userID int
+	err := db.DB.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
+	if err == nil {
+		go sendVerification(userID)
+	} else if err != sql.ErrNoRows {
+		log.Printf("Error looking up user for verification: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Verification email sent to " + email,
+		"message": "If " + email + " belongs to an unverified account, a verification email is on its way. Emails can be requested once every 2 minutes.",
+	})
+}
+
+// forgotPassword answers the same for every well-formed address and sends
+// in the background, so neither the response nor its timing reveals whether
+// an account exists.
+func forgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"message": "Invalid email format",
+			"success": false,
+		})
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	go func() {
+		if err := utils.SendPasswordReset(email); err != nil {
+			log.Printf("Error sending password reset email: %v", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "If " + email + " belongs to an account, a password reset link is on its way.",
+	})
+}
+
+// resetPassword sets a new password with an emailed token and signs the
+// user out everywhere.
+func resetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		var validationErrors []string
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Tag() {
+			case "required":
+				validationErrors = append(validationErrors, err.Field()+" is required")
+			case "min":
+				validationErrors = append(validationErrors, err.Field()+" is too short")
+			}
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"message": strings.Join(validationErrors, ", "),
+			"success": false,
+		})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal server error",
+			"message": "Error processing password",
+			"success": false,
+		})
+		return
+	}
+
+	_, err = utils.ResetPassword(req.Token, string(hashedPassword))
+	if errors.Is(err, utils.ErrTokenInvalid) || errors.Is(err, utils.ErrTokenExpired) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid token",
+			"message": err.Error() + ", request a new one",
+			"success": false,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error resetting password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal server error",
+			"message": "Failed to reset password",
+			"success": false,
+		})
+		return
+	}
+
+	c.SetCookie("session_token", "", -1, "/", "", false, true)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Password changed, log in with the new password",
 	})
 }
 
@@ -295,14 +518,32 @@ func InitUserRouter(rg *gin.RouterGroup) {
 	// Public routes
 	router.POST("/create/", createUser)
 	router.POST("/login/", userLogin)
+	router.GET("/verify/", verifyUser)
 	router.POST("/verify/", verifyUser)
 	router.POST("/resend/:email", resendVerification)
 
+	// Limited per IP on top of the per-account throttle, so the endpoints
+	// can't be used to probe addresses or guess tokens in bulk.
+	password := router.Group("/password")
+	password.Use(middleware.RateLimit(authRateLimit, authRateWindow))
+	{
+		password.POST("/forgot", forgotPassword)
+		password.POST("/reset", resetPassword)
+	}
+	router.POST("/login/2fa", middleware.RateLimit(authRateLimit, authRateWindow), loginTwoFactor)
+
 	// protected routes
 	protected := router.Group("/") // Creates a sub-group within "/user"
 	protected.Use(middleware.AuthMiddleware()) // Applies auth middleware only to this sub-group
 	{
 		protected.GET("/", getUserDetails)      
 		protected.POST("/logout/", logoutUser)
+		protected.GET("/sessions", getSessions)
+		protected.DELETE("/sessions", revokeAllSessions)
+		protected.DELETE("/sessions/:id", revokeSession)
+		protected.POST("/2fa/setup", setupTwoFactor)
+		protected.POST("/2fa/confirm", confirmTwoFactor)
+		protected.POST("/2fa/disable", disableTwoFactor)
+		protected.POST("/2fa/recovery-codes", regenerateRecoveryCodes)
 	}
 }
@@ -0,0 +1,595 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+	"github.com/MrPurushotam/web-visitor/middleware"
+	"github.com/MrPurushotam/web-visitor/service"
+	"github.com/MrPurushotam/web-visitor/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// maxWebhooksPerUser keeps one transition from fanning out into too many deliveries.
+const maxWebhooksPerUser = 10
+
+type CreateWebhookRequest struct {
+	Url         string `json:"url" validate:"required,min=5,max=500"`
+	Description string `json:"description" validate:"omitempty,max=255"`
+	// Secret signs the deliveries; one is generated when it is left out.
+	Secret string `json:"secret" validate:"omitempty,min=16,max=255"`
+}
+
+type EditWebhookRequest struct {
+	Url         string  `json:"url" validate:"omitempty,min=5,max=500"`
+	Description *string `json:"description" validate:"omitempty,max=255"`
+	IsActive    *bool   `json:"is_active"`
+	// RotateSecret replaces the secret with a newly generated one.
+	RotateSecret bool `json:"rotate_secret"`
+}
+
+// validationFailed renders validator errors the way the uri handlers do.
+func validationFailed(c *gin.Context, err error) {
+	var validationErrors []string
+	for _, err := range err.(validator.ValidationErrors) {
+		switch err.Tag() {
+		case "required", "required_if", "required_unless":
+			validationErrors = append(validationErrors, fmt.Sprintf("%s is required", err.Field()))
+		case "oneof":
+			validationErrors = append(validationErrors, fmt.Sprintf("%s must be one of: %s", err.Field(), err.Param()))
+		case "min":
+			validationErrors = append(validationErrors, fmt.Sprintf("%s is too short (minimum %s characters)", err.Field(), err.Param()))
+		case "max":
+			validationErrors = append(validationErrors, fmt.Sprintf("%s is too long (maximum %s characters)", err.Field(), err.Param()))
+		default:
+			validationErrors = append(validationErrors, fmt.Sprintf("%s is invalid", err.Field()))
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   "Validation failed",
+		"message": strings.Join(validationErrors, ", "),
+		"success": false,
+	})
+}
+
+// loadWebhook reads a webhook of the authenticated user, writing the error
+// response itself when it can't.
+func loadWebhook(c *gin.Context, userID any) (service.Webhook, bool) {
+	var w service.Webhook
+	err := db.DB.QueryRow(
+		"SELECT id, url, secret FROM webhooks WHERE id = ? AND user_id = ?", c.Param("id"), userID,
+	).Scan(&w.ID, &w.URL, &w.Secret)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Webhook not found",
+			"message": "The webhook doesn't exist or doesn't belong to you",
+			"success": false,
+		})
+		return w, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve webhook",
+			"success": false,
+		})
+		return w, false
+	}
+	return w, true
+}
+
+func createWebhook(c *gin.Context) {
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	// Webhooks are called from the server, so they follow the same host rules as monitors.
+	normalizedURL, err := normalizeURL(req.Url)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid URL format",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+
+	var count int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM webhooks WHERE user_id = ?", userID).Scan(&count); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to count webhooks",
+			"success": false,
+		})
+		return
+	}
+	if count >= maxWebhooksPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Limit reached",
+			"message": fmt.Sprintf("You can have at most %d webhooks", maxWebhooksPerUser),
+			"success": false,
+		})
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = utils.GenerateSessionToken(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Internal server error",
+				"message": "Failed to generate webhook secret",
+				"success": false,
+			})
+			return
+		}
+	}
+
+	result, err := db.DB.Exec(
+		"INSERT INTO webhooks (user_id, url, description, secret) VALUES (?, ?, ?, ?)",
+		userID, normalizedURL, sql.NullString{String: req.Description, Valid: req.Description != ""}, secret,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to save webhook",
+			"success": false,
+		})
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	// The secret is only returned here and when it is rotated.
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Webhook created successfully",
+		"success": true,
+		"data": gin.H{
+			"id":          id,
+			"url":         normalizedURL,
+			"description": req.Description,
+			"is_active":   true,
+			"secret":      secret,
+		},
+	})
+}
+
+func getAllWebhooks(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	// The latest delivery tells the user at a glance whether the endpoint works.
+	rows, err := db.DB.Query(`
+        SELECT w.id, w.url, w.description, w.is_active, w.created_at,
+            d.event, d.status_code, d.success, d.created_at
+        FROM webhooks w
+        LEFT JOIN webhook_deliveries d ON d.id = (
+            SELECT MAX(id) FROM webhook_deliveries WHERE webhook_id = w.id
+        )
+        WHERE w.user_id = ?
+        ORDER BY w.created_at DESC
+    `, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve webhooks",
+			"success": false,
+		})
+		return
+	}
+	defer rows.Close()
+
+	webhooks := []gin.H{}
+	for rows.Next() {
+		var (
+			id             int
+			url            string
+			description    sql.NullString
+			isActive       bool
+			createdAt      time.Time
+			lastEvent      sql.NullString
+			lastStatusCode sql.NullInt64
+			lastSuccess    sql.NullBool
+			lastAt         sql.NullTime
+		)
+		if err := rows.Scan(&id, &url, &description, &isActive, &createdAt,
+			&lastEvent, &lastStatusCode, &lastSuccess, &lastAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Database error",
+				"message": "Failed to parse webhook data",
+				"success": false,
+			})
+			return
+		}
+
+		webhook := gin.H{
+			"id":          id,
+			"url":         url,
+			"description": description.String,
+			"is_active":   isActive,
+			"created_at":  createdAt.Format(time.RFC3339),
+		}
+		if lastEvent.Valid {
+			webhook["last_delivery"] = gin.H{
+				"event":       lastEvent.String,
+				"status_code": lastStatusCode.Int64,
+				"success":     lastSuccess.Bool,
+				"created_at":  lastAt.Time.Format(time.RFC3339),
+			}
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Error iterating through webhooks",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Webhooks retrieved successfully",
+		"data":    gin.H{"webhooks": webhooks},
+	})
+}
+
+func editWebhook(c *gin.Context) {
+	var req EditWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if req == (EditWebhookRequest{}) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": "At least one field must be provided",
+			"success": false,
+		})
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		validationFailed(c, err)
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	webhook, ok := loadWebhook(c, userID)
+	if !ok {
+		return
+	}
+
+	var (
+		assignments []string
+		args        []any
+		err         error
+	)
+	if req.Url != "" {
+		normalizedURL, err := normalizeURL(req.Url)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid URL format",
+				"message": err.Error(),
+				"success": false,
+			})
+			return
+		}
+		assignments = append(assignments, "url = ?")
+		args = append(args, normalizedURL)
+	}
+	if req.Description != nil {
+		assignments = append(assignments, "description = ?")
+		args = append(args, sql.NullString{String: *req.Description, Valid: *req.Description != ""})
+	}
+	if req.IsActive != nil {
+		assignments = append(assignments, "is_active = ?")
+		args = append(args, *req.IsActive)
+	}
+	var secret string
+	if req.RotateSecret {
+		if secret, err = utils.GenerateSessionToken(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Internal server error",
+				"message": "Failed to generate webhook secret",
+				"success": false,
+			})
+			return
+		}
+		assignments = append(assignments, "secret = ?")
+		args = append(args, secret)
+	}
+
+	_, err = db.DB.Exec(
+		"UPDATE webhooks SET "+strings.Join(assignments, ", ")+" WHERE id = ? AND user_id = ?",
+		append(args, webhook.ID, userID)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to update webhook",
+			"success": false,
+		})
+		return
+	}
+
+	var (
+		url         string
+		description sql.NullString
+		isActive    bool
+	)
+	err = db.DB.QueryRow("SELECT url, description, is_active FROM webhooks WHERE id = ?", webhook.ID).
+		Scan(&url, &description, &isActive)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve webhook",
+			"success": false,
+		})
+		return
+	}
+
+	data := gin.H{
+		"id":          webhook.ID,
+		"url":         url,
+		"description": description.String,
+		"is_active":   isActive,
+	}
+	if secret != "" {
+		data["secret"] = secret
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook updated successfully",
+		"success": true,
+		"data":    data,
+	})
+}
+
+func deleteWebhook(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+
+	// Deliveries are deleted via ON DELETE CASCADE
+	result, err := db.DB.Exec("DELETE FROM webhooks WHERE id = ? AND user_id = ?", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to delete webhook",
+			"success": false,
+		})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Webhook not found",
+			"message": "The webhook doesn't exist or doesn't belong to you",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook and its delivery log deleted successfully",
+		"success": true,
+		"data":    gin.H{"webhook_id": c.Param("id")},
+	})
+}
+
+func getWebhookDeliveries(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	webhook, ok := loadWebhook(c, userID)
+	if !ok {
+		return
+	}
+
+	// Handle pagination
+	limit := 10 // Default limit
+	offset := 0 // Default offset
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	if pageParam := c.Query("page"); pageParam != "" {
+		if parsedPage, err := strconv.Atoi(pageParam); err == nil && parsedPage > 0 {
+			offset = (parsedPage - 1) * limit
+		}
+	}
+
+	var totalCount int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id = ?", webhook.ID).Scan(&totalCount); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to get total delivery count",
+			"success": false,
+		})
+		return
+	}
+
+	rows, err := db.DB.Query(`
+        SELECT id, delivery_id, event, payload, attempt, status_code, response_body, error_message, duration, success, created_at
+        FROM webhook_deliveries
+        WHERE webhook_id = ?
+        ORDER BY id DESC
+        LIMIT ? OFFSET ?
+    `, webhook.ID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Failed to retrieve deliveries",
+			"success": false,
+		})
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []gin.H{}
+	for rows.Next() {
+		var (
+			id           int64
+			deliveryID   string
+			event        string
+			payload      sql.NullString
+			attempt      int
+			statusCode   sql.NullInt64
+			responseBody sql.NullString
+			errorMessage sql.NullString
+			duration     int
+			success      bool
+			createdAt    time.Time
+		)
+		if err := rows.Scan(&id, &deliveryID, &event, &payload, &attempt, &statusCode,
+			&responseBody, &errorMessage, &duration, &success, &createdAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Database error",
+				"message": "Failed to parse delivery data",
+				"success": false,
+			})
+			return
+		}
+		deliveries = append(deliveries, gin.H{
+			"id":            id,
+			"delivery_id":   deliveryID,
+			"event":         event,
+			"payload":       payload.String,
+			"attempt":       attempt,
+			"status_code":   statusCode.Int64,
+			"response_body": responseBody.String,
+			"error_message": errorMessage.String,
+			"duration":      duration,
+			"success":       success,
+			"created_at":    createdAt.Format(time.RFC3339),
+		})
+	}
+	if err = rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Database error",
+			"message": "Error iterating through deliveries",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Deliveries retrieved successfully",
+		"data": gin.H{
+			"deliveries": deliveries,
+			"pagination": gin.H{
+				"total":  totalCount,
+				"limit":  limit,
+				"offset": offset,
+				"pages":  (totalCount + limit - 1) / limit,
+			},
+		},
+	})
+}
+
+// testWebhook sends a single test event and reports how the receiver answered.
+// It isn't retried so the caller gets the result right away.
+func testWebhook(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+			"success": false,
+		})
+		return
+	}
+	webhook, ok := loadWebhook(c, userID)
+	if !ok {
+		return
+	}
+
+	d := service.DeliverWebhook(webhook, service.TestWebhookPayload(), 1)
+	message := "Test event delivered"
+	if !d.Success {
+		message = "Test event delivery failed"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"success": true,
+		"data": gin.H{
+			"delivered":     d.Success,
+			"status_code":   d.StatusCode,
+			"response_body": d.Response,
+			"error_message": d.ErrorMessage,
+			"duration":      d.Duration,
+		},
+	})
+}
+
+func InitWebhookRouter(rg *gin.RouterGroup) {
+	router := rg.Group("/webhooks")
+	router.Use(middleware.AuthMiddleware())
+
+	{
+		router.POST("/", createWebhook)
+		router.GET("/", getAllWebhooks)
+		router.PUT("/:id", editWebhook)
+		router.DELETE("/:id", deleteWebhook)
+		router.GET("/:id/deliveries", getWebhookDeliveries)
+		router.POST("/:id/test", testWebhook)
+	}
+}
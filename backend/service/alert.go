@@ -0,0 +1,212 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	htmltemplate "html/template"
+	"log"
+	"text/template"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+	"github.com/MrPurushotam/web-visitor/utils"
+)
+
+// Alert describes a monitor going down or coming back up.
+type Alert struct {
+	MonitorID    int
+	Name         string
+	URL          string
+	From         string
+	To           string
+	ResponseCode int
+	ErrorMessage string
+	// DownSince is when the monitor went down; Downtime is only set on recovery.
+	DownSince time.Time
+	Downtime  time.Duration
+	At        time.Time
+	// Repeat marks a reminder about an incident nobody acknowledged yet.
+	Repeat bool
+	// UserID, Email and UserName belong to the owner of the monitor.
+	UserID   int
+	Email    string
+	UserName string
+	verified bool
+}
+
+// Recovered reports whether the alert is for a monitor coming back up.
+func (a Alert) Recovered() bool {
+	return !isDown(a.To)
+}
+
+// isDown reports whether a status counts as an outage. Warnings are still up.
+func isDown(status string) bool {
+	return status == "offline" || status == "error"
+}
+
+// notifyTransition alerts the owner by email, webhooks and the monitor's chat
+// channels when a confirmed status change crosses between up and down.
+// Changes within one side, such as offline to error or online to warning,
+// don't alert. down_since tracks the start of the outage.
+func notifyTransition(id int, from string, res CheckResult) {
+	if res.Unconfirmed || isDown(from) == isDown(res.Status) {
+		return
+	}
+	a, downSince, ok := loadAlert(id, from, res)
+	if !ok {
+		return
+	}
+
+	var err error
+	if a.Recovered() {
+		if downSince.Valid {
+			a.DownSince = downSince.Time
+			a.Downtime = a.At.Sub(downSince.Time).Round(time.Second)
+		}
+		_, err = db.DB.Exec("UPDATE urls SET down_since = NULL WHERE id = ?", id)
+	} else {
+		a.DownSince = a.At
+		_, err = db.DB.Exec("UPDATE urls SET down_since = ? WHERE id = ?", a.At, id)
+	}
+	if err != nil {
+		log.Printf("[Monitor %d] Error updating down_since: %v", id, err)
+	}
+	sendAlert(a)
+}
+
+// remindIncident alerts again about a monitor that is still down.
+func remindIncident(id int, status string, res CheckResult) {
+	a, downSince, ok := loadAlert(id, status, res)
+	if !ok {
+		return
+	}
+	a.Repeat = true
+	if downSince.Valid {
+		a.DownSince = downSince.Time
+	}
+	sendAlert(a)
+}
+
+// loadAlert fills in the monitor and owner of an alert.
+func loadAlert(id int, from string, res CheckResult) (Alert, sql.NullTime, bool) {
+	a := Alert{
+		MonitorID:    id,
+		From:         from,
+		To:           res.Status,
+		ResponseCode: res.ResponseCode,
+		ErrorMessage: res.ErrorMessage.String,
+		At:           time.Now(),
+	}
+	var (
+		name      sql.NullString
+		downSince sql.NullTime
+		verified  sql.NullBool
+	)
+	err := db.DB.QueryRow(
+		"SELECT u.name, u.url, u.down_since, us.id, us.email, us.name, us.verified FROM urls u JOIN users us ON us.id = u.user_id WHERE u.id = ?", id,
+	).Scan(&name, &a.URL, &downSince, &a.UserID, &a.Email, &a.UserName, &verified)
+	if err != nil {
+		log.Printf("[Monitor %d] Error loading alert recipient: %v", id, err)
+		return a, downSince, false
+	}
+	a.verified = verified.Bool
+	a.Name = name.String
+	if a.Name == "" {
+		a.Name = a.URL
+	}
+	return a, downSince, true
+}
+
+// sendAlert fans an alert out to every destination. Sending can take a while
+// on a slow SMTP server or a retried delivery, so it doesn't hold up the worker.
+func sendAlert(a Alert) {
+	// Alerts only go out once the owner proved the email address is theirs.
+	if !a.verified {
+		log.Printf("[Monitor %d] Owner %d hasn't verified their email, skipping %s alert", a.MonitorID, a.UserID, a.To)
+		return
+	}
+	go sendAlertEmail(a)
+	go dispatchWebhooks(a)
+	go dispatchChannels(a)
+}
+
+func sendAlertEmail(a Alert) {
+	if !utils.MailConfigured() {
+		log.Printf("[Monitor %d] SMTP_HOST not set, skipping %s alert email", a.MonitorID, a.To)
+		return
+	}
+	mail, err := renderAlertEmail(a)
+	if err != nil {
+		log.Printf("[Monitor %d] Error rendering alert email: %v", a.MonitorID, err)
+		return
+	}
+	if err := utils.SendMail(mail); err != nil {
+		log.Printf("[Monitor %d] Error sending alert email to %s: %v", a.MonitorID, a.Email, err)
+		return
+	}
+	log.Printf("[Monitor %d] Sent %s alert email to %s", a.MonitorID, a.To, a.Email)
+}
+
+const alertTextTemplate = `Hi {{.UserName}},
+
+{{if .Recovered}}{{.Name}} is back {{.To}}{{if .Downtime}} after {{.Downtime}} of downtime{{end}}.{{else}}{{.Name}} is {{if .Repeat}}still {{end}}down ({{.To}}).{{end}}
+
+URL:           {{.URL}}
+Status:        {{.From}} -> {{.To}}
+{{- if .ResponseCode}}
+Response code: {{.ResponseCode}}{{end}}
+{{- if .ErrorMessage}}
+Error:         {{.ErrorMessage}}{{end}}
+{{- if not .DownSince.IsZero}}
+Down since:    {{.DownSince.UTC.Format "2006-01-02 15:04:05 MST"}}{{end}}
+{{- if .Recovered}}
+Recovered at:  {{.At.UTC.Format "2006-01-02 15:04:05 MST"}}{{end}}
+
+-- Web Visitor
+`
+
+const alertHTMLTemplate = `<!DOCTYPE html>
+<html><body style="font-family: sans-serif; color: #222;">
+<p>Hi {{.UserName}},</p>
+{{if .Recovered}}<p style="color: #1a7f37;"><strong>{{.Name}}</strong> is back {{.To}}{{if .Downtime}} after {{.Downtime}} of downtime{{end}}.</p>
+{{else}}<p style="color: #cf222e;"><strong>{{.Name}}</strong> is {{if .Repeat}}still {{end}}down ({{.To}}).</p>
+{{end}}<table cellpadding="4">
+<tr><td>URL</td><td>{{.URL}}</td></tr>
+<tr><td>Status</td><td>{{.From}} &rarr; {{.To}}</td></tr>
+{{if .ResponseCode}}<tr><td>Response code</td><td>{{.ResponseCode}}</td></tr>
+{{end}}{{if .ErrorMessage}}<tr><td>Error</td><td>{{.ErrorMessage}}</td></tr>
+{{end}}{{if not .DownSince.IsZero}}<tr><td>Down since</td><td>{{.DownSince.UTC.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{end}}{{if .Recovered}}<tr><td>Recovered at</td><td>{{.At.UTC.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{end}}</table>
+<p>&mdash; Web Visitor</p>
+</body></html>
+`
+
+var (
+	alertText = template.Must(template.New("alert").Parse(alertTextTemplate))
+	alertHTML = htmltemplate.Must(htmltemplate.New("alert").Parse(alertHTMLTemplate))
+)
+
+// renderAlertEmail builds the plaintext and HTML versions of an alert.
+func renderAlertEmail(a Alert) (utils.Mail, error) {
+	var text, html bytes.Buffer
+	if err := alertText.Execute(&text, a); err != nil {
+		return utils.Mail{}, err
+	}
+	if err := alertHTML.Execute(&html, a); err != nil {
+		return utils.Mail{}, err
+	}
+
+	subject := "[Down] " + a.Name + " is down (" + a.To + ")"
+	if a.Repeat {
+		subject = "[Still down] " + a.Name + " is still down (" + a.To + ")"
+	} else if a.Recovered() {
+		subject = "[Up] " + a.Name + " is back " + a.To
+	}
+	return utils.Mail{
+		To:      a.Email,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpSink is a local SMTP server without TLS or auth that keeps every
+// message it accepts.
+type smtpSink struct {
+	addr     net.Addr
+	mu       sync.Mutex
+	messages []string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &smtpSink{addr: ln.Addr()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	io.WriteString(conn, "220 sink ready\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch verb := strings.ToUpper(strings.Fields(line + " x")[0]); verb {
+		case "EHLO", "HELO":
+			io.WriteString(conn, "250 sink\r\n")
+		case "DATA":
+			io.WriteString(conn, "354 go ahead\r\n")
+			var msg strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				msg.WriteString(strings.TrimPrefix(line, "."))
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, msg.String())
+			s.mu.Unlock()
+			io.WriteString(conn, "250 queued\r\n")
+		case "QUIT":
+			io.WriteString(conn, "221 bye\r\n")
+			return
+		default:
+			io.WriteString(conn, "250 ok\r\n")
+		}
+	}
+}
+
+func (s *smtpSink) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.messages...)
+}
+
+// useSMTPSink points the SMTP settings at a new sink.
+func useSMTPSink(t *testing.T) *smtpSink {
+	s := newSMTPSink(t)
+	host, port, _ := net.SplitHostPort(s.addr.String())
+	t.Setenv("SMTP_HOST", host)
+	t.Setenv("SMTP_PORT", port)
+	t.Setenv("SMTP_TLS", "none")
+	t.Setenv("SMTP_USERNAME", "")
+	t.Setenv("SMTP_FROM", "Web Visitor <alerts@example.com>")
+	return s
+}
+
+// readAlertEmail parses a received message into its subject and the decoded
+// bodies by content type.
+func readAlertEmail(t *testing.T, raw string) (subject string, parts map[string]string) {
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type = %q (%v), want multipart/alternative", msg.Header.Get("Content-Type"), err)
+	}
+	parts = map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enc := part.Header.Get("Content-Transfer-Encoding"); enc != "quoted-printable" {
+			t.Errorf("part is encoded as %q, want quoted-printable", enc)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(body)
+	}
+	return subject, parts
+}
+
+func TestSendAlertEmail(t *testing.T) {
+	sink := useSMTPSink(t)
+
+	down := downAlert()
+	down.Email = "owner@example.com"
+	down.UserName = "Jane"
+
+	recovered := down
+	recovered.From, recovered.To = "offline", "online"
+	recovered.ResponseCode = 200
+	recovered.ErrorMessage = ""
+	recovered.Downtime = 5 * time.Minute
+	recovered.At = down.At.Add(5 * time.Minute)
+
+	tests := []struct {
+		name    string
+		alert   Alert
+		subject string
+		text    string
+		html    string
+	}{
+		{"down", down, "[Down] Shop <prod> is down (offline)",
+			"Shop <prod> is down (offline).", "<strong>Shop &lt;prod&gt;</strong> is down (offline)."},
+		{"recovery", recovered, "[Up] Shop <prod> is back online",
+			"Shop <prod> is back online after 5m0s of downtime.", "Recovered at</td><td>2024-05-01 12:05:00 UTC"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sendAlertEmail(tt.alert)
+			messages := sink.received()
+			if len(messages) != i+1 {
+				t.Fatalf("sink has %d messages, want %d", len(messages), i+1)
+			}
+			subject, parts := readAlertEmail(t, messages[i])
+			if subject != tt.subject {
+				t.Errorf("subject = %q, want %q", subject, tt.subject)
+			}
+			if len(parts) != 2 {
+				t.Fatalf("got parts %v, want text and HTML", parts)
+			}
+			if !strings.Contains(parts["text/plain"], "Hi Jane,") || !strings.Contains(parts["text/plain"], tt.text) {
+				t.Errorf("text part doesn't contain %q:\n%s", tt.text, parts["text/plain"])
+			}
+			if !strings.Contains(parts["text/html"], tt.html) {
+				t.Errorf("HTML part doesn't contain %q:\n%s", tt.html, parts["text/html"])
+			}
+		})
+	}
+}
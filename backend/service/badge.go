@@ -0,0 +1,226 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+// DefaultBadgeWindow is used by uptime and response time badges without ?window.
+const DefaultBadgeWindow = "30d"
+
+// MaxBadgeWindow is the longest window a badge aggregates logs over.
+const MaxBadgeWindow = 90 * 24 * time.Hour
+
+// Shields.io palette.
+const (
+	BadgeBrightGreen = "#4c1"
+	BadgeGreen       = "#97ca00"
+	BadgeYellowGreen = "#a4a61d"
+	BadgeYellow      = "#dfb317"
+	BadgeOrange      = "#fe7d37"
+	BadgeRed         = "#e05d44"
+	BadgeGrey        = "#9f9f9f"
+)
+
+// BadgeMonitor is what a badge token unlocks of a monitor.
+type BadgeMonitor struct {
+	ID           int
+	Name         string
+	Status       string
+	ResponseTime int
+}
+
+// LoadBadgeMonitor finds the monitor behind a badge token.
+func LoadBadgeMonitor(token string) (BadgeMonitor, error) {
+	var (
+		m    BadgeMonitor
+		name sql.NullString
+	)
+	err := db.DB.QueryRow(
+		"SELECT id, name, status, response_time FROM urls WHERE badge_token = ?", token,
+	).Scan(&m.ID, &name, &m.Status, &m.ResponseTime)
+	m.Name = name.String
+	return m, err
+}
+
+// ParseBadgeWindow reads windows such as "24h", "7d" or "30d".
+func ParseBadgeWindow(raw string) (time.Duration, error) {
+	if raw == "" {
+		raw = DefaultBadgeWindow
+	}
+	if len(raw) < 2 {
+		return 0, fmt.Errorf("window must look like 24h or 30d")
+	}
+	n, err := strconv.Atoi(raw[:len(raw)-1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("window must look like 24h or 30d")
+	}
+	var window time.Duration
+	switch raw[len(raw)-1] {
+	case 'h':
+		window = time.Duration(n) * time.Hour
+	case 'd':
+		window = time.Duration(n) * 24 * time.Hour
+	default:
+		return 0, fmt.Errorf("window must look like 24h or 30d")
+	}
+	if window > MaxBadgeWindow {
+		return 0, fmt.Errorf("window can be at most 90d")
+	}
+	return window, nil
+}
+
+// windowTotals counts the checks of a monitor since a point in time, with
+// the number and sum of response times of the successful ones. Hourly
+// rollups cover what they still keep, daily rollups longer windows.
+func windowTotals(urlID int, since time.Time) (checks, failures, samples int, timeSum float64, err error) {
+	now := time.Now().UTC()
+	since = since.UTC()
+	level := HourlyRollup
+	if since.Before(now.AddDate(0, 0, -RetentionFor(TierFree).Hourly)) {
+		level = DailyRollup
+	}
+	rollFrom, rollTo, err := rollupSpan(level, since, now)
+	if err != nil {
+		return
+	}
+	var rolledChecks, rolledFailures, rolledSamples int
+	var rolledSum float64
+	err = db.DB.QueryRow(
+		"SELECT COALESCE(SUM(checks), 0), COALESCE(SUM(failures), 0), COALESCE(SUM(samples), 0), COALESCE(SUM(avg_time * samples), 0) "+
+			"FROM "+level.Table+" WHERE url_id = ? AND bucket_start >= ? AND bucket_start < ?",
+		urlID, rollFrom, rollTo,
+	).Scan(&rolledChecks, &rolledFailures, &rolledSamples, &rolledSum)
+	if err != nil {
+		return
+	}
+	err = db.DB.QueryRow(
+		"SELECT COUNT(*), COALESCE(SUM(CASE WHEN confirmed AND status IN ('offline', 'error') THEN 1 ELSE 0 END), 0), "+
+			"COALESCE(SUM(CASE WHEN status IN ('offline', 'error') THEN 0 ELSE 1 END), 0), "+
+			"COALESCE(SUM(CASE WHEN status IN ('offline', 'error') THEN 0 ELSE response_time END), 0) "+
+			"FROM logs WHERE url_id = ? AND checked_at >= ? AND NOT (checked_at >= ? AND checked_at < ?)",
+		urlID, since, rollFrom, rollTo,
+	).Scan(&checks, &failures, &samples, &timeSum)
+	return checks + rolledChecks, failures + rolledFailures, samples + rolledSamples, timeSum + rolledSum, err
+}
+
+// WindowUptime is the uptime percentage of a monitor since a point in time,
+// counted like the status page bars. It is nil without checks.
+func WindowUptime(urlID int, since time.Time) (*float64, error) {
+	checks, failures, _, _, err := windowTotals(urlID, since)
+	if err != nil {
+		return nil, err
+	}
+	return uptimePercent(checks, failures), nil
+}
+
+// AverageResponseTime averages the successful checks of a monitor since a
+// point in time. ok is false without any.
+func AverageResponseTime(urlID int, since time.Time) (avg int, ok bool, err error) {
+	_, _, samples, sum, err := windowTotals(urlID, since)
+	if err != nil || samples == 0 {
+		return 0, false, err
+	}
+	return int(sum/float64(samples) + 0.5), true, nil
+}
+
+// StatusBadgeMessage returns the message and color of a status badge.
+func StatusBadgeMessage(status string) (string, string) {
+	switch status {
+	case "online":
+		return "up", BadgeBrightGreen
+	case "warning":
+		return "degraded", BadgeYellow
+	case "offline":
+		return "down", BadgeRed
+	case "error":
+		return "error", BadgeRed
+	}
+	return "unknown", BadgeGrey
+}
+
+// UptimeBadgeColor grades an uptime percentage.
+func UptimeBadgeColor(pct float64) string {
+	switch {
+	case pct >= 99.9:
+		return BadgeBrightGreen
+	case pct >= 99:
+		return BadgeGreen
+	case pct >= 97:
+		return BadgeYellowGreen
+	case pct >= 95:
+		return BadgeYellow
+	case pct >= 90:
+		return BadgeOrange
+	}
+	return BadgeRed
+}
+
+// ResponseTimeBadgeColor grades an average response time in milliseconds.
+func ResponseTimeBadgeColor(ms int) string {
+	switch {
+	case ms < 300:
+		return BadgeBrightGreen
+	case ms < 800:
+		return BadgeGreen
+	case ms < 1500:
+		return BadgeYellow
+	case ms < 3000:
+		return BadgeOrange
+	}
+	return BadgeRed
+}
+
+// FormatUptime drops trailing zeros, e.g. 100%, 99.9% or 99.982%.
+func FormatUptime(pct float64) string {
+	return strconv.FormatFloat(pct, 'f', -1, 64) + "%"
+}
+
+// textWidth approximates the width of text in 11px Verdana, the font
+// shields.io badges use, close enough to size the two halves.
+func textWidth(text string) int {
+	width := 0.0
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune("il.,:;|!'`", r):
+			width += 3.5
+		case strings.ContainsRune("fjrtI()[] ", r):
+			width += 4.5
+		case strings.ContainsRune("mwMW%", r):
+			width += 10.5
+		case r >= 'A' && r <= 'Z':
+			width += 7.5
+		default:
+			width += 6.8
+		}
+	}
+	return int(width + 0.5)
+}
+
+const badgeTemplate = `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[2]s: %[3]s">` +
+	`<title>%[2]s: %[3]s</title>` +
+	`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` +
+	`<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>` +
+	`<g clip-path="url(#r)"><rect width="%[4]d" height="20" fill="#555"/><rect x="%[4]d" width="%[5]d" height="20" fill="%[6]s"/>` +
+	`<rect width="%[1]d" height="20" fill="url(#s)"/></g>` +
+	`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">` +
+	`<text x="%[7]d" y="15" fill="#010101" fill-opacity=".3">%[2]s</text><text x="%[7]d" y="14">%[2]s</text>` +
+	`<text x="%[8]d" y="15" fill="#010101" fill-opacity=".3">%[3]s</text><text x="%[8]d" y="14">%[3]s</text></g></svg>`
+
+// RenderBadge draws a flat shields.io style badge.
+func RenderBadge(label, message, color string) []byte {
+	labelWidth := textWidth(label) + 10
+	messageWidth := textWidth(message) + 10
+	return []byte(fmt.Sprintf(badgeTemplate,
+		labelWidth+messageWidth,
+		html.EscapeString(label), html.EscapeString(message),
+		labelWidth, messageWidth, html.EscapeString(color),
+		labelWidth/2, labelWidth+messageWidth/2,
+	))
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// DefaultCertExpiryDays is the warning threshold used when a monitor doesn't set its own.
+const DefaultCertExpiryDays = 14
+
+// CertInfo describes the leaf certificate presented on an HTTPS check.
+// NotAfter is the earliest expiry in the whole chain, ExpiringSubject names
+// the certificate it belongs to.
+type CertInfo struct {
+	Issuer          string    `json:"issuer"`
+	Subject         string    `json:"subject"`
+	SANs            []string  `json:"sans"`
+	NotAfter        time.Time `json:"not_after"`
+	ExpiringSubject string    `json:"expiring_subject"`
+	ChainValid      bool      `json:"chain_valid"`
+	// ChainError explains why the chain failed verification; it's only known
+	// for the check that saw it and is not stored on the url.
+	ChainError string `json:"chain_error,omitempty"`
+}
+
+// DaysUntilExpiry rounds down, so a certificate expiring later today is 0 and
+// an expired one is negative.
+func (c *CertInfo) DaysUntilExpiry(now time.Time) int {
+	return int(math.Floor(c.NotAfter.Sub(now).Hours() / 24))
+}
+
+// ExpiringCert names the certificate that expires first, pointing out when
+// it's an intermediate or root rather than the leaf.
+func (c *CertInfo) ExpiringCert() string {
+	if c.ExpiringSubject == "" || c.ExpiringSubject == c.Subject {
+		return c.Subject
+	}
+	return fmt.Sprintf("%s (in the chain of %s)", c.ExpiringSubject, c.Subject)
+}
+
+// certFromChain describes the leaf, chain[0], and takes the expiry of
+// whichever certificate in the chain runs out first.
+func certFromChain(chain []*x509.Certificate) *CertInfo {
+	leaf := chain[0]
+	sans := append([]string{}, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	cert := &CertInfo{
+		Issuer:          leaf.Issuer.String(),
+		Subject:         leaf.Subject.String(),
+		SANs:            sans,
+		NotAfter:        leaf.NotAfter,
+		ExpiringSubject: leaf.Subject.String(),
+	}
+	for _, c := range chain[1:] {
+		if c.NotAfter.Before(cert.NotAfter) {
+			cert.NotAfter = c.NotAfter
+			cert.ExpiringSubject = c.Subject.String()
+		}
+	}
+	return cert
+}
+
+// certFromState reads the chain of a completed handshake. The transport
+// already verified it, otherwise the request would have failed, so the
+// verified chain up to the trusted root is used when there is one.
+func certFromState(state *tls.ConnectionState) *CertInfo {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+		chain = state.VerifiedChains[0]
+	}
+	cert := certFromChain(chain)
+	cert.ChainValid = true
+	return cert
+}
+
+// certFromError recovers the presented chain from a failed verification.
+func certFromError(err error) *CertInfo {
+	var verr *tls.CertificateVerificationError
+	if !errors.As(err, &verr) || len(verr.UnverifiedCertificates) == 0 {
+		return nil
+	}
+	cert := certFromChain(verr.UnverifiedCertificates)
+	cert.ChainError = verr.Err.Error()
+	return cert
+}
+
+// certProblem describes an invalid chain in terms of the certificate itself
+// rather than the raw x509 error.
+func certProblem(cert *CertInfo, now time.Time) string {
+	if now.After(cert.NotAfter) {
+		return fmt.Sprintf("Certificate for %s expired on %s (issuer %s)",
+			cert.ExpiringCert(), cert.NotAfter.UTC().Format("2006-01-02"), cert.Issuer)
+	}
+	return fmt.Sprintf("Certificate chain invalid for %s (issuer %s): %s", cert.Subject, cert.Issuer, cert.ChainError)
+}
+
+// CertColumns are the urls columns holding the last seen certificate, in the
+// order returned by CertValues and scanned by NullCert.Dest.
+var CertColumns = []string{"cert_issuer", "cert_subject", "cert_sans", "cert_not_after", "cert_chain_valid", "cert_expiring_subject"}
+
+// CertValues returns the column values matching CertColumns. A nil cert
+// (plain HTTP, TCP, or no handshake) clears them.
+func (r CheckResult) CertValues() []any {
+	c := r.Cert
+	if c == nil {
+		return []any{nil, nil, nil, nil, nil, nil}
+	}
+	sans, _ := json.Marshal(c.SANs)
+	return []any{truncate(c.Issuer, 252), truncate(c.Subject, 252), string(sans), c.NotAfter.UTC(), c.ChainValid, truncate(c.ExpiringSubject, 252)}
+}
+
+// NullCert scans the CertColumns of a url.
+type NullCert struct {
+	issuer, subject, sans sql.NullString
+	notAfter              sql.NullTime
+	chainValid            sql.NullBool
+	expiringSubject       sql.NullString
+}
+
+// Dest returns scan targets in CertColumns order.
+func (n *NullCert) Dest() []any {
+	return []any{&n.issuer, &n.subject, &n.sans, &n.notAfter, &n.chainValid, &n.expiringSubject}
+}
+
+// Get returns the certificate, or nil if none was recorded.
+func (n *NullCert) Get() *CertInfo {
+	if !n.notAfter.Valid {
+		return nil
+	}
+	cert := &CertInfo{
+		Issuer:          n.issuer.String,
+		Subject:         n.subject.String,
+		NotAfter:        n.notAfter.Time,
+		ExpiringSubject: n.expiringSubject.String,
+		ChainValid:      n.chainValid.Bool,
+	}
+	if n.sans.Valid {
+		json.Unmarshal([]byte(n.sans.String), &cert.SANs)
+	}
+	return cert
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+// Notification channel types.
+const (
+	ChannelSlack    = "slack"
+	ChannelDiscord  = "discord"
+	ChannelTeams    = "teams"
+	ChannelTelegram = "telegram"
+)
+
+// ChannelTypes lists the supported channel types.
+var ChannelTypes = []string{ChannelSlack, ChannelDiscord, ChannelTeams, ChannelTelegram}
+
+// MaxMonitorChannels caps how many channels a single monitor notifies.
+const MaxMonitorChannels = 10
+
+// DefaultTelegramAPIURL is used unless TELEGRAM_API_URL points somewhere else,
+// e.g. a local stand-in during tests.
+const DefaultTelegramAPIURL = "https://api.telegram.org"
+
+// Channel is a chat destination of one user. URL is the incoming webhook URL
+// for slack, discord and teams; telegram channels use the bot Token and ChatID.
+type Channel struct {
+	ID     int
+	Type   string
+	Name   string
+	URL    string
+	Token  string
+	ChatID string
+}
+
+// Accent colors of down and up messages.
+const (
+	colorDown = 0xcf222e
+	colorUp   = 0x1a7f37
+)
+
+func alertColor(a Alert) int {
+	if a.Recovered() {
+		return colorUp
+	}
+	return colorDown
+}
+
+// alertHeadline is the one line summary shown by every chat format.
+func alertHeadline(a Alert) string {
+	if a.Recovered() {
+		if a.Downtime > 0 {
+			return fmt.Sprintf("%s is back %s after %s of downtime", a.Name, a.To, a.Downtime)
+		}
+		return fmt.Sprintf("%s is back %s", a.Name, a.To)
+	}
+	if a.Repeat {
+		return fmt.Sprintf("%s is still down (%s)", a.Name, a.To)
+	}
+	return fmt.Sprintf("%s is down (%s)", a.Name, a.To)
+}
+
+type alertField struct{ name, value string }
+
+// alertFields are the details listed below the headline.
+func alertFields(a Alert) []alertField {
+	fields := []alertField{
+		{"URL", a.URL},
+		{"Status", a.From + " → " + a.To},
+	}
+	if a.ResponseCode > 0 {
+		fields = append(fields, alertField{"Response code", fmt.Sprint(a.ResponseCode)})
+	}
+	if a.ErrorMessage != "" {
+		fields = append(fields, alertField{"Error", a.ErrorMessage})
+	}
+	if !a.DownSince.IsZero() {
+		fields = append(fields, alertField{"Down since", a.DownSince.UTC().Format("2006-01-02 15:04:05 MST")})
+	}
+	return fields
+}
+
+// slackMessage renders the alert as Block Kit blocks.
+func slackMessage(a Alert) any {
+	var lines []string
+	for _, f := range alertFields(a) {
+		lines = append(lines, fmt.Sprintf("*%s:* %s", f.name, f.value))
+	}
+	icon := ":red_circle:"
+	if a.Recovered() {
+		icon = ":large_green_circle:"
+	}
+	headline := alertHeadline(a)
+	return map[string]any{
+		"text": headline,
+		"blocks": []any{
+			map[string]any{
+				"type": "section",
+				"text": map[string]any{"type": "mrkdwn", "text": icon + " *" + headline + "*"},
+			},
+			map[string]any{
+				"type": "section",
+				"text": map[string]any{"type": "mrkdwn", "text": strings.Join(lines, "\n")},
+			},
+			map[string]any{
+				"type": "context",
+				"elements": []any{
+					map[string]any{"type": "mrkdwn", "text": "Web Visitor · " + a.At.UTC().Format(time.RFC1123)},
+				},
+			},
+		},
+	}
+}
+
+// discordMessage renders the alert as an embed.
+func discordMessage(a Alert) any {
+	var fields []any
+	for _, f := range alertFields(a) {
+		fields = append(fields, map[string]any{"name": f.name, "value": f.value, "inline": f.name != "Error"})
+	}
+	return map[string]any{
+		"embeds": []any{
+			map[string]any{
+				"title":     alertHeadline(a),
+				"url":       webURL(a.URL),
+				"color":     alertColor(a),
+				"fields":    fields,
+				"timestamp": a.At.UTC().Format(time.RFC3339),
+				"footer":    map[string]any{"text": "Web Visitor"},
+			},
+		},
+	}
+}
+
+// teamsMessage renders the alert as a legacy MessageCard.
+func teamsMessage(a Alert) any {
+	var facts []any
+	for _, f := range alertFields(a) {
+		facts = append(facts, map[string]any{"name": f.name, "value": f.value})
+	}
+	return map[string]any{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    alertHeadline(a),
+		"themeColor": fmt.Sprintf("%06x", alertColor(a)),
+		"title":      alertHeadline(a),
+		"sections": []any{
+			map[string]any{"facts": facts, "markdown": false},
+		},
+	}
+}
+
+// telegramMessage renders the alert as a sendMessage request in HTML parse mode.
+func telegramMessage(a Alert, chatID string) any {
+	var b strings.Builder
+	b.WriteString("<b>" + html.EscapeString(alertHeadline(a)) + "</b>\n")
+	for _, f := range alertFields(a) {
+		fmt.Fprintf(&b, "\n<b>%s:</b> %s", html.EscapeString(f.name), html.EscapeString(f.value))
+	}
+	return map[string]any{
+		"chat_id":                  chatID,
+		"text":                     b.String(),
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	}
+}
+
+// webURL returns the monitored URL if it can be opened in a browser.
+func webURL(target string) string {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		return target
+	}
+	return ""
+}
+
+func telegramAPIURL() string {
+	if base := os.Getenv("TELEGRAM_API_URL"); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	return DefaultTelegramAPIURL
+}
+
+// channelRequest returns where to post an alert for ch and the JSON body.
+func channelRequest(ch Channel, a Alert) (string, any, error) {
+	switch ch.Type {
+	case ChannelSlack:
+		return ch.URL, slackMessage(a), nil
+	case ChannelDiscord:
+		return ch.URL, discordMessage(a), nil
+	case ChannelTeams:
+		return ch.URL, teamsMessage(a), nil
+	case ChannelTelegram:
+		return telegramAPIURL() + "/bot" + ch.Token + "/sendMessage", telegramMessage(a, ch.ChatID), nil
+	}
+	return "", nil, fmt.Errorf("unknown channel type %q", ch.Type)
+}
+
+// SendChannel posts an alert to a chat channel, retrying failures with the
+// same backoff as webhooks up to maxAttempts times. It returns the last attempt.
+func SendChannel(ch Channel, a Alert, maxAttempts int) WebhookDelivery {
+	target, message, err := channelRequest(ch, a)
+	if err != nil {
+		return WebhookDelivery{ErrorMessage: err.Error()}
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return WebhookDelivery{ErrorMessage: err.Error()}
+	}
+
+	var d WebhookDelivery
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		d = postChannel(target, body)
+		d.Attempt = attempt
+		if d.Success || !retryable(d) || attempt == maxAttempts {
+			break
+		}
+		delay := WebhookBackoff << (attempt - 1)
+		log.Printf("[Channel %d] %s attempt %d failed (%s), retrying in %s", ch.ID, ch.Type, attempt, d.summary(), delay)
+		time.Sleep(delay)
+	}
+	if !d.Success {
+		log.Printf("[Channel %d] %s message failed after %d attempts: %s", ch.ID, ch.Type, d.Attempt, d.summary())
+	}
+	return d
+}
+
+func postChannel(target string, body []byte) (d WebhookDelivery) {
+	start := time.Now()
+	resp, err := webhookClient.Post(target, "application/json", bytes.NewReader(body))
+	d.Duration = int(time.Since(start).Milliseconds())
+	if err != nil {
+		// Drop the URL from the error, for telegram it holds the bot token.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		d.ErrorMessage = err.Error()
+		return
+	}
+	defer resp.Body.Close()
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponse))
+	d.StatusCode = resp.StatusCode
+	d.Response = string(reply)
+	d.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !d.Success {
+		d.ErrorMessage = fmt.Sprintf("Unexpected status %s", resp.Status)
+	}
+	return
+}
+
+// dispatchChannels sends an alert to the channels selected on its monitor.
+func dispatchChannels(a Alert) {
+	var raw sql.NullString
+	if err := db.DB.QueryRow("SELECT notification_channels FROM urls WHERE id = ?", a.MonitorID).Scan(&raw); err != nil {
+		log.Printf("[Monitor %d] Error loading notification channels: %v", a.MonitorID, err)
+		return
+	}
+	ids := DecodeChannelIDs(raw)
+	if len(ids) == 0 {
+		return
+	}
+
+	args := []any{a.UserID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := db.DB.Query(
+		"SELECT id, type, name, url, token, chat_id FROM notification_channels WHERE user_id = ? AND is_active = TRUE AND id IN (?"+
+			strings.Repeat(", ?", len(ids)-1)+")",
+		args...,
+	)
+	if err != nil {
+		log.Printf("[Monitor %d] Error loading notification channels: %v", a.MonitorID, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		ch, err := ScanChannel(rows)
+		if err != nil {
+			log.Printf("[Monitor %d] Error scanning notification channel: %v", a.MonitorID, err)
+			continue
+		}
+		go SendChannel(ch, a, WebhookMaxAttempts)
+	}
+}
+
+// ScanChannel reads a row of "id, type, name, url, token, chat_id".
+func ScanChannel(row interface{ Scan(...any) error }) (Channel, error) {
+	var (
+		ch                      Channel
+		webhookURL, token, chat sql.NullString
+	)
+	err := row.Scan(&ch.ID, &ch.Type, &ch.Name, &webhookURL, &token, &chat)
+	ch.URL, ch.Token, ch.ChatID = webhookURL.String, token.String, chat.String
+	return ch, err
+}
+
+// TestAlert is sent by the "send test message" endpoint.
+func TestAlert() Alert {
+	now := time.Now()
+	return Alert{
+		Name:         "Web Visitor test",
+		URL:          "https://example.com",
+		From:         "online",
+		To:           "offline",
+		ErrorMessage: "This is a test message, your channel is set up correctly",
+		DownSince:    now,
+		At:           now,
+	}
+}
+
+// EncodeChannelIDs stores the channel selection of a monitor, NULL when empty.
+func EncodeChannelIDs(ids []int) sql.NullString {
+	if len(ids) == 0 {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// DecodeChannelIDs parses a notification_channels column.
+func DecodeChannelIDs(raw sql.NullString) []int {
+	if !raw.Valid || raw.String == "" {
+		return nil
+	}
+	var ids []int
+	if err := json.Unmarshal([]byte(raw.String), &ids); err != nil {
+		return nil
+	}
+	return ids
+}
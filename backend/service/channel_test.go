@@ -0,0 +1,172 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// chatReceiver stands in for a chat service. It answers with the given
+// statuses in turn, repeating the last one, and keeps every request.
+type chatReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	paths    []string
+	bodies   []map[string]any
+}
+
+func newChatReceiver(t *testing.T, statuses ...int) *chatReceiver {
+	r := &chatReceiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		raw, _ := io.ReadAll(req.Body)
+		var body map[string]any
+		if err := json.Unmarshal(raw, &body); err != nil {
+			t.Errorf("request body is not JSON: %v", err)
+		}
+		r.mu.Lock()
+		r.paths = append(r.paths, req.URL.Path)
+		r.bodies = append(r.bodies, body)
+		status := r.statuses[min(len(r.paths), len(r.statuses))-1]
+		r.mu.Unlock()
+		w.WriteHeader(status)
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *chatReceiver) requests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.paths)
+}
+
+func downAlert() Alert {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return Alert{
+		MonitorID:    7,
+		Name:         "Shop <prod>",
+		URL:          "https://shop.example.com",
+		From:         "online",
+		To:           "offline",
+		ResponseCode: 503,
+		ErrorMessage: "Unexpected status 503 Service Unavailable",
+		DownSince:    at,
+		At:           at,
+	}
+}
+
+func TestSendChannelFormats(t *testing.T) {
+	headline := "Shop <prod> is down (offline)"
+	tests := []struct {
+		channelType string
+		check       func(t *testing.T, body map[string]any)
+	}{
+		{ChannelSlack, func(t *testing.T, body map[string]any) {
+			if body["text"] != headline {
+				t.Errorf("text = %v, want %q", body["text"], headline)
+			}
+			if blocks, _ := body["blocks"].([]any); len(blocks) != 3 {
+				t.Errorf("got %d blocks, want 3", len(blocks))
+			}
+		}},
+		{ChannelDiscord, func(t *testing.T, body map[string]any) {
+			embeds, _ := body["embeds"].([]any)
+			if len(embeds) != 1 {
+				t.Fatalf("got %d embeds, want 1", len(embeds))
+			}
+			embed := embeds[0].(map[string]any)
+			if embed["title"] != headline || embed["color"] != float64(colorDown) {
+				t.Errorf("embed = %v", embed)
+			}
+		}},
+		{ChannelTeams, func(t *testing.T, body map[string]any) {
+			if body["@type"] != "MessageCard" || body["title"] != headline || body["themeColor"] != "cf222e" {
+				t.Errorf("card = %v", body)
+			}
+		}},
+		{ChannelTelegram, func(t *testing.T, body map[string]any) {
+			if body["chat_id"] != "-100123" || body["parse_mode"] != "HTML" {
+				t.Errorf("message = %v", body)
+			}
+			text, _ := body["text"].(string)
+			if !strings.HasPrefix(text, "<b>Shop &lt;prod&gt; is down (offline)</b>") {
+				t.Errorf("text isn't escaped HTML: %q", text)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channelType, func(t *testing.T) {
+			receiver := newChatReceiver(t, http.StatusOK)
+			ch := Channel{ID: 1, Type: tt.channelType, URL: receiver.URL + "/hook"}
+			wantPath := "/hook"
+			if tt.channelType == ChannelTelegram {
+				t.Setenv("TELEGRAM_API_URL", receiver.URL+"/")
+				ch = Channel{ID: 1, Type: ChannelTelegram, Token: "123:secret", ChatID: "-100123"}
+				wantPath = "/bot123:secret/sendMessage"
+			}
+
+			d := SendChannel(ch, downAlert(), 3)
+			if !d.Success || d.Attempt != 1 || d.StatusCode != http.StatusOK {
+				t.Fatalf("delivery = %+v, want success on the first attempt", d)
+			}
+			if receiver.paths[0] != wantPath {
+				t.Errorf("posted to %q, want %q", receiver.paths[0], wantPath)
+			}
+			tt.check(t, receiver.bodies[0])
+		})
+	}
+}
+
+func TestSendChannelRetriesServerErrors(t *testing.T) {
+	t.Parallel()
+	receiver := newChatReceiver(t, http.StatusServiceUnavailable, http.StatusOK)
+
+	d := SendChannel(Channel{ID: 1, Type: ChannelSlack, URL: receiver.URL}, downAlert(), 2)
+	if !d.Success || d.Attempt != 2 {
+		t.Fatalf("delivery = %+v, want success on the second attempt", d)
+	}
+	if n := receiver.requests(); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+}
+
+func TestSendChannelGivesUpOnClientErrors(t *testing.T) {
+	receiver := newChatReceiver(t, http.StatusNotFound)
+
+	d := SendChannel(Channel{ID: 1, Type: ChannelDiscord, URL: receiver.URL}, downAlert(), 3)
+	if d.Success || d.Attempt != 1 || d.StatusCode != http.StatusNotFound {
+		t.Fatalf("delivery = %+v, want one failed attempt", d)
+	}
+	if n := receiver.requests(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestSendChannelHidesTelegramToken(t *testing.T) {
+	receiver := newChatReceiver(t, http.StatusOK)
+	receiver.Close()
+	t.Setenv("TELEGRAM_API_URL", receiver.URL)
+
+	ch := Channel{ID: 1, Type: ChannelTelegram, Token: "123:secret", ChatID: "1"}
+	d := SendChannel(ch, downAlert(), 1)
+	if d.Success || d.ErrorMessage == "" {
+		t.Fatalf("delivery = %+v, want a connection error", d)
+	}
+	if strings.Contains(d.ErrorMessage, "secret") {
+		t.Errorf("error message leaks the bot token: %q", d.ErrorMessage)
+	}
+}
+
+func TestSendChannelUnknownType(t *testing.T) {
+	d := SendChannel(Channel{ID: 1, Type: "pager"}, downAlert(), 3)
+	if d.Success || d.Attempt != 0 || !strings.Contains(d.ErrorMessage, "unknown channel type") {
+		t.Errorf("delivery = %+v, want an unknown type error without attempts", d)
+	}
+}
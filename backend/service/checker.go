@@ -0,0 +1,291 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAcceptedStatuses is used when a monitor doesn't set its own list.
+const DefaultAcceptedStatuses = "200-399"
+
+// maxDownloadBytes caps how much of a response body is read when timing the download.
+const maxDownloadBytes = 10 << 20
+
+// CheckResult is the outcome of a single check.
+type CheckResult struct {
+	Status       string
+	ResponseTime int
+	ResponseCode int
+	ErrorMessage sql.NullString
+	Timings      Timings
+	// Cert is set for HTTPS checks that got as far as the TLS handshake.
+	Cert *CertInfo
+	// DNSAnswer is the resolved answer set of a dns check, nil if the lookup failed.
+	DNSAnswer []string
+	// Event is set on heartbeat logs (ping, start, fail, missed).
+	Event string
+	// Attempt numbers the retries of one scheduled check, starting at 1.
+	Attempt int
+	// Unconfirmed marks results that didn't change the monitor status: a
+	// failure that was retried or that is still below the failure threshold.
+	Unconfirmed bool
+	// IncidentID links a confirmed failure to the incident it belongs to.
+	IncidentID int
+}
+
+func (r *CheckResult) fail(status, msg string) {
+	r.Status = status
+	r.ErrorMessage = sql.NullString{String: msg, Valid: true}
+}
+
+// httpClient is shared by all workers. Every check opens a new connection, so
+// DNS, connect and TLS are measured each time and a dead server can't hide
+// behind a pooled connection.
+var httpClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DisableKeepAlives:   true,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		// Allow up to 10 redirects, then judge the last response
+		if len(via) >= 10 {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	},
+}
+
+// defaultHeaders look like a regular browser, since some sites reject bare
+// clients. Accept-Encoding is left to the transport so bodies arrive
+// decompressed for content rules.
+var defaultHeaders = map[string]string{
+	"User-Agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8",
+	"Accept-Language":           "en-US,en;q=0.9",
+	"Upgrade-Insecure-Requests": "1",
+	"Sec-Fetch-Dest":            "document",
+	"Sec-Fetch-Mode":            "navigate",
+	"Sec-Fetch-Site":            "none",
+	"DNT":                       "1",
+}
+
+// ValidateMonitor rejects configurations that could never pass a check.
+func ValidateMonitor(m Monitor) error {
+	if err := validateRetry(m); err != nil {
+		return err
+	}
+	if len(m.Channels) > MaxMonitorChannels {
+		return fmt.Errorf("a monitor can notify at most %d channels", MaxMonitorChannels)
+	}
+	switch m.MonitorType() {
+	case TypeHTTP:
+		if m.hasHeartbeatSettings() {
+			return fmt.Errorf("grace_period only applies to heartbeat monitors")
+		}
+		if m.hasTCPSettings() {
+			return fmt.Errorf("payload and expect_banner only apply to tcp monitors")
+		}
+		if m.hasDNSSettings() {
+			return fmt.Errorf("record_type, resolver and expected_answers only apply to dns monitors")
+		}
+	case TypeTCP:
+		if m.hasHTTPSettings() || m.hasDNSSettings() || m.hasHeartbeatSettings() {
+			return fmt.Errorf("tcp monitors don't support HTTP request or body settings")
+		}
+		return nil
+	case TypeDNS:
+		if m.hasHTTPSettings() || m.hasTCPSettings() || m.hasHeartbeatSettings() {
+			return fmt.Errorf("dns monitors only support record_type, resolver and expected_answers")
+		}
+		return validateDNS(m)
+	case TypeHeartbeat:
+		if m.hasHTTPSettings() || m.hasTCPSettings() || m.hasDNSSettings() || m.hasRetrySettings() {
+			return fmt.Errorf("heartbeat monitors only support grace_period")
+		}
+		if m.HeartbeatGrace < 0 || m.HeartbeatGrace > MaxHeartbeatGrace {
+			return fmt.Errorf("grace_period must be between 0 and %d seconds", MaxHeartbeatGrace)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown monitor type %q", m.Type)
+	}
+	if err := ValidateContentRules(m.ContentRules); err != nil {
+		return err
+	}
+	if err := ValidateJSONAssertions(m.JSONAssertions); err != nil {
+		return err
+	}
+	if _, err := ParseStatusRanges(m.AcceptedStatuses); err != nil {
+		return err
+	}
+	if m.method() == "HEAD" && (len(m.ContentRules) > 0 || len(m.JSONAssertions) > 0) {
+		return fmt.Errorf("HEAD requests have no body to evaluate content rules or JSON assertions against")
+	}
+	return nil
+}
+
+// CheckMonitor runs one check. Both the scheduler and the add/edit handlers go
+// through here so a monitor is judged the same way everywhere.
+func CheckMonitor(m Monitor) CheckResult {
+	switch m.MonitorType() {
+	case TypeTCP:
+		return checkTCP(m)
+	case TypeDNS:
+		return checkDNS(m)
+	case TypeHeartbeat:
+		// Heartbeats are judged by RecordHeartbeat and checkHeartbeat, there
+		// is nothing to probe.
+		return CheckResult{Status: "error", ErrorMessage: sql.NullString{String: "heartbeat monitors can't be probed", Valid: true}}
+	default:
+		return checkHTTP(m)
+	}
+}
+
+func checkHTTP(m Monitor) (res CheckResult) {
+	accepted, err := ParseStatusRanges(m.AcceptedStatuses)
+	if err != nil {
+		res.fail("error", err.Error())
+		return
+	}
+
+	var body io.Reader
+	if m.Body != "" {
+		body = strings.NewReader(m.Body)
+	}
+	req, err := http.NewRequest(m.method(), m.URL, body)
+	if err != nil {
+		res.fail("error", fmt.Sprintf("Failed to create request: %v", err))
+		return
+	}
+	for k, v := range defaultHeaders {
+		req.Header.Set(k, v)
+	}
+	if len(m.JSONAssertions) > 0 {
+		req.Header.Set("Accept", "application/json")
+	}
+	for k, v := range m.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	req, trace := TraceRequest(req)
+
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		res.ResponseTime = int(time.Since(start).Milliseconds())
+		res.Timings = trace.Timings()
+		if res.Cert = certFromError(err); res.Cert != nil {
+			res.fail("error", certProblem(res.Cert, time.Now()))
+			return
+		}
+		res.fail("error", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	res.Cert = certFromState(resp.TLS)
+
+	// Read the body so the download phase is part of the measurement.
+	respBody := ReadBody(resp.Body, m.MaxBodyBytes)
+	trace.BodyDone()
+	res.ResponseTime = int(time.Since(start).Milliseconds())
+	res.Timings = trace.Timings()
+	res.ResponseCode = resp.StatusCode
+
+	if !accepted.Contains(resp.StatusCode) {
+		res.fail("offline", fmt.Sprintf("Unexpected status %s (accepted: %s)", resp.Status, accepted))
+		return
+	}
+
+	failed := EvaluateContentRules(respBody, m.ContentRules)
+	if failed == "" {
+		failed = EvaluateJSONAssertions(respBody, m.JSONAssertions)
+	}
+	if failed != "" {
+		res.fail("offline", failed)
+		return
+	}
+
+	if res.Cert != nil {
+		if days := res.Cert.DaysUntilExpiry(time.Now()); days < m.certExpiryDays() {
+			res.fail("warning", fmt.Sprintf("Certificate for %s expires in %d days on %s",
+				res.Cert.ExpiringCert(), days, res.Cert.NotAfter.UTC().Format("2006-01-02")))
+			return
+		}
+	}
+	res.Status = "online"
+	return
+}
+
+type statusRange struct{ from, to int }
+
+// StatusRanges is a parsed accepted-status list.
+type StatusRanges []statusRange
+
+// ParseStatusRanges parses lists like "200,204,300-399". An empty string means
+// DefaultAcceptedStatuses.
+func ParseStatusRanges(spec string) (StatusRanges, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = DefaultAcceptedStatuses
+	}
+	var ranges StatusRanges
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q", part)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+				return nil, fmt.Errorf("invalid status range %q", part)
+			}
+		}
+		if from > to {
+			return nil, fmt.Errorf("invalid status range %q", part)
+		}
+		if from < 100 || to > 599 {
+			return nil, fmt.Errorf("status range %q must be within 100-599", part)
+		}
+		ranges = append(ranges, statusRange{from, to})
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("accepted statuses must list at least one code")
+	}
+	return ranges, nil
+}
+
+// Contains reports whether code is accepted.
+func (s StatusRanges) Contains(code int) bool {
+	for _, r := range s {
+		if code >= r.from && code <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+func (s StatusRanges) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		if r.from == r.to {
+			parts[i] = strconv.Itoa(r.from)
+		} else {
+			parts[i] = fmt.Sprintf("%d-%d", r.from, r.to)
+		}
+	}
+	return strings.Join(parts, ",")
+}
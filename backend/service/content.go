@@ -0,0 +1,95 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+const (
+	DefaultMaxBodyBytes = 1 << 20
+	MaxMaxBodyBytes     = 5 << 20
+)
+
+// ContentRule is an assertion on the response body of an HTTP monitor.
+type ContentRule struct {
+	Type  string `json:"type" validate:"required,oneof=contains not_contains regex"`
+	Value string `json:"value" validate:"required,max=1000"`
+}
+
+// ValidateContentRules checks that every regex rule compiles.
+func ValidateContentRules(rules []ContentRule) error {
+	for i, rule := range rules {
+		if rule.Type != "regex" {
+			continue
+		}
+		if _, err := regexp.Compile(rule.Value); err != nil {
+			return fmt.Errorf("content rule %d has an invalid regex: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// EvaluateContentRules returns a description of the first rule the body fails,
+// or an empty string when all rules pass.
+func EvaluateContentRules(body []byte, rules []ContentRule) string {
+	for _, rule := range rules {
+		switch rule.Type {
+		case "contains":
+			if !bytes.Contains(body, []byte(rule.Value)) {
+				return fmt.Sprintf("Content rule failed: body does not contain %q", rule.Value)
+			}
+		case "not_contains":
+			if bytes.Contains(body, []byte(rule.Value)) {
+				return fmt.Sprintf("Content rule failed: body contains %q", rule.Value)
+			}
+		case "regex":
+			re, err := regexp.Compile(rule.Value)
+			if err != nil {
+				return fmt.Sprintf("Content rule failed: invalid regex %q: %v", rule.Value, err)
+			}
+			if !re.Match(body) {
+				return fmt.Sprintf("Content rule failed: body does not match /%s/", rule.Value)
+			}
+		}
+	}
+	return ""
+}
+
+// EncodeContentRules serializes rules for the urls.content_rules column.
+func EncodeContentRules(rules []ContentRule) sql.NullString {
+	if len(rules) == 0 {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// DecodeContentRules parses the urls.content_rules column.
+func DecodeContentRules(raw sql.NullString) []ContentRule {
+	if !raw.Valid || raw.String == "" {
+		return nil
+	}
+	var rules []ContentRule
+	if err := json.Unmarshal([]byte(raw.String), &rules); err != nil {
+		return nil
+	}
+	return rules
+}
+
+// ReadBody keeps up to limit bytes of the body and discards the rest, so the
+// whole transfer is still covered by the download timing.
+func ReadBody(r io.Reader, limit int) []byte {
+	if limit <= 0 {
+		limit = DefaultMaxBodyBytes
+	}
+	body, _ := io.ReadAll(io.LimitReader(r, int64(limit)))
+	io.Copy(io.Discard, io.LimitReader(r, maxDownloadBytes))
+	return body
+}
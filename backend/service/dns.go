@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const dnsTimeout = 10 * time.Second
+
+// DNSRecordTypes are the record types a dns monitor can resolve.
+var DNSRecordTypes = []string{"A", "AAAA", "CNAME", "MX", "TXT", "NS"}
+
+// dnsResolver returns the system resolver, or one that sends every query to
+// addr (host:port) when the monitor sets its own.
+func dnsResolver(addr string) *net.Resolver {
+	if addr == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+func validateDNS(m Monitor) error {
+	recordType := m.dnsRecordType()
+	supported := false
+	for _, t := range DNSRecordTypes {
+		supported = supported || t == recordType
+	}
+	if !supported {
+		return fmt.Errorf("record_type must be one of %s", strings.Join(DNSRecordTypes, ", "))
+	}
+	if m.DNSResolver != "" {
+		if _, port, err := net.SplitHostPort(m.DNSResolver); err != nil || port == "" {
+			return fmt.Errorf("resolver must be host:port")
+		}
+	}
+	return nil
+}
+
+// checkDNS resolves the monitored record and compares the answer set with
+// the expected list, or with the previous answer when none is expected.
+func checkDNS(m Monitor) (res CheckResult) {
+	u, err := url.Parse(m.URL)
+	if err != nil || u.Hostname() == "" {
+		res.fail("error", fmt.Sprintf("Invalid DNS target %q", m.URL))
+		return
+	}
+	host := u.Hostname()
+	recordType := m.dnsRecordType()
+
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+
+	start := time.Now()
+	answer, err := lookupRecords(ctx, dnsResolver(m.DNSResolver), recordType, host)
+	res.ResponseTime = int(time.Since(start).Milliseconds())
+	res.Timings.DNS = res.ResponseTime
+	res.DNSAnswer = answer
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			res.fail("offline", fmt.Sprintf("No %s records for %s", recordType, host))
+			return
+		}
+		res.fail("error", fmt.Sprintf("DNS lookup failed: %v", err))
+		return
+	}
+
+	if len(m.DNSExpected) > 0 {
+		expected := normalizeAnswer(recordType, m.DNSExpected)
+		if !sameAnswer(answer, expected) {
+			res.fail("offline", fmt.Sprintf("%s %s answered %s, expected %s",
+				host, recordType, formatAnswer(answer), formatAnswer(expected)))
+			return
+		}
+	} else if m.DNSPrevious != nil && !sameAnswer(answer, m.DNSPrevious) {
+		res.fail("warning", fmt.Sprintf("%s %s changed from %s to %s",
+			host, recordType, formatAnswer(m.DNSPrevious), formatAnswer(answer)))
+		return
+	}
+	res.Status = "online"
+	return
+}
+
+// lookupRecords returns the normalised answer set for one record type.
+func lookupRecords(ctx context.Context, r *net.Resolver, recordType, host string) ([]string, error) {
+	var answer []string
+	switch recordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := r.LookupIP(ctx, network, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			answer = append(answer, ip.String())
+		}
+	case "CNAME":
+		cname, err := r.LookupCNAME(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		answer = []string{cname}
+	case "MX":
+		mxs, err := r.LookupMX(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			answer = append(answer, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+		}
+	case "TXT":
+		txts, err := r.LookupTXT(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		answer = txts
+	case "NS":
+		nss, err := r.LookupNS(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range nss {
+			answer = append(answer, ns.Host)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported record type %q", recordType)
+	}
+	return normalizeAnswer(recordType, answer), nil
+}
+
+// normalizeAnswer sorts the records and lowercases names without their
+// trailing dot, so answers from different resolvers and user supplied lists
+// compare equal. TXT values are kept verbatim.
+func normalizeAnswer(recordType string, records []string) []string {
+	out := make([]string, 0, len(records))
+	for _, rec := range records {
+		if recordType != "TXT" {
+			rec = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(rec), "."))
+			if recordType == "MX" {
+				rec = strings.Join(strings.Fields(rec), " ")
+			}
+		}
+		if rec == "" {
+			continue
+		}
+		out = append(out, rec)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sameAnswer(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func formatAnswer(answer []string) string {
+	if len(answer) == 0 {
+		return "[]"
+	}
+	return "[" + strings.Join(answer, ", ") + "]"
+}
+
+// EncodeAnswer serializes an answer set for the dns_answer columns.
+func EncodeAnswer(answer []string) sql.NullString {
+	if answer == nil {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(answer)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// DecodeAnswer parses a dns_answer column. NULL stays nil so "never
+// resolved" can be told apart from an empty answer.
+func DecodeAnswer(raw sql.NullString) []string {
+	if !raw.Valid {
+		return nil
+	}
+	answer := []string{}
+	if err := json.Unmarshal([]byte(raw.String), &answer); err != nil {
+		return nil
+	}
+	return answer
+}
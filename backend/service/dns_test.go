@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// DNS type codes answered by dnsServer.
+const (
+	typeA     = 1
+	typeCNAME = 5
+	typeMX    = 15
+	typeTXT   = 16
+	typeAAAA  = 28
+)
+
+// dnsServer stands in for a resolver on a local UDP port. It answers every
+// name in its zone with the records of the asked type, NXDOMAIN for names
+// outside of it, and counts the queries.
+type dnsServer struct {
+	addr    string
+	zone    string
+	mu      sync.Mutex
+	records map[uint16][][]byte
+	queries int
+}
+
+func newDNSServer(t *testing.T, zone string) *dnsServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s := &dnsServer{addr: conn.LocalAddr().String(), zone: zone, records: map[uint16][][]byte{}}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if reply := s.answer(buf[:n]); reply != nil {
+				conn.WriteTo(reply, from)
+			}
+		}
+	}()
+	return s
+}
+
+// set replaces the records of one type with rdata built by the helpers below.
+func (s *dnsServer) set(recordType uint16, rdata ...[]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[recordType] = rdata
+}
+
+func (s *dnsServer) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	// The question starts after the header: labels, then type and class.
+	end := 12
+	var labels []string
+	for end < len(query) && query[end] != 0 {
+		size := int(query[end])
+		if end+1+size > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[end+1:end+1+size]))
+		end += 1 + size
+	}
+	end += 5
+	if end > len(query) {
+		return nil
+	}
+	name := strings.ToLower(strings.Join(labels, "."))
+	qtype := binary.BigEndian.Uint16(query[end-4:])
+
+	s.mu.Lock()
+	s.queries++
+	var answers [][]byte
+	answerType := qtype
+	if name == s.zone {
+		answers = s.records[qtype]
+		// Like a real server, an address query for an alias gets the alias.
+		if cname := s.records[typeCNAME]; len(cname) > 0 && (qtype == typeA || qtype == typeAAAA) {
+			answers, answerType = cname, typeCNAME
+		}
+	}
+	s.mu.Unlock()
+
+	reply := append([]byte{}, query[:end]...)
+	flags := uint16(0x8180) // response, recursion desired and available
+	if name != s.zone {
+		flags |= 3 // NXDOMAIN
+	}
+	binary.BigEndian.PutUint16(reply[2:], flags)
+	binary.BigEndian.PutUint16(reply[6:], uint16(len(answers)))
+	binary.BigEndian.PutUint16(reply[8:], 0)
+	binary.BigEndian.PutUint16(reply[10:], 0)
+	for _, rdata := range answers {
+		// Name as a pointer to the question, type, class IN, TTL 60.
+		reply = append(reply, 0xc0, 12)
+		reply = binary.BigEndian.AppendUint16(reply, answerType)
+		reply = binary.BigEndian.AppendUint16(reply, 1)
+		reply = binary.BigEndian.AppendUint32(reply, 60)
+		reply = binary.BigEndian.AppendUint16(reply, uint16(len(rdata)))
+		reply = append(reply, rdata...)
+	}
+	return reply
+}
+
+func (s *dnsServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries
+}
+
+func dnsName(name string) []byte {
+	var out []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		out = append(out, byte(len(label)))
+		out = append(out, label...)
+	}
+	return append(out, 0)
+}
+
+func rdataA(ip string) []byte { return net.ParseIP(ip).To4() }
+
+func rdataMX(pref uint16, host string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, pref), dnsName(host)...)
+}
+
+func rdataTXT(text string) []byte { return append([]byte{byte(len(text))}, text...) }
+
+func TestLookupRecordsThroughResolver(t *testing.T) {
+	server := newDNSServer(t, "shop.test")
+	server.set(typeA, rdataA("192.0.2.7"), rdataA("192.0.2.1"))
+	server.set(typeMX, rdataMX(20, "Backup.Mail.test."), rdataMX(10, "mail.test."))
+	server.set(typeTXT, rdataTXT("v=spf1 -all"))
+
+	tests := []struct {
+		recordType string
+		want       []string
+	}{
+		{"A", []string{"192.0.2.1", "192.0.2.7"}},
+		{"MX", []string{"10 mail.test", "20 backup.mail.test"}},
+		{"TXT", []string{"v=spf1 -all"}},
+	}
+	for _, tt := range tests {
+		got, err := lookupRecords(context.Background(), dnsResolver(server.addr), tt.recordType, "shop.test")
+		if err != nil {
+			t.Errorf("lookupRecords(%s) failed: %v", tt.recordType, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lookupRecords(%s) = %v, want %v", tt.recordType, got, tt.want)
+		}
+	}
+	if server.count() == 0 {
+		t.Error("the lookups didn't reach the monitor's resolver")
+	}
+
+	alias := newDNSServer(t, "www.shop.test")
+	alias.set(typeCNAME, dnsName("Edge.CDN.test."))
+	got, err := lookupRecords(context.Background(), dnsResolver(alias.addr), "CNAME", "www.shop.test")
+	if err != nil || !reflect.DeepEqual(got, []string{"edge.cdn.test"}) {
+		t.Errorf("lookupRecords(CNAME) = %v, %v, want [edge.cdn.test]", got, err)
+	}
+}
+
+func TestCheckDNSDetectsChanges(t *testing.T) {
+	server := newDNSServer(t, "shop.test")
+	server.set(typeA, rdataA("192.0.2.1"))
+	m := Monitor{URL: "dns://shop.test", Type: TypeDNS, DNSResolver: server.addr}
+
+	// The first check has nothing to compare with.
+	res := checkDNS(m)
+	if res.Status != "online" || !reflect.DeepEqual(res.DNSAnswer, []string{"192.0.2.1"}) {
+		t.Fatalf("first check = %s %v (%s)", res.Status, res.DNSAnswer, res.ErrorMessage.String)
+	}
+
+	m.DNSPrevious = res.DNSAnswer
+	if res := checkDNS(m); res.Status != "online" {
+		t.Errorf("unchanged answer gave %s (%s)", res.Status, res.ErrorMessage.String)
+	}
+
+	server.set(typeA, rdataA("198.51.100.9"))
+	res = checkDNS(m)
+	if res.Status != "warning" {
+		t.Fatalf("changed answer gave %s, want warning", res.Status)
+	}
+	if want := "shop.test A changed from [192.0.2.1] to [198.51.100.9]"; res.ErrorMessage.String != want {
+		t.Errorf("message = %q, want %q", res.ErrorMessage.String, want)
+	}
+}
+
+func TestCheckDNSExpectedRecords(t *testing.T) {
+	server := newDNSServer(t, "shop.test")
+	server.set(typeMX, rdataMX(10, "mail.test."))
+	m := Monitor{
+		URL:           "dns://shop.test",
+		Type:          TypeDNS,
+		DNSRecordType: "MX",
+		DNSResolver:   server.addr,
+		DNSExpected:   []string{"10  Mail.test."},
+		// The expected list wins over the previous answer.
+		DNSPrevious: []string{"20 old.test"},
+	}
+	if res := checkDNS(m); res.Status != "online" {
+		t.Fatalf("matching answer gave %s (%s)", res.Status, res.ErrorMessage.String)
+	}
+
+	m.DNSExpected = []string{"10 mail.test", "20 backup.test"}
+	res := checkDNS(m)
+	if res.Status != "offline" {
+		t.Fatalf("mismatch gave %s, want offline", res.Status)
+	}
+	if want := "shop.test MX answered [10 mail.test], expected [10 mail.test, 20 backup.test]"; res.ErrorMessage.String != want {
+		t.Errorf("message = %q, want %q", res.ErrorMessage.String, want)
+	}
+}
+
+func TestCheckDNSMissingName(t *testing.T) {
+	server := newDNSServer(t, "shop.test")
+	res := checkDNS(Monitor{URL: "dns://gone.test", Type: TypeDNS, DNSResolver: server.addr})
+	if res.Status != "offline" || res.ErrorMessage.String != "No A records for gone.test" {
+		t.Errorf("check = %s (%s), want offline without records", res.Status, res.ErrorMessage.String)
+	}
+}
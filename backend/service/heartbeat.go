@@ -0,0 +1,132 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+// Heartbeat events, stored in logs.event.
+const (
+	HeartbeatPing   = "ping"
+	HeartbeatStart  = "start"
+	HeartbeatFail   = "fail"
+	HeartbeatMissed = "missed"
+)
+
+// MaxHeartbeatGrace caps how long a late ping is still accepted.
+const MaxHeartbeatGrace = 86400
+
+// ErrHeartbeatNotFound is returned for tokens that don't belong to a heartbeat monitor.
+var ErrHeartbeatNotFound = fmt.Errorf("heartbeat not found")
+
+// heartbeatWindow is how long after the last ping the next one must arrive.
+func heartbeatWindow(every time.Duration, graceSeconds int) time.Duration {
+	return every + time.Duration(graceSeconds)*time.Second
+}
+
+// RecordHeartbeat handles a ping sent by the monitored job. A ping or fail
+// closes the current window and schedules the next deadline; start only marks
+// the beginning of a run so the following ping can report its duration.
+// It returns the monitor status after the event.
+func RecordHeartbeat(token, event, message string) (string, error) {
+	var (
+		id        int
+		status    string
+		startedAt sql.NullTime
+	)
+	err := db.DB.QueryRow(
+		"SELECT id, status, heartbeat_started_at FROM urls WHERE heartbeat_token = ? AND type = ?",
+		token, TypeHeartbeat,
+	).Scan(&id, &status, &startedAt)
+	if err == sql.ErrNoRows {
+		return "", ErrHeartbeatNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	res := CheckResult{Status: status, Event: event}
+	switch event {
+	case HeartbeatStart:
+		_, err = db.DB.Exec("UPDATE urls SET heartbeat_started_at = NOW() WHERE id = ?", id)
+	case HeartbeatPing, HeartbeatFail:
+		res.Status = "online"
+		if event == HeartbeatFail {
+			if message == "" {
+				message = "Job reported a failure"
+			}
+			res.fail("offline", message)
+		}
+		if startedAt.Valid {
+			res.ResponseTime = int(time.Since(startedAt.Time).Milliseconds())
+		}
+		_, err = db.DB.Exec(
+			"UPDATE urls SET status = ?, response_time = ?, last_checked = NOW(), heartbeat_last_ping = NOW(), heartbeat_started_at = NULL WHERE id = ?",
+			res.Status, res.ResponseTime, id,
+		)
+	default:
+		return "", fmt.Errorf("unknown heartbeat event %q", event)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if event != HeartbeatStart {
+		res.IncidentID = trackIncident(id, status, res.Status, res)
+	}
+	if err := InsertLog(db.DB, id, res); err != nil {
+		log.Printf("[Monitor %d] Error inserting heartbeat log: %v", id, err)
+	}
+	notifyTransition(id, status, res)
+	if event != HeartbeatStart {
+		if err := ScheduleMonitor(id); err != nil {
+			log.Printf("[Monitor %d] Error rescheduling heartbeat: %v", id, err)
+		}
+	}
+	log.Printf("[Monitor %d] Heartbeat %s, monitor is %s", id, event, res.Status)
+	return res.Status, nil
+}
+
+// checkHeartbeat runs when a heartbeat window closes and records a missed
+// window if no ping arrived in it.
+func checkHeartbeat(m Monitor) {
+	var (
+		status         string
+		interval       string
+		customInterval sql.NullInt64
+		lastPing       time.Time
+	)
+	err := db.DB.QueryRow(
+		"SELECT status, `interval`, custom_interval, COALESCE(heartbeat_last_ping, created_at) FROM urls WHERE id = ?", m.ID,
+	).Scan(&status, &interval, &customInterval, &lastPing)
+	if err != nil {
+		log.Printf("[Monitor %d] Error fetching heartbeat: %v", m.ID, err)
+		return
+	}
+
+	every := CheckInterval(interval, customInterval)
+	window := heartbeatWindow(every, m.HeartbeatGrace)
+	if time.Since(lastPing) < window {
+		return
+	}
+
+	res := CheckResult{Event: HeartbeatMissed}
+	res.fail("offline", fmt.Sprintf("No ping received since %s (expected every %s with %s grace)",
+		lastPing.UTC().Format(time.RFC3339), every, time.Duration(m.HeartbeatGrace)*time.Second))
+
+	_, err = db.DB.Exec("UPDATE urls SET status = ?, last_checked = CURRENT_TIMESTAMP WHERE id = ?", res.Status, m.ID)
+	if err != nil {
+		log.Printf("[Monitor %d] Error updating URL status: %v", m.ID, err)
+	}
+	res.IncidentID = trackIncident(m.ID, status, res.Status, res)
+	if err := InsertLog(db.DB, m.ID, res); err != nil {
+		log.Printf("[Monitor %d] Error inserting log: %v", m.ID, err)
+		return
+	}
+	notifyTransition(m.ID, status, res)
+	log.Printf("[Monitor %d] Heartbeat missed, last ping at %s", m.ID, lastPing.Format(time.RFC3339))
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+// Incident statuses. An incident is active until it is resolved.
+const (
+	IncidentOpen         = "open"
+	IncidentAcknowledged = "acknowledged"
+	IncidentResolved     = "resolved"
+)
+
+// Incident timeline events, stored in incident_events.type.
+const (
+	IncidentEventOpened        = "opened"
+	IncidentEventStatusChanged = "status_changed"
+	IncidentEventReminder      = "reminder"
+	IncidentEventAcknowledged  = "acknowledged"
+	IncidentEventResolved      = "resolved"
+)
+
+// DefaultAlertRepeat is how often an unacknowledged incident is alerted again
+// unless ALERT_REPEAT_MINUTES says otherwise; 0 turns reminders off.
+const DefaultAlertRepeat = time.Hour
+
+// ErrIncidentNotFound is returned for incidents that don't exist or aren't the user's.
+var ErrIncidentNotFound = fmt.Errorf("incident not found")
+
+// ErrIncidentResolved is returned when acknowledging an incident that is already over.
+var ErrIncidentResolved = fmt.Errorf("incident is already resolved")
+
+func alertRepeat() time.Duration {
+	raw := os.Getenv("ALERT_REPEAT_MINUTES")
+	if raw == "" {
+		return DefaultAlertRepeat
+	}
+	minutes, err := strconv.Atoi(raw)
+	if err != nil || minutes < 0 {
+		return DefaultAlertRepeat
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// trackIncident keeps the incident of a monitor in line with its confirmed
+// status after a check: a down status opens an incident or adds to the active
+// one, an up status resolves it. It returns the incident the check's log
+// belongs to, 0 when the monitor is up.
+func trackIncident(id int, from, status string, res CheckResult) int {
+	var (
+		incidentID  int
+		state       string
+		lastAlertAt sql.NullTime
+	)
+	err := db.DB.QueryRow(
+		"SELECT id, status, last_alert_at FROM incidents WHERE url_id = ? AND status <> ? ORDER BY id DESC LIMIT 1",
+		id, IncidentResolved,
+	).Scan(&incidentID, &state, &lastAlertAt)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("[Monitor %d] Error loading incident: %v", id, err)
+		return 0
+	}
+
+	if !isDown(status) {
+		if incidentID != 0 {
+			resolveIncident(id, incidentID, status)
+		}
+		return 0
+	}
+
+	if incidentID == 0 {
+		if incidentID, err = openIncident(id, status, res); err != nil {
+			log.Printf("[Monitor %d] Error opening incident: %v", id, err)
+			return 0
+		}
+		log.Printf("[Monitor %d] Opened incident %d", id, incidentID)
+		return incidentID
+	}
+
+	if status != from {
+		addIncidentEvent(incidentID, IncidentEventStatusChanged, status,
+			fmt.Sprintf("Status changed from %s to %s: %s", from, status, res.ErrorMessage.String), 0)
+	}
+
+	// Remind about incidents nobody acknowledged yet.
+	repeat := alertRepeat()
+	if state == IncidentOpen && repeat > 0 && !res.Unconfirmed &&
+		(!lastAlertAt.Valid || time.Since(lastAlertAt.Time) >= repeat) {
+		if _, err := db.DB.Exec("UPDATE incidents SET last_alert_at = NOW() WHERE id = ?", incidentID); err != nil {
+			log.Printf("[Monitor %d] Error updating incident %d: %v", id, incidentID, err)
+		}
+		addIncidentEvent(incidentID, IncidentEventReminder, status, "Still down, alert sent again", 0)
+		remindIncident(id, status, res)
+	}
+	return incidentID
+}
+
+func openIncident(id int, status string, res CheckResult) (int, error) {
+	cause := res.ErrorMessage.String
+	if cause == "" {
+		cause = "Monitor is " + status
+	}
+	result, err := db.DB.Exec(
+		"INSERT INTO incidents (url_id, user_id, status, first_status, cause, started_at, last_alert_at) "+
+			"SELECT id, user_id, ?, ?, ?, NOW(), NOW() FROM urls WHERE id = ?",
+		IncidentOpen, status, cause, id,
+	)
+	if err != nil {
+		return 0, err
+	}
+	incidentID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	addIncidentEvent(int(incidentID), IncidentEventOpened, status, cause, 0)
+	return int(incidentID), nil
+}
+
+func resolveIncident(id, incidentID int, status string) {
+	_, err := db.DB.Exec("UPDATE incidents SET status = ?, resolved_at = NOW() WHERE id = ?", IncidentResolved, incidentID)
+	if err != nil {
+		log.Printf("[Monitor %d] Error resolving incident %d: %v", id, incidentID, err)
+		return
+	}
+	addIncidentEvent(incidentID, IncidentEventResolved, status, "Monitor is "+status+" again", 0)
+	log.Printf("[Monitor %d] Resolved incident %d", id, incidentID)
+}
+
+func addIncidentEvent(incidentID int, eventType, status, message string, userID int) {
+	_, err := db.DB.Exec(
+		"INSERT INTO incident_events (incident_id, type, status, message, user_id) VALUES (?, ?, ?, ?, ?)",
+		incidentID, eventType,
+		sql.NullString{String: status, Valid: status != ""},
+		sql.NullString{String: message, Valid: message != ""},
+		sql.NullInt64{Int64: int64(userID), Valid: userID > 0},
+	)
+	if err != nil {
+		log.Printf("[Incident %d] Error adding %s event: %v", incidentID, eventType, err)
+	}
+}
+
+// AcknowledgeIncident marks an active incident as handled by userID, which
+// stops the reminder alerts. Acknowledging twice is a no-op. Callers check
+// that userID may edit the incident's monitor.
+func AcknowledgeIncident(incidentID, userID int, note string) error {
+	var state string
+	err := db.DB.QueryRow("SELECT status FROM incidents WHERE id = ?", incidentID).Scan(&state)
+	if err == sql.ErrNoRows {
+		return ErrIncidentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	switch state {
+	case IncidentResolved:
+		return ErrIncidentResolved
+	case IncidentAcknowledged:
+		return nil
+	}
+
+	_, err = db.DB.Exec(
+		"UPDATE incidents SET status = ?, acknowledged_at = NOW(), acknowledged_by = ? WHERE id = ? AND status = ?",
+		IncidentAcknowledged, userID, incidentID, IncidentOpen,
+	)
+	if err != nil {
+		return err
+	}
+	if note == "" {
+		note = "Incident acknowledged"
+	}
+	addIncidentEvent(incidentID, IncidentEventAcknowledged, "", note, userID)
+	return nil
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JSONAssertion checks a value selected from a JSON response body.
+// Path supports the common JSONPath subset: $.a.b, $['a'], $.list[0] and
+// $.list[*]. With a wildcard the assertion must hold for every match.
+type JSONAssertion struct {
+	Path     string `json:"path" validate:"required,max=255"`
+	Operator string `json:"operator" validate:"required,oneof=== != < > exists matches"`
+	Value    any    `json:"value,omitempty"`
+}
+
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath splits an expression like $.data.items[0]['name'] into steps.
+func parseJSONPath(path string) ([]pathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path must start with $")
+	}
+	var steps []pathStep
+	rest := path[1:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if key == "" {
+				return nil, fmt.Errorf("empty key in %q", path)
+			}
+			if key == "*" {
+				steps = append(steps, pathStep{wildcard: true})
+			} else {
+				steps = append(steps, pathStep{key: key})
+			}
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("unclosed [ in %q", path)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				steps = append(steps, pathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, pathStep{key: inner[1 : len(inner)-1]})
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index %q in %q", inner, path)
+				}
+				steps = append(steps, pathStep{index: i, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", rest[0], path)
+		}
+	}
+	return steps, nil
+}
+
+// selectJSON returns every value the steps resolve to.
+func selectJSON(doc any, steps []pathStep) []any {
+	current := []any{doc}
+	for _, step := range steps {
+		var next []any
+		for _, node := range current {
+			switch v := node.(type) {
+			case map[string]any:
+				if step.wildcard {
+					for _, child := range v {
+						next = append(next, child)
+					}
+				} else if child, ok := v[step.key]; ok && !step.isIndex {
+					next = append(next, child)
+				}
+			case []any:
+				if step.wildcard {
+					next = append(next, v...)
+				} else if step.isIndex {
+					i := step.index
+					if i < 0 {
+						i += len(v)
+					}
+					if i >= 0 && i < len(v) {
+						next = append(next, v[i])
+					}
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// ValidateJSONAssertions checks paths, operators and regexes up front.
+func ValidateJSONAssertions(assertions []JSONAssertion) error {
+	for i, a := range assertions {
+		if _, err := parseJSONPath(a.Path); err != nil {
+			return fmt.Errorf("json assertion %d: %v", i+1, err)
+		}
+		switch a.Operator {
+		case "exists":
+		case "matches":
+			pattern, ok := a.Value.(string)
+			if !ok {
+				return fmt.Errorf("json assertion %d: matches needs a string pattern", i+1)
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("json assertion %d: invalid regex: %v", i+1, err)
+			}
+		case "<", ">":
+			if _, ok := toNumber(a.Value); !ok {
+				return fmt.Errorf("json assertion %d: %s needs a numeric value", i+1, a.Operator)
+			}
+		default:
+			if a.Value == nil {
+				return fmt.Errorf("json assertion %d: %s needs a value", i+1, a.Operator)
+			}
+		}
+	}
+	return nil
+}
+
+// EvaluateJSONAssertions returns a description of the first failing assertion,
+// or an empty string when the body satisfies all of them.
+func EvaluateJSONAssertions(body []byte, assertions []JSONAssertion) string {
+	if len(assertions) == 0 {
+		return ""
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Sprintf("JSON assertion failed: response is not valid JSON: %v", err)
+	}
+
+	for _, a := range assertions {
+		steps, err := parseJSONPath(a.Path)
+		if err != nil {
+			return fmt.Sprintf("JSON assertion failed: %v", err)
+		}
+		matches := selectJSON(doc, steps)
+		if a.Operator == "exists" {
+			if len(matches) == 0 {
+				return fmt.Sprintf("JSON assertion failed: %s does not exist", a.Path)
+			}
+			continue
+		}
+		if len(matches) == 0 {
+			return fmt.Sprintf("JSON assertion failed: %s not found (expected %s %s)", a.Path, a.Operator, formatJSONValue(a.Value))
+		}
+		for _, actual := range matches {
+			if ok, err := compareJSON(actual, a.Operator, a.Value); !ok {
+				if err != nil {
+					return fmt.Sprintf("JSON assertion failed: %s: %v", a.Path, err)
+				}
+				return fmt.Sprintf("JSON assertion failed: %s is %s, expected %s %s",
+					a.Path, formatJSONValue(actual), a.Operator, formatJSONValue(a.Value))
+			}
+		}
+	}
+	return ""
+}
+
+func compareJSON(actual any, operator string, expected any) (bool, error) {
+	switch operator {
+	case "==":
+		return jsonEqual(actual, expected), nil
+	case "!=":
+		return !jsonEqual(actual, expected), nil
+	case "<", ">":
+		a, ok := toNumber(actual)
+		if !ok {
+			return false, fmt.Errorf("%s is not a number", formatJSONValue(actual))
+		}
+		e, _ := toNumber(expected)
+		if operator == "<" {
+			return a < e, nil
+		}
+		return a > e, nil
+	case "matches":
+		pattern, _ := expected.(string)
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(jsonString(actual)), nil
+	}
+	return false, fmt.Errorf("unknown operator %q", operator)
+}
+
+// jsonEqual compares numbers numerically and everything else by its JSON form,
+// so 1 == 1.0 and "ok" == "ok".
+func jsonEqual(a, b any) bool {
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			return x == y
+		}
+	}
+	return formatJSONValue(a) == formatJSONValue(b)
+}
+
+func toNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func jsonString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return formatJSONValue(v)
+}
+
+func formatJSONValue(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// EncodeJSONAssertions serializes assertions for the urls.json_assertions column.
+func EncodeJSONAssertions(assertions []JSONAssertion) sql.NullString {
+	if len(assertions) == 0 {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(assertions)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// DecodeJSONAssertions parses the urls.json_assertions column.
+func DecodeJSONAssertions(raw sql.NullString) []JSONAssertion {
+	if !raw.Valid || raw.String == "" {
+		return nil
+	}
+	var assertions []JSONAssertion
+	if err := json.Unmarshal([]byte(raw.String), &assertions); err != nil {
+		return nil
+	}
+	return assertions
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const jsonDoc = `{
+	"status": "ok",
+	"version": 2,
+	"data": {
+		"items": [
+			{"name": "api", "latency": 120, "healthy": true},
+			{"name": "db", "latency": 80, "healthy": true}
+		],
+		"odd key": "x"
+	}
+}`
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []pathStep
+	}{
+		{"$", nil},
+		{"$.status", []pathStep{{key: "status"}}},
+		{"$.data.items[0]", []pathStep{{key: "data"}, {key: "items"}, {index: 0, isIndex: true}}},
+		{"$.data.items[-1].name", []pathStep{{key: "data"}, {key: "items"}, {index: -1, isIndex: true}, {key: "name"}}},
+		{"$['data'][\"odd key\"]", []pathStep{{key: "data"}, {key: "odd key"}}},
+		{"$.data.items[*]", []pathStep{{key: "data"}, {key: "items"}, {wildcard: true}}},
+		{"$.data.*", []pathStep{{key: "data"}, {wildcard: true}}},
+	}
+	for _, tt := range tests {
+		got, err := parseJSONPath(tt.path)
+		if err != nil {
+			t.Errorf("parseJSONPath(%q) failed: %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseJSONPath(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseJSONPathErrors(t *testing.T) {
+	for _, path := range []string{"status", "$.", "$..a", "$.items[0", "$.items[x]", "$status"} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("parseJSONPath(%q) succeeded, want an error", path)
+		}
+	}
+}
+
+func TestSelectJSON(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(jsonDoc), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want []any
+	}{
+		{"$.status", []any{"ok"}},
+		{"$.data.items[1].name", []any{"db"}},
+		{"$.data.items[-1].latency", []any{float64(80)}},
+		{"$.data.items[*].name", []any{"api", "db"}},
+		{"$.data['odd key']", []any{"x"}},
+		{"$.data.items[5]", nil},
+		{"$.missing.key", nil},
+		{"$.status[0]", nil},
+	}
+	for _, tt := range tests {
+		steps, err := parseJSONPath(tt.path)
+		if err != nil {
+			t.Fatalf("parseJSONPath(%q) failed: %v", tt.path, err)
+		}
+		if got := selectJSON(doc, steps); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("selectJSON(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateJSONAssertions(t *testing.T) {
+	tests := []struct {
+		name      string
+		assertion JSONAssertion
+		// fail is a part of the expected failure, empty when it must pass.
+		fail string
+	}{
+		{"equal string", JSONAssertion{"$.status", "==", "ok"}, ""},
+		{"equal number", JSONAssertion{"$.version", "==", 2.0}, ""},
+		{"number as string", JSONAssertion{"$.version", "==", "2"}, ""},
+		{"not equal", JSONAssertion{"$.status", "!=", "down"}, ""},
+		{"less than for all", JSONAssertion{"$.data.items[*].latency", "<", 200.0}, ""},
+		{"wildcard fails on one", JSONAssertion{"$.data.items[*].latency", "<", 100.0}, "$.data.items[*].latency is 120, expected < 100"},
+		{"greater than", JSONAssertion{"$.version", ">", 1.0}, ""},
+		{"exists", JSONAssertion{"$.data.items[0]", "exists", nil}, ""},
+		{"does not exist", JSONAssertion{"$.data.nope", "exists", nil}, "$.data.nope does not exist"},
+		{"matches", JSONAssertion{"$.data.items[*].name", "matches", "^(api|db)$"}, ""},
+		{"not found", JSONAssertion{"$.data.nope", "==", "x"}, `$.data.nope not found (expected == "x")`},
+		{"not a number", JSONAssertion{"$.status", ">", 1.0}, `"ok" is not a number`},
+		{"mismatch", JSONAssertion{"$.status", "==", "down"}, `$.status is "ok", expected == "down"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EvaluateJSONAssertions([]byte(jsonDoc), []JSONAssertion{tt.assertion})
+			if tt.fail == "" && got != "" {
+				t.Errorf("got %q, want no failure", got)
+			}
+			if tt.fail != "" && !strings.Contains(got, tt.fail) {
+				t.Errorf("got %q, want a failure containing %q", got, tt.fail)
+			}
+		})
+	}
+}
+
+func TestEvaluateJSONAssertionsInvalidBody(t *testing.T) {
+	got := EvaluateJSONAssertions([]byte("<html>"), []JSONAssertion{{"$.status", "exists", nil}})
+	if !strings.Contains(got, "not valid JSON") {
+		t.Errorf("got %q, want an invalid JSON failure", got)
+	}
+	if got := EvaluateJSONAssertions([]byte("<html>"), nil); got != "" {
+		t.Errorf("got %q without assertions, want no failure", got)
+	}
+}
+
+func TestValidateJSONAssertions(t *testing.T) {
+	valid := []JSONAssertion{
+		{"$.status", "==", "ok"},
+		{"$.version", ">", 1.0},
+		{"$.data", "exists", nil},
+		{"$.status", "matches", "^o"},
+	}
+	if err := ValidateJSONAssertions(valid); err != nil {
+		t.Errorf("ValidateJSONAssertions failed: %v", err)
+	}
+
+	invalid := []JSONAssertion{
+		{"status", "==", "ok"},
+		{"$.status", "matches", "("},
+		{"$.status", "matches", 1.0},
+		{"$.version", "<", "many"},
+		{"$.status", "==", nil},
+	}
+	for _, a := range invalid {
+		if err := ValidateJSONAssertions([]JSONAssertion{a}); err == nil {
+			t.Errorf("ValidateJSONAssertions(%+v) succeeded, want an error", a)
+		}
+	}
+}
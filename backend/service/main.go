@@ -2,17 +2,29 @@ package service
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
-	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	db "github.com/MrPurushotam/web-visitor/config"
+	"github.com/MrPurushotam/web-visitor/utils"
 	"github.com/go-co-op/gocron/v2"
 )
 
+const (
+	MinCheckInterval = 30 * time.Second
+	MaxCheckInterval = 24 * time.Hour
+	// SessionSweepInterval is how often expired and logged out sessions are
+	// deleted.
+	SessionSweepInterval = time.Hour
+)
+
 var (
-	disableCornJob = false
+	// disableCornJob is read by scheduled tasks and queued retries without
+	// taking schedMu, which StopCornJob holds while the scheduler shuts down.
+	disableCornJob atomic.Bool
 	scheduler      gocron.Scheduler
 	schedMu        sync.Mutex
 )
@@ -20,7 +32,7 @@ var (
 func StopCornJob() {
 	schedMu.Lock()
 	defer schedMu.Unlock()
-	disableCornJob = true
+	disableCornJob.Store(true)
 	if scheduler != nil {
 		scheduler.Shutdown()
 		scheduler = nil
@@ -35,7 +47,7 @@ func EnableCornJob() {
 		log.Println("CornJob scheduler already running.")
 		return
 	}
-	disableCornJob = false
+	disableCornJob.Store(false)
 	go InitCornService()
 	log.Println("CornJob scheduler started.")
 }
@@ -54,116 +66,246 @@ func InitCornService() {
 
 	scheduler = s
 	schedMu.Unlock()
-	log.Printf("Initalized Corn Job(6hr).")
-	_, err = s.NewJob(
-		gocron.DurationJob(6*time.Hour),
-		gocron.NewTask(func() {
-			if !disableCornJob {
-				trackAndLogUrls("6hr")
+	getPool()
+
+	rows, err := db.DB.Query("SELECT id FROM urls")
+	if err != nil {
+		log.Printf("Error fetching URLs to schedule: %v", err)
+	} else {
+		var ids []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				log.Printf("Error scanning URL id: %v", err)
+				continue
 			}
-		}),
+			ids = append(ids, id)
+		}
+		rows.Close()
+
+		for _, id := range ids {
+			if err := ScheduleMonitor(id); err != nil {
+				log.Printf("Failed to schedule monitor %d: %v", id, err)
+			}
+		}
+		log.Printf("Initalized Corn Job for %d monitors.", len(ids))
+	}
+
+	s.Start()
+}
+
+// InitHousekeeping runs log compaction and the session sweep on a scheduler
+// of their own, so they keep running while monitoring is disabled.
+func InitHousekeeping() {
+	s, err := gocron.NewScheduler(gocron.WithLocation(time.UTC))
+	if err != nil {
+		log.Fatalf("Failed to create housekeeping scheduler: %v", err)
+	}
+
+	_, err = s.NewJob(
+		gocron.DurationJob(CompactionInterval),
+		gocron.NewTask(CompactLogs),
+		gocron.WithTags("log-compaction"),
+		gocron.WithStartAt(gocron.WithStartImmediately()),
 	)
 	if err != nil {
-		log.Fatalf("Failed to schedule 6hr job: %v", err)
+		log.Printf("Failed to schedule log compaction: %v", err)
 	}
 
-	log.Printf("Initalized Corn Job(12hr).")
 	_, err = s.NewJob(
-		gocron.DurationJob(6*time.Hour),
-		gocron.NewTask(func() {
-			if !disableCornJob {
-				trackAndLogUrls("12hr")
-			}
-		}),
+		gocron.DurationJob(SessionSweepInterval),
+		gocron.NewTask(utils.SweepSessions),
+		gocron.WithTags("session-sweep"),
 	)
 	if err != nil {
-		log.Fatalf("Failed to schedule 12hr job: %v", err)
+		log.Printf("Failed to schedule session sweep: %v", err)
 	}
 
 	s.Start()
 }
 
-func trackAndLogUrls(interval string) {
-	startTime := time.Now()
-	log.Printf("[%s Job] Starting URL monitoring", interval)
+// CheckInterval resolves how often a monitor runs. custom_interval (seconds)
+// takes precedence over the legacy 6hr/12hr interval column.
+func CheckInterval(interval string, customInterval sql.NullInt64) time.Duration {
+	d := 6 * time.Hour
+	if interval == "12hr" {
+		d = 12 * time.Hour
+	}
+	if customInterval.Valid && customInterval.Int64 > 0 {
+		d = time.Duration(customInterval.Int64) * time.Second
+	}
 
-	rows, err := db.DB.Query("SELECT id,url FROM urls WHERE `interval`=?", interval)
-	if err != nil {
-		log.Printf("Error fetching URLs for interval %s: %v", interval, err)
-		return
+	if d < MinCheckInterval {
+		d = MinCheckInterval
 	}
-	defer rows.Close()
+	if d > MaxCheckInterval {
+		d = MaxCheckInterval
+	}
+	return d
+}
 
-	// Count URLs and track success/failure
-	urlCount := 0
-	successCount := 0
-	failureCount := 0
+func monitorTag(id int) string {
+	return fmt.Sprintf("url-%d", id)
+}
 
-	for rows.Next() {
-		urlCount++
-		var id int
-		var url string
-		if err := rows.Scan(&id, &url); err != nil {
-			log.Printf("Error scanning URL row with id and url as: %v, %v with error: %v", id, url, err)
-			continue
-		}
+// ScheduleMonitor (re)registers the job for a single monitor. The first run is
+// placed at last_checked + interval so restarts and edits don't reset the clock.
+func ScheduleMonitor(id int) error {
+	var (
+		url            string
+		interval       string
+		customInterval sql.NullInt64
+		lastChecked    time.Time
+		monitorType    string
+		grace          sql.NullInt64
+		lastPing       time.Time
+	)
+	err := db.DB.QueryRow(
+		"SELECT url, `interval`, custom_interval, last_checked, type, heartbeat_grace, COALESCE(heartbeat_last_ping, created_at) FROM urls WHERE id = ?", id,
+	).Scan(&url, &interval, &customInterval, &lastChecked, &monitorType, &grace, &lastPing)
+	if err == sql.ErrNoRows {
+		UnscheduleMonitor(id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-		log.Printf("[%s Job] Checking URL: %s (ID: %d)", interval, url, id)
-		status, respTime, respCode, errMsg := checkURL(url)
+	schedMu.Lock()
+	defer schedMu.Unlock()
+	if scheduler == nil {
+		return nil
+	}
 
-		// Update URL status in urls table
-		_, err = db.DB.Exec(
-			"UPDATE urls SET status = ?, response_time = ?, last_checked = CURRENT_TIMESTAMP WHERE id = ?",
-			status, respTime, id,
-		)
-		if err != nil {
-			log.Printf("[%s Job] Error updating URL status for id %d: %v", interval, id, err)
-		}
+	every := CheckInterval(interval, customInterval)
+	next := lastChecked.Add(every)
+	if monitorType == TypeHeartbeat {
+		// The first run is the end of the window opened by the last ping.
+		next = lastPing.Add(heartbeatWindow(every, int(grace.Int64)))
+	}
+	startAt := gocron.WithStartImmediately()
+	if next.After(time.Now().Add(time.Second)) {
+		startAt = gocron.WithStartDateTime(next)
+	}
 
-		// Log the check result
-		_, err = db.DB.Exec(
-			"INSERT INTO logs (url_id, status, response_time, response_code, error_message) VALUES (?, ?, ?, ?, ?)",
-			id, status, respTime, respCode, errMsg,
-		)
-		if err != nil {
-			log.Printf("Error inserting log for url_id %d: %v", id, err)
-		} else {
-			successCount++
-			log.Printf("[%s Job] URL %s (ID: %d) is %s (responded in %dms with code %d)",
-				interval, url, id, status, respTime, respCode)
+	host := hostOf(url)
+	scheduler.RemoveByTags(monitorTag(id))
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(every),
+		gocron.NewTask(func() {
+			if !disableCornJob.Load() {
+				getPool().submit(id, host)
+			}
+		}),
+		gocron.WithTags(monitorTag(id)),
+		gocron.WithStartAt(startAt),
+	)
+	return err
+}
 
-		}
+// UnscheduleMonitor drops the job of a deleted monitor.
+func UnscheduleMonitor(id int) {
+	schedMu.Lock()
+	defer schedMu.Unlock()
+	if scheduler != nil {
+		scheduler.RemoveByTags(monitorTag(id))
 	}
-	elapsedTime := time.Since(startTime).Seconds()
-	log.Printf("[%s Job] Completed monitoring %d URLs in %.2f seconds (%d successful, %d failed)",
-		interval, urlCount, elapsedTime, successCount, failureCount)
 }
 
-// Helper to check URL status
-func checkURL(url string) (status string, respTime int, respCode int, errMsg sql.NullString) {
-	start := time.Now()
-
-	client := &http.Client{
-        Timeout: 30 * time.Second,
-    }
+// trackAndLogUrl runs one attempt of a monitor's check. It returns how long
+// to wait before the next attempt when the check failed with retries left,
+// 0 once the result is final.
+func trackAndLogUrl(id, attempt int) time.Duration {
+	m, err := LoadMonitor(id)
+	if err == sql.ErrNoRows {
+		UnscheduleMonitor(id)
+		return 0
+	}
+	if err != nil {
+		log.Printf("[Monitor %d] Error fetching URL: %v", id, err)
+		return 0
+	}
+	if m.MonitorType() == TypeHeartbeat {
+		checkHeartbeat(m)
+		return 0
+	}
+	url := m.URL
 
+	var (
+		current  string
+		failures int
+	)
+	err = db.DB.QueryRow("SELECT status, consecutive_failures FROM urls WHERE id = ?", id).Scan(&current, &failures)
+	if err != nil {
+		log.Printf("[Monitor %d] Error fetching URL status: %v", id, err)
+		return 0
+	}
 
-	resp, err := client.Get(url)
-	respTime = int(time.Since(start).Milliseconds())
+	log.Printf("[Monitor %d] Checking URL: %s", id, url)
+	res, retry := checkAttempt(m, attempt)
+	if retry {
+		return m.retryDelay()
+	}
+	timings := res.Timings
+	status, failures := confirmStatus(m, current, failures, &res)
 
+	// Update URL status in urls table
+	args := append([]any{status, failures, res.ResponseTime}, res.CertValues()...)
+	_, err = db.DB.Exec(
+		"UPDATE urls SET status = ?, consecutive_failures = ?, response_time = ?, last_checked = CURRENT_TIMESTAMP, "+
+			Assignments(CertColumns)+" WHERE id = ?",
+		append(args, id)...,
+	)
 	if err != nil {
-		status = "error"
-		errMsg = sql.NullString{String: err.Error(), Valid: true}
-		return
+		log.Printf("[Monitor %d] Error updating URL status: %v", id, err)
+	}
+	if res.Unconfirmed {
+		log.Printf("[Monitor %d] Failure %d of %d needed, status stays %s", id, failures, m.failureThreshold(), current)
+	} else if status != current {
+		log.Printf("[Monitor %d] Status changed from %s to %s", id, current, status)
+		notifyTransition(id, current, res)
 	}
-	defer resp.Body.Close()
 
-	respCode = resp.StatusCode
-	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
-		status = "online"
-	} else {
-		status = "offline"
+	if res.DNSAnswer != nil {
+		if err := SaveDNSAnswer(db.DB, id, res.DNSAnswer); err != nil {
+			log.Printf("[Monitor %d] Error saving DNS answer: %v", id, err)
+		}
 	}
-	errMsg = sql.NullString{Valid: false}
-	return
+
+	res.IncidentID = trackIncident(id, current, status, res)
+
+	// Log the check result
+	if err := InsertLog(db.DB, id, res); err != nil {
+		log.Printf("[Monitor %d] Error inserting log: %v", id, err)
+		return 0
+	}
+	log.Printf("[Monitor %d] URL %s is %s (responded in %dms with code %d; dns %dms, connect %dms, tls %dms, ttfb %dms, download %dms)",
+		id, url, res.Status, res.ResponseTime, res.ResponseCode,
+		timings.DNS, timings.Connect, timings.TLS, timings.TTFB, timings.Download)
+	return 0
+}
+
+// Execer is satisfied by both *sql.DB and *sql.Tx.
+type Execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// InsertLog writes one check result to logs.
+func InsertLog(exec Execer, urlID any, res CheckResult) error {
+	timings := res.Timings
+	_, err := exec.Exec(
+		"INSERT INTO logs (url_id, status, response_time, response_code, error_message, dns_time, connect_time, tls_time, ttfb_time, download_time, dns_answer, event, attempt, confirmed, incident_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		urlID, res.Status, res.ResponseTime, res.ResponseCode, res.ErrorMessage,
+		timings.DNS, timings.Connect, timings.TLS, timings.TTFB, timings.Download, EncodeAnswer(res.DNSAnswer),
+		sql.NullString{String: res.Event, Valid: res.Event != ""},
+		max(res.Attempt, 1), !res.Unconfirmed,
+		sql.NullInt64{Int64: int64(res.IncidentID), Valid: res.IncidentID > 0},
+	)
+	return err
+}
+
+// SaveDNSAnswer stores the answer the next dns check is compared against.
+func SaveDNSAnswer(exec Execer, urlID any, answer []string) error {
+	_, err := exec.Exec("UPDATE urls SET dns_answer = ? WHERE id = ?", EncodeAnswer(answer), urlID)
+	return err
 }
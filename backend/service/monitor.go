@@ -0,0 +1,262 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+// Monitor is the check configuration stored on a row of urls.
+type Monitor struct {
+	ID  int
+	URL string
+	// Type is "http", "tcp", "dns" or "heartbeat".
+	Type         string
+	ContentRules []ContentRule
+	MaxBodyBytes int
+	// JSONAssertions turn the monitor into an API monitor: the body must be
+	// JSON and satisfy every assertion.
+	JSONAssertions []JSONAssertion
+	Method         string
+	Headers        map[string]string
+	Body           string
+	// AcceptedStatuses is a list of codes and ranges such as "200-299,401".
+	AcceptedStatuses string
+	// Payload is written after a TCP connect; ExpectBanner must prefix the reply.
+	Payload      string
+	ExpectBanner string
+	// CertExpiryDays turns a check into a warning once the certificate expires
+	// within that many days, 0 means DefaultCertExpiryDays.
+	CertExpiryDays int
+	// DNSRecordType is resolved against DNSResolver (host:port, empty for the
+	// system resolver). With DNSExpected set the answer must match it,
+	// otherwise it must match DNSPrevious, the answer of the last check.
+	DNSRecordType string
+	DNSResolver   string
+	DNSExpected   []string
+	DNSPrevious   []string
+	// HeartbeatToken is the secret part of the ping URL. A heartbeat goes
+	// offline when no ping arrives within the check interval plus
+	// HeartbeatGrace seconds of HeartbeatLastPing.
+	HeartbeatToken    string
+	HeartbeatGrace    int
+	HeartbeatLastPing sql.NullTime
+	// RetryCount failed attempts are retried RetryDelay seconds apart, and
+	// FailureThreshold failed checks in a row are needed to change the status.
+	RetryCount       int
+	RetryDelay       int
+	FailureThreshold int
+	// Channels are the ids of the notification channels alerted on status changes.
+	Channels []int
+}
+
+const (
+	TypeHTTP = "http"
+	TypeTCP  = "tcp"
+	TypeDNS  = "dns"
+	// TypeHeartbeat monitors are pushed to by the job instead of being probed.
+	TypeHeartbeat = "heartbeat"
+)
+
+// ConfigColumns are the urls columns written from a Monitor's check settings,
+// in the order returned by ConfigValues.
+var ConfigColumns = []string{
+	"type", "content_rules", "max_body_bytes", "json_assertions",
+	"method", "request_headers", "request_body", "accepted_statuses",
+	"tcp_payload", "tcp_expect_banner", "cert_expiry_days",
+	"dns_record_type", "dns_resolver", "dns_expected",
+	"heartbeat_token", "heartbeat_grace",
+	"retry_count", "retry_delay", "failure_threshold",
+	"notification_channels",
+}
+
+// ConfigValues returns the column values matching ConfigColumns.
+func (m Monitor) ConfigValues() []any {
+	return []any{
+		m.MonitorType(),
+		EncodeContentRules(m.ContentRules),
+		sql.NullInt64{Int64: int64(m.MaxBodyBytes), Valid: m.MaxBodyBytes > 0},
+		EncodeJSONAssertions(m.JSONAssertions),
+		m.method(),
+		encodeHeaders(m.Headers),
+		sql.NullString{String: m.Body, Valid: m.Body != ""},
+		sql.NullString{String: m.AcceptedStatuses, Valid: m.AcceptedStatuses != ""},
+		sql.NullString{String: m.Payload, Valid: m.Payload != ""},
+		sql.NullString{String: m.ExpectBanner, Valid: m.ExpectBanner != ""},
+		sql.NullInt64{Int64: int64(m.CertExpiryDays), Valid: m.CertExpiryDays > 0},
+		sql.NullString{String: m.dnsRecordType(), Valid: m.MonitorType() == TypeDNS},
+		sql.NullString{String: m.DNSResolver, Valid: m.DNSResolver != ""},
+		EncodeAnswer(nonEmpty(m.DNSExpected)),
+		sql.NullString{String: m.HeartbeatToken, Valid: m.HeartbeatToken != ""},
+		sql.NullInt64{Int64: int64(m.HeartbeatGrace), Valid: m.MonitorType() == TypeHeartbeat},
+		m.RetryCount,
+		sql.NullInt64{Int64: int64(m.RetryDelay), Valid: m.RetryDelay > 0},
+		sql.NullInt64{Int64: int64(m.FailureThreshold), Valid: m.FailureThreshold > 0},
+		EncodeChannelIDs(m.Channels),
+	}
+}
+
+// Assignments renders "col = ?, ..." for an UPDATE of the given columns.
+func Assignments(columns []string) string {
+	parts := make([]string, len(columns))
+	for i, col := range columns {
+		parts[i] = col + " = ?"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// MonitorColumns is the SELECT list read by MonitorRow.Dest.
+const MonitorColumns = "id, url, type, content_rules, max_body_bytes, json_assertions, method, request_headers, request_body, accepted_statuses, tcp_payload, tcp_expect_banner, cert_expiry_days, dns_record_type, dns_resolver, dns_expected, dns_answer, heartbeat_token, heartbeat_grace, heartbeat_last_ping, retry_count, retry_delay, failure_threshold, notification_channels"
+
+// MonitorRow holds the raw columns of a Monitor while scanning.
+type MonitorRow struct {
+	m                Monitor
+	monitorType      sql.NullString
+	contentRules     sql.NullString
+	maxBodyBytes     sql.NullInt64
+	jsonAssertions   sql.NullString
+	method           sql.NullString
+	headers          sql.NullString
+	body             sql.NullString
+	acceptedStatuses sql.NullString
+	payload          sql.NullString
+	expectBanner     sql.NullString
+	certExpiryDays   sql.NullInt64
+	dnsRecordType    sql.NullString
+	dnsResolver      sql.NullString
+	dnsExpected      sql.NullString
+	dnsAnswer        sql.NullString
+	heartbeatToken   sql.NullString
+	heartbeatGrace   sql.NullInt64
+	retryDelay       sql.NullInt64
+	failureThreshold sql.NullInt64
+	channels         sql.NullString
+}
+
+// Dest returns scan targets in MonitorColumns order.
+func (r *MonitorRow) Dest() []any {
+	return []any{
+		&r.m.ID, &r.m.URL, &r.monitorType, &r.contentRules, &r.maxBodyBytes, &r.jsonAssertions,
+		&r.method, &r.headers, &r.body, &r.acceptedStatuses, &r.payload, &r.expectBanner, &r.certExpiryDays,
+		&r.dnsRecordType, &r.dnsResolver, &r.dnsExpected, &r.dnsAnswer,
+		&r.heartbeatToken, &r.heartbeatGrace, &r.m.HeartbeatLastPing,
+		&r.m.RetryCount, &r.retryDelay, &r.failureThreshold, &r.channels,
+	}
+}
+
+// Monitor decodes the scanned columns.
+func (r *MonitorRow) Monitor() Monitor {
+	m := r.m
+	m.Type = r.monitorType.String
+	m.ContentRules = DecodeContentRules(r.contentRules)
+	m.MaxBodyBytes = int(r.maxBodyBytes.Int64)
+	m.JSONAssertions = DecodeJSONAssertions(r.jsonAssertions)
+	m.Method = r.method.String
+	m.Headers = decodeHeaders(r.headers)
+	m.Body = r.body.String
+	m.AcceptedStatuses = r.acceptedStatuses.String
+	m.Payload = r.payload.String
+	m.ExpectBanner = r.expectBanner.String
+	m.CertExpiryDays = int(r.certExpiryDays.Int64)
+	m.DNSRecordType = r.dnsRecordType.String
+	m.DNSResolver = r.dnsResolver.String
+	m.DNSExpected = DecodeAnswer(r.dnsExpected)
+	m.DNSPrevious = DecodeAnswer(r.dnsAnswer)
+	m.HeartbeatToken = r.heartbeatToken.String
+	m.HeartbeatGrace = int(r.heartbeatGrace.Int64)
+	m.RetryDelay = int(r.retryDelay.Int64)
+	m.FailureThreshold = int(r.failureThreshold.Int64)
+	m.Channels = DecodeChannelIDs(r.channels)
+	return m
+}
+
+// LoadMonitor reads the check configuration of a single url.
+func LoadMonitor(id int) (Monitor, error) {
+	var row MonitorRow
+	err := db.DB.QueryRow("SELECT "+MonitorColumns+" FROM urls WHERE id = ?", id).Scan(row.Dest()...)
+	if err != nil {
+		return Monitor{}, err
+	}
+	return row.Monitor(), nil
+}
+
+// MonitorType returns the type, defaulting rows created before types existed to http.
+func (m Monitor) MonitorType() string {
+	if m.Type == "" {
+		return TypeHTTP
+	}
+	return m.Type
+}
+
+func (m Monitor) certExpiryDays() int {
+	if m.CertExpiryDays <= 0 {
+		return DefaultCertExpiryDays
+	}
+	return m.CertExpiryDays
+}
+
+func (m Monitor) dnsRecordType() string {
+	if m.DNSRecordType == "" {
+		return "A"
+	}
+	return strings.ToUpper(m.DNSRecordType)
+}
+
+func (m Monitor) hasHTTPSettings() bool {
+	return len(m.ContentRules) > 0 || len(m.JSONAssertions) > 0 || m.Body != "" || len(m.Headers) > 0 ||
+		m.CertExpiryDays > 0 || m.AcceptedStatuses != "" || m.MaxBodyBytes > 0 || (m.Method != "" && m.method() != "GET")
+}
+
+func (m Monitor) hasTCPSettings() bool {
+	return m.Payload != "" || m.ExpectBanner != ""
+}
+
+func (m Monitor) hasDNSSettings() bool {
+	return m.DNSRecordType != "" || m.DNSResolver != "" || len(m.DNSExpected) > 0
+}
+
+func (m Monitor) hasRetrySettings() bool {
+	return m.RetryCount > 0 || m.RetryDelay > 0 || m.FailureThreshold > 1
+}
+
+func (m Monitor) hasHeartbeatSettings() bool {
+	return m.HeartbeatGrace > 0
+}
+
+func (m Monitor) method() string {
+	if m.Method == "" {
+		return "GET"
+	}
+	return strings.ToUpper(m.Method)
+}
+
+func nonEmpty(list []string) []string {
+	if len(list) == 0 {
+		return nil
+	}
+	return list
+}
+
+func encodeHeaders(headers map[string]string) sql.NullString {
+	if len(headers) == 0 {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(headers)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+func decodeHeaders(raw sql.NullString) map[string]string {
+	if !raw.Valid || raw.String == "" {
+		return nil
+	}
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(raw.String), &headers); err != nil {
+		return nil
+	}
+	return headers
+}
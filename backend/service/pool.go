@@ -0,0 +1,270 @@
+package service
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PoolStats is a snapshot of the check pool used to watch for backpressure.
+type PoolStats struct {
+	Workers      int     `json:"workers"`
+	MaxPerHost   int     `json:"max_per_host"`
+	QueueSize    int     `json:"queue_size"`
+	Queued       int     `json:"queued"`
+	Parked       int     `json:"parked"`
+	InFlight     int     `json:"in_flight"`
+	Completed    int64   `json:"completed"`
+	Coalesced    int64   `json:"coalesced"`
+	Rejected     int64   `json:"rejected"`
+	AvgWaitMs    float64 `json:"avg_wait_ms"`
+	MaxWaitMs    int64   `json:"max_wait_ms"`
+	AvgRunMs     float64 `json:"avg_run_ms"`
+	BusiestHost  string  `json:"busiest_host,omitempty"`
+	BusiestHostN int     `json:"busiest_host_pending,omitempty"`
+}
+
+type checkJob struct {
+	id       int
+	host     string
+	queuedAt time.Time
+	// attempt counts from 1, retries of a failed check are queued again.
+	attempt int
+}
+
+// checkPool runs monitor checks on a fixed number of workers. Each host is
+// capped at maxPerHost concurrent checks; jobs for a saturated host are parked
+// and picked up by whichever worker frees a slot for that host, so one hung
+// host can only ever tie up maxPerHost workers.
+type checkPool struct {
+	workers       int
+	maxPerHost    int
+	queueSize     int
+	submitTimeout time.Duration
+	jobs          chan checkJob
+	// check runs one attempt, see trackAndLogUrl.
+	check func(id, attempt int) time.Duration
+
+	mu        sync.Mutex
+	pending   map[int]bool
+	hostBusy  map[string]int
+	parked    map[string][]checkJob
+	nParked   int
+	completed int64
+	coalesced int64
+	rejected  int64
+	waitTotal time.Duration
+	waitMax   time.Duration
+	runTotal  time.Duration
+}
+
+var (
+	pool     *checkPool
+	poolOnce sync.Once
+)
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
+
+func getPool() *checkPool {
+	poolOnce.Do(func() {
+		pool = newCheckPool(
+			envInt("CHECK_WORKERS", 50),
+			envInt("CHECK_MAX_PER_HOST", 4),
+			envInt("CHECK_QUEUE_SIZE", 1000),
+			trackAndLogUrl,
+		)
+		log.Printf("Check pool started with %d workers (%d per host, queue %d).",
+			pool.workers, pool.maxPerHost, pool.queueSize)
+	})
+	return pool
+}
+
+// newCheckPool starts the workers of a pool that runs check for every job.
+func newCheckPool(workers, maxPerHost, queueSize int, check func(id, attempt int) time.Duration) *checkPool {
+	p := &checkPool{
+		workers:       workers,
+		maxPerHost:    maxPerHost,
+		queueSize:     queueSize,
+		submitTimeout: 5 * time.Second,
+		jobs:          make(chan checkJob, queueSize),
+		check:         check,
+		pending:       map[int]bool{},
+		hostBusy:      map[string]int{},
+		parked:        map[string][]checkJob{},
+	}
+	for i := 0; i < p.workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+// hostOf returns the key used for per-host limits.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// submit enqueues a check. A monitor that is already queued or running is
+// coalesced instead of queued twice. When the queue stays full for longer than
+// submitTimeout the check is rejected; the scheduler will try again next tick.
+func (p *checkPool) submit(id int, host string) bool {
+	p.mu.Lock()
+	if p.pending[id] {
+		p.coalesced++
+		p.mu.Unlock()
+		return false
+	}
+	p.pending[id] = true
+	p.mu.Unlock()
+
+	return p.enqueue(checkJob{id: id, host: host, queuedAt: time.Now(), attempt: 1})
+}
+
+// enqueue queues a job of a monitor already marked pending.
+func (p *checkPool) enqueue(job checkJob) bool {
+	select {
+	case p.jobs <- job:
+		return true
+	case <-time.After(p.submitTimeout):
+		p.mu.Lock()
+		delete(p.pending, job.id)
+		p.rejected++
+		p.mu.Unlock()
+		log.Printf("[Monitor %d] Check rejected: queue full (%d)", job.id, p.queueSize)
+		return false
+	}
+}
+
+// retry queues the next attempt of a failed check. The monitor stays
+// pending while it waits, so scheduled checks coalesce into the retry.
+func (p *checkPool) retry(job checkJob) {
+	if disableCornJob.Load() {
+		p.mu.Lock()
+		delete(p.pending, job.id)
+		p.mu.Unlock()
+		return
+	}
+	job.queuedAt = time.Now()
+	p.enqueue(job)
+}
+
+func (p *checkPool) worker() {
+	for job := range p.jobs {
+		if !p.acquireHost(job) {
+			continue
+		}
+		for {
+			p.run(job)
+			next, ok := p.releaseHost(job.host)
+			if !ok {
+				break
+			}
+			job = next
+		}
+	}
+}
+
+// acquireHost takes a slot for the job's host or parks the job.
+func (p *checkPool) acquireHost(job checkJob) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.hostBusy[job.host] < p.maxPerHost {
+		p.hostBusy[job.host]++
+		return true
+	}
+	p.parked[job.host] = append(p.parked[job.host], job)
+	p.nParked++
+	return false
+}
+
+// releaseHost hands the slot to the next parked job of the same host, if any.
+func (p *checkPool) releaseHost(host string) (checkJob, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if waiting := p.parked[host]; len(waiting) > 0 {
+		next := waiting[0]
+		if len(waiting) == 1 {
+			delete(p.parked, host)
+		} else {
+			p.parked[host] = waiting[1:]
+		}
+		p.nParked--
+		return next, true
+	}
+	p.hostBusy[host]--
+	if p.hostBusy[host] <= 0 {
+		delete(p.hostBusy, host)
+	}
+	return checkJob{}, false
+}
+
+func (p *checkPool) run(job checkJob) {
+	started := time.Now()
+	wait := started.Sub(job.queuedAt)
+
+	retryIn := p.check(job.id, job.attempt)
+
+	p.mu.Lock()
+	if retryIn == 0 {
+		delete(p.pending, job.id)
+	}
+	p.completed++
+	p.waitTotal += wait
+	if wait > p.waitMax {
+		p.waitMax = wait
+	}
+	p.runTotal += time.Since(started)
+	p.mu.Unlock()
+
+	if retryIn > 0 {
+		next := checkJob{id: job.id, host: job.host, attempt: job.attempt + 1}
+		time.AfterFunc(retryIn, func() { p.retry(next) })
+	}
+}
+
+func (p *checkPool) stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := PoolStats{
+		Workers:    p.workers,
+		MaxPerHost: p.maxPerHost,
+		QueueSize:  p.queueSize,
+		Queued:     len(p.jobs),
+		Parked:     p.nParked,
+		Completed:  p.completed,
+		Coalesced:  p.coalesced,
+		Rejected:   p.rejected,
+		MaxWaitMs:  p.waitMax.Milliseconds(),
+	}
+	for _, n := range p.hostBusy {
+		s.InFlight += n
+	}
+	if p.completed > 0 {
+		s.AvgWaitMs = float64(p.waitTotal.Milliseconds()) / float64(p.completed)
+		s.AvgRunMs = float64(p.runTotal.Milliseconds()) / float64(p.completed)
+	}
+	for host, waiting := range p.parked {
+		if len(waiting) > s.BusiestHostN {
+			s.BusiestHost, s.BusiestHostN = host, len(waiting)
+		}
+	}
+	return s
+}
+
+// CheckPoolStats exposes the pool metrics.
+func CheckPoolStats() PoolStats {
+	return getPool().stats()
+}
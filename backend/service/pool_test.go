@@ -0,0 +1,177 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// heldChecks stands in for trackAndLogUrl. Every check reports its monitor
+// on started and runs until the test finishes it.
+type heldChecks struct {
+	started chan int
+	mu      sync.Mutex
+	gates   map[int]chan struct{}
+}
+
+func newHeldChecks() *heldChecks {
+	return &heldChecks{started: make(chan int, 100), gates: map[int]chan struct{}{}}
+}
+
+func (h *heldChecks) gate(id int) chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.gates[id] == nil {
+		h.gates[id] = make(chan struct{}, 10)
+	}
+	return h.gates[id]
+}
+
+func (h *heldChecks) check(id, attempt int) time.Duration {
+	h.started <- id
+	<-h.gate(id)
+	return 0
+}
+
+// finish lets the running check of monitor id return.
+func (h *heldChecks) finish(id int) {
+	h.gate(id) <- struct{}{}
+}
+
+// next waits for a check to start and returns its monitor.
+func (h *heldChecks) next(t *testing.T) int {
+	t.Helper()
+	select {
+	case id := <-h.started:
+		return id
+	case <-time.After(5 * time.Second):
+		t.Fatal("no check started")
+		return 0
+	}
+}
+
+// idle fails when a check starts within a short while.
+func (h *heldChecks) idle(t *testing.T) {
+	t.Helper()
+	select {
+	case id := <-h.started:
+		t.Fatalf("check of monitor %d started", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func waitForStats(t *testing.T, p *checkPool, ok func(PoolStats) bool) PoolStats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s := p.stats()
+		if ok(s) {
+			return s
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pool stats stayed at %+v", s)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCheckPoolParksBusyHosts(t *testing.T) {
+	held := newHeldChecks()
+	p := newCheckPool(4, 2, 10, held.check)
+
+	for id := 1; id <= 4; id++ {
+		p.submit(id, "a.example.com")
+	}
+	running := []int{held.next(t), held.next(t)}
+	s := waitForStats(t, p, func(s PoolStats) bool { return s.Parked == 2 })
+	if s.InFlight != 2 || s.BusiestHost != "a.example.com" || s.BusiestHostN != 2 {
+		t.Errorf("stats = %+v, want 2 checks of a.example.com running and 2 parked", s)
+	}
+	held.idle(t)
+
+	// Another host isn't held up by the parked checks.
+	p.submit(5, "b.example.com")
+	if id := held.next(t); id != 5 {
+		t.Fatalf("monitor %d started, want 5", id)
+	}
+	held.finish(5)
+	held.idle(t)
+
+	// Each finished check of a host hands its slot to a parked one.
+	for _, id := range running {
+		held.finish(id)
+		running = append(running, held.next(t))
+	}
+	held.idle(t)
+	held.finish(running[2])
+	held.finish(running[3])
+	s = waitForStats(t, p, func(s PoolStats) bool { return s.Completed == 5 })
+	if s.InFlight != 0 || s.Parked != 0 || s.BusiestHost != "" {
+		t.Errorf("stats = %+v, want an idle pool", s)
+	}
+}
+
+func TestCheckPoolCoalescesPendingMonitors(t *testing.T) {
+	held := newHeldChecks()
+	p := newCheckPool(1, 4, 10, held.check)
+
+	if !p.submit(1, "a.example.com") {
+		t.Fatal("first submit wasn't queued")
+	}
+	held.next(t)
+	// Monitor 1 is running and monitor 2 is waiting in the queue.
+	p.submit(2, "a.example.com")
+	if p.submit(1, "a.example.com") || p.submit(2, "a.example.com") {
+		t.Error("a pending monitor was queued twice")
+	}
+	if s := p.stats(); s.Coalesced != 2 || s.Queued != 1 {
+		t.Errorf("stats = %+v, want 2 coalesced and 1 queued", s)
+	}
+
+	held.finish(1)
+	if id := held.next(t); id != 2 {
+		t.Fatalf("monitor %d started, want 2", id)
+	}
+	held.finish(2)
+	waitForStats(t, p, func(s PoolStats) bool { return s.Completed == 2 && s.InFlight == 0 })
+
+	// Once its check is done the monitor can be queued again.
+	if !p.submit(1, "a.example.com") {
+		t.Error("finished monitor wasn't queued again")
+	}
+	held.next(t)
+	held.finish(1)
+}
+
+func TestCheckPoolRejectsWhenQueueIsFull(t *testing.T) {
+	held := newHeldChecks()
+	p := newCheckPool(1, 4, 1, held.check)
+	p.submitTimeout = 20 * time.Millisecond
+
+	p.submit(1, "a.example.com")
+	held.next(t)
+	if !p.submit(2, "a.example.com") {
+		t.Fatal("submit into the free queue slot failed")
+	}
+
+	started := time.Now()
+	if p.submit(3, "b.example.com") {
+		t.Fatal("submit into a full queue succeeded")
+	}
+	if waited := time.Since(started); waited < p.submitTimeout {
+		t.Errorf("submit gave up after %s, want at least %s", waited, p.submitTimeout)
+	}
+	if s := p.stats(); s.Rejected != 1 || s.Queued != 1 {
+		t.Errorf("stats = %+v, want 1 rejected and 1 queued", s)
+	}
+
+	// A rejected monitor isn't left pending, the next tick can queue it.
+	held.finish(1)
+	held.next(t)
+	if !p.submit(3, "b.example.com") {
+		t.Error("rejected monitor couldn't be queued again")
+	}
+	held.finish(2)
+	held.next(t)
+	held.finish(3)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+// Retry policy limits. Retries delay confirming a failure, so both are kept
+// small.
+const (
+	MaxRetryCount       = 5
+	MaxRetryDelay       = 60
+	MaxFailureThreshold = 10
+	DefaultRetryDelay   = 5
+)
+
+func validateRetry(m Monitor) error {
+	if m.RetryCount < 0 || m.RetryCount > MaxRetryCount {
+		return fmt.Errorf("retry_count must be between 0 and %d", MaxRetryCount)
+	}
+	if m.RetryDelay < 0 || m.RetryDelay > MaxRetryDelay {
+		return fmt.Errorf("retry_delay must be between 0 and %d seconds", MaxRetryDelay)
+	}
+	if m.FailureThreshold < 0 || m.FailureThreshold > MaxFailureThreshold {
+		return fmt.Errorf("failure_threshold must be between 0 and %d (0 uses the default)", MaxFailureThreshold)
+	}
+	return nil
+}
+
+// healthy reports whether a result counts as up. Warnings are still up.
+func (r CheckResult) healthy() bool {
+	return r.Status == "online" || r.Status == "warning"
+}
+
+func (m Monitor) retryDelay() time.Duration {
+	if m.RetryDelay <= 0 {
+		return DefaultRetryDelay * time.Second
+	}
+	return time.Duration(m.RetryDelay) * time.Second
+}
+
+func (m Monitor) failureThreshold() int {
+	if m.FailureThreshold <= 0 {
+		return 1
+	}
+	return m.FailureThreshold
+}
+
+// checkAttempt runs one attempt of the check. A failure with retries left
+// is logged as unconfirmed right away and reported with retry set; the pool
+// queues the next attempt after retryDelay instead of holding a worker. Any
+// other result is returned not yet logged.
+func checkAttempt(m Monitor, attempt int) (res CheckResult, retry bool) {
+	res = CheckMonitor(m)
+	res.Attempt = attempt
+	if res.healthy() || attempt > m.RetryCount {
+		return res, false
+	}
+
+	res.Unconfirmed = true
+	if err := InsertLog(db.DB, m.ID, res); err != nil {
+		log.Printf("[Monitor %d] Error inserting log: %v", m.ID, err)
+	}
+	log.Printf("[Monitor %d] Attempt %d of %d is %s (%s), retrying in %s",
+		m.ID, attempt, m.RetryCount+1, res.Status, res.ErrorMessage.String, m.retryDelay())
+	return res, true
+}
+
+// confirmStatus decides the status to store after a check. Failures only
+// replace the current status once FailureThreshold of them happened in a
+// row; until then the result is logged as unconfirmed.
+func confirmStatus(m Monitor, current string, failures int, res *CheckResult) (status string, newFailures int) {
+	if res.healthy() {
+		return res.Status, 0
+	}
+	newFailures = failures + 1
+	if newFailures < m.failureThreshold() {
+		res.Unconfirmed = true
+		return current, newFailures
+	}
+	return res.Status, newFailures
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+// checkLog is a database/sql driver that only accepts the INSERTs of
+// InsertLog and keeps their attempt and confirmed columns.
+type checkLog struct {
+	mu      sync.Mutex
+	entries []loggedCheck
+}
+
+type loggedCheck struct {
+	attempt   int64
+	confirmed bool
+}
+
+func (l *checkLog) Open(string) (driver.Conn, error) { return checkLogConn{l}, nil }
+
+type checkLogConn struct{ log *checkLog }
+
+func (c checkLogConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c checkLogConn) Close() error                        { return nil }
+func (c checkLogConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c checkLogConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if !strings.HasPrefix(query, "INSERT INTO logs") {
+		return nil, errors.New("unexpected query: " + query)
+	}
+	c.log.mu.Lock()
+	defer c.log.mu.Unlock()
+	c.log.entries = append(c.log.entries, loggedCheck{args[12].Value.(int64), args[13].Value.(bool)})
+	return driver.RowsAffected(1), nil
+}
+
+var (
+	checkLogs       = &checkLog{}
+	registerLogging sync.Once
+)
+
+// useCheckLog points db.DB at checkLog for the duration of a test.
+func useCheckLog(t *testing.T) *checkLog {
+	registerLogging.Do(func() { sql.Register("check-logs", checkLogs) })
+	conn, err := sql.Open("check-logs", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := db.DB
+	db.DB = conn
+	checkLogs.mu.Lock()
+	checkLogs.entries = nil
+	checkLogs.mu.Unlock()
+	t.Cleanup(func() {
+		db.DB = previous
+		conn.Close()
+	})
+	return checkLogs
+}
+
+// statusServer answers every request with the status it's currently set to.
+func statusServer(t *testing.T, status int) (*httptest.Server, *atomic.Int64) {
+	var current atomic.Int64
+	current.Store(int64(status))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(current.Load()))
+	}))
+	t.Cleanup(server.Close)
+	return server, &current
+}
+
+func TestCheckAttemptRetriesFailures(t *testing.T) {
+	logged := useCheckLog(t)
+	server, _ := statusServer(t, http.StatusServiceUnavailable)
+	m := Monitor{ID: 3, URL: server.URL, RetryCount: 2}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		res, retry := checkAttempt(m, attempt)
+		if !retry || !res.Unconfirmed || res.Attempt != attempt || res.healthy() {
+			t.Fatalf("attempt %d = %s, retry %v, unconfirmed %v, want an unconfirmed failure to retry",
+				attempt, res.Status, retry, res.Unconfirmed)
+		}
+	}
+	// The last attempt is final and left to the caller to log.
+	res, retry := checkAttempt(m, 3)
+	if retry || res.Unconfirmed || res.Attempt != 3 {
+		t.Errorf("attempt 3 = %s, retry %v, unconfirmed %v, want a final failure", res.Status, retry, res.Unconfirmed)
+	}
+
+	want := []loggedCheck{{1, false}, {2, false}}
+	if len(logged.entries) != len(want) || logged.entries[0] != want[0] || logged.entries[1] != want[1] {
+		t.Errorf("logged %+v, want %+v", logged.entries, want)
+	}
+}
+
+func TestCheckAttemptDoesNotRetrySuccess(t *testing.T) {
+	logged := useCheckLog(t)
+	server, status := statusServer(t, http.StatusOK)
+	m := Monitor{ID: 3, URL: server.URL, RetryCount: 2}
+
+	if res, retry := checkAttempt(m, 1); retry || res.Unconfirmed || !res.healthy() {
+		t.Errorf("healthy check = %s, retry %v, unconfirmed %v", res.Status, retry, res.Unconfirmed)
+	}
+	// Without retries the first failure is already final.
+	status.Store(http.StatusBadGateway)
+	m.RetryCount = 0
+	if res, retry := checkAttempt(m, 1); retry || res.Unconfirmed || res.healthy() {
+		t.Errorf("failure without retries = %s, retry %v, unconfirmed %v", res.Status, retry, res.Unconfirmed)
+	}
+	if len(logged.entries) != 0 {
+		t.Errorf("logged %+v, want nothing", logged.entries)
+	}
+}
+
+func TestConfirmStatus(t *testing.T) {
+	m := Monitor{FailureThreshold: 3}
+	failures := 0
+	for i := 1; i <= 2; i++ {
+		res := CheckResult{Status: "offline"}
+		var status string
+		status, failures = confirmStatus(m, "online", failures, &res)
+		if status != "online" || failures != i || !res.Unconfirmed {
+			t.Fatalf("failure %d gave %s after %d failures (unconfirmed %v), want online and unconfirmed",
+				i, status, failures, res.Unconfirmed)
+		}
+	}
+
+	res := CheckResult{Status: "offline"}
+	status, failures := confirmStatus(m, "online", failures, &res)
+	if status != "offline" || failures != 3 || res.Unconfirmed {
+		t.Errorf("third failure gave %s after %d failures (unconfirmed %v), want confirmed offline",
+			status, failures, res.Unconfirmed)
+	}
+
+	// A healthy check resets the count, warnings included.
+	res = CheckResult{Status: "warning"}
+	if status, failures := confirmStatus(m, "offline", failures, &res); status != "warning" || failures != 0 {
+		t.Errorf("warning gave %s after %d failures, want warning and 0", status, failures)
+	}
+}
+
+func TestConfirmStatusDefaultThreshold(t *testing.T) {
+	res := CheckResult{Status: "error"}
+	status, failures := confirmStatus(Monitor{}, "online", 0, &res)
+	if status != "error" || failures != 1 || res.Unconfirmed {
+		t.Errorf("first failure gave %s after %d failures (unconfirmed %v), want it confirmed", status, failures, res.Unconfirmed)
+	}
+}
+
+func TestFailureThreshold(t *testing.T) {
+	for threshold, want := range map[int]int{-1: 1, 0: 1, 1: 1, 4: 4, MaxFailureThreshold: MaxFailureThreshold} {
+		if got := (Monitor{FailureThreshold: threshold}).failureThreshold(); got != want {
+			t.Errorf("failureThreshold(%d) = %d, want %d", threshold, got, want)
+		}
+	}
+}
+
+func TestValidateRetry(t *testing.T) {
+	for _, m := range []Monitor{{}, {RetryCount: MaxRetryCount, RetryDelay: MaxRetryDelay, FailureThreshold: MaxFailureThreshold}} {
+		if err := validateRetry(m); err != nil {
+			t.Errorf("validateRetry(%+v) failed: %v", m, err)
+		}
+	}
+	err := validateRetry(Monitor{FailureThreshold: MaxFailureThreshold + 1})
+	if err == nil || err.Error() != "failure_threshold must be between 0 and 10 (0 uses the default)" {
+		t.Errorf("validateRetry with threshold 11 = %v", err)
+	}
+	for _, m := range []Monitor{{RetryCount: -1}, {RetryCount: MaxRetryCount + 1}, {RetryDelay: MaxRetryDelay + 1}, {FailureThreshold: -1}} {
+		if err := validateRetry(m); err == nil {
+			t.Errorf("validateRetry(%+v) succeeded, want an error", m)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package service
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+// RollupLevel is an aggregate table of logs, one row per monitor and bucket.
+type RollupLevel struct {
+	Table  string
+	Bucket string
+	// MaxPerRun caps how many buckets one compaction fills in, so catching up
+	// on a large backlog is spread over several runs.
+	MaxPerRun int
+}
+
+var (
+	HourlyRollup = RollupLevel{Table: "log_rollups_hourly", Bucket: BucketHour, MaxPerRun: 24 * 7}
+	DailyRollup  = RollupLevel{Table: "log_rollups_daily", Bucket: BucketDay, MaxPerRun: 31}
+)
+
+// RollupLevels are filled in this order on every compaction.
+var RollupLevels = []RollupLevel{HourlyRollup, DailyRollup}
+
+// CompactionInterval is how often logs are rolled up and expired.
+const CompactionInterval = time.Hour
+
+// rollupDelay leaves checks that are still running at the end of a bucket
+// time to be logged before the bucket is aggregated.
+const rollupDelay = 2 * time.Minute
+
+// retentionBatch is how many rows one DELETE removes, to keep locks short.
+const retentionBatch = 5000
+
+// User tiers, see users.tier.
+const (
+	TierFree    = "free"
+	TierPremium = "premium"
+)
+
+var Tiers = []string{TierFree, TierPremium}
+
+// Retention is how many days each granularity is kept; 0 keeps it forever.
+type Retention struct {
+	Raw    int
+	Hourly int
+	Daily  int
+}
+
+// Default retention per tier. Raw days can be changed with
+// LOG_RETENTION_FREE_DAYS and LOG_RETENTION_PREMIUM_DAYS.
+var tierRetention = map[string]Retention{
+	TierFree:    {Raw: 7, Hourly: 30, Daily: 365},
+	TierPremium: {Raw: 30, Hourly: 180, Daily: 0},
+}
+
+// RetentionFor returns the retention of a tier, unknown tiers get free's.
+func RetentionFor(tier string) Retention {
+	r, ok := tierRetention[tier]
+	if !ok {
+		tier, r = TierFree, tierRetention[TierFree]
+	}
+	env := "LOG_RETENTION_FREE_DAYS"
+	if tier == TierPremium {
+		env = "LOG_RETENTION_PREMIUM_DAYS"
+	}
+	if days, err := strconv.Atoi(os.Getenv(env)); err == nil && days > 0 {
+		r.Raw = days
+	}
+	return r
+}
+
+// LogRollup is the aggregate of one monitor over one bucket. Latency is
+// computed from the successful checks and is nil without any.
+type LogRollup struct {
+	BucketStart time.Time          `json:"bucket_start"`
+	Checks      int                `json:"checks"`
+	Failures    int                `json:"failures"`
+	Samples     int                `json:"samples"`
+	Latency     *ResponseTimeStats `json:"response_time"`
+}
+
+// Uptime is counted like the raw checks, nil without any.
+func (r LogRollup) Uptime() *float64 {
+	return uptimePercent(r.Checks, r.Failures)
+}
+
+// RollupColumns is the SELECT list read by ScanRollup.
+const RollupColumns = "bucket_start, checks, failures, samples, min_time, avg_time, p50_time, p90_time, p95_time, p99_time, max_time"
+
+// ScanRollup reads a row of RollupColumns.
+func ScanRollup(row interface{ Scan(...any) error }) (LogRollup, error) {
+	var (
+		r                                  LogRollup
+		min, avg, p50, p90, p95, p99, maxT sql.NullInt64
+	)
+	err := row.Scan(&r.BucketStart, &r.Checks, &r.Failures, &r.Samples, &min, &avg, &p50, &p90, &p95, &p99, &maxT)
+	if err == nil && r.Samples > 0 {
+		r.Latency = &ResponseTimeStats{
+			Min: int(min.Int64), Avg: int(avg.Int64),
+			P50: int(p50.Int64), P90: int(p90.Int64), P95: int(p95.Int64), P99: int(p99.Int64),
+			Max: int(maxT.Int64),
+		}
+	}
+	return r, err
+}
+
+// RolledUntil is the end of the last bucket aggregated into level, zero
+// before the first compaction. Raw logs are complete from there on.
+func RolledUntil(level RollupLevel) (time.Time, error) {
+	var until time.Time
+	err := db.DB.QueryRow("SELECT rolled_until FROM log_rollup_state WHERE level = ?", level.Bucket).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return until.UTC(), err
+}
+
+// rollupSpan splits [from, to) for readers: whole buckets in [rollFrom,
+// rollTo) come from the rollup table, everything else from raw logs.
+// rollFrom == rollTo when no rollup applies.
+func rollupSpan(level RollupLevel, from, to time.Time) (rollFrom, rollTo time.Time, err error) {
+	until, err := RolledUntil(level)
+	if err != nil {
+		return from, from, err
+	}
+	rollFrom = truncateBucket(from, level.Bucket)
+	if rollFrom.Before(from) {
+		rollFrom = nextBucket(rollFrom, level.Bucket)
+	}
+	rollTo = truncateBucket(to, level.Bucket)
+	if until.Before(rollTo) {
+		rollTo = until
+	}
+	if !rollTo.After(rollFrom) {
+		return from, from, nil
+	}
+	return rollFrom, rollTo, nil
+}
+
+var compactMu sync.Mutex
+
+// CompactLogs rolls completed hours and days of raw logs into the rollup
+// tables, then deletes logs and rollups past the retention of each tier.
+func CompactLogs() {
+	compactMu.Lock()
+	defer compactMu.Unlock()
+
+	now := time.Now().UTC()
+	for _, level := range RollupLevels {
+		if err := rollUp(level, now); err != nil {
+			log.Printf("Error rolling up logs by %s: %v", level.Bucket, err)
+			// Retention must not outrun the rollups.
+			return
+		}
+	}
+	if err := applyRetention(now); err != nil {
+		log.Printf("Error applying log retention: %v", err)
+	}
+}
+
+func rollUp(level RollupLevel, now time.Time) error {
+	start, err := RolledUntil(level)
+	if err != nil {
+		return err
+	}
+	if start.IsZero() {
+		var first sql.NullTime
+		if err := db.DB.QueryRow("SELECT MIN(checked_at) FROM logs").Scan(&first); err != nil {
+			return err
+		}
+		if !first.Valid {
+			return nil
+		}
+		start = truncateBucket(first.Time, level.Bucket)
+	}
+	// Buckets that every tier would expire right away aren't worth computing.
+	if keep := longestRetention(level); keep > 0 {
+		if oldest := truncateBucket(now.AddDate(0, 0, -keep), level.Bucket); start.Before(oldest) {
+			start = oldest
+		}
+	}
+
+	end := truncateBucket(now.Add(-rollupDelay), level.Bucket)
+	rolled := 0
+	for ; start.Before(end) && rolled < level.MaxPerRun; rolled++ {
+		next := nextBucket(start, level.Bucket)
+		if err := rollUpBucket(level, start, next); err != nil {
+			return err
+		}
+		start = next
+	}
+	if rolled > 0 {
+		log.Printf("Rolled up %d %s buckets of logs until %s", rolled, level.Bucket, start.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// rollUpBucket aggregates one bucket of every monitor and moves the
+// watermark past it in the same transaction.
+func rollUpBucket(level RollupLevel, start, end time.Time) error {
+	rows, err := db.DB.Query(
+		"SELECT url_id, response_time, status, confirmed FROM logs WHERE checked_at >= ? AND checked_at < ?",
+		start, end,
+	)
+	if err != nil {
+		return err
+	}
+	type acc struct {
+		checks, failures int
+		times            []int
+	}
+	monitors := map[int]*acc{}
+	for rows.Next() {
+		var (
+			urlID, responseTime int
+			status              string
+			confirmed           bool
+		)
+		if err := rows.Scan(&urlID, &responseTime, &status, &confirmed); err != nil {
+			rows.Close()
+			return err
+		}
+		a := monitors[urlID]
+		if a == nil {
+			a = &acc{}
+			monitors[urlID] = a
+		}
+		a.checks++
+		switch {
+		case confirmed && isDown(status):
+			a.failures++
+		case !isDown(status):
+			a.times = append(a.times, responseTime)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	for urlID, a := range monitors {
+		latency := responseTimeStats(a.times)
+		if latency == nil {
+			latency = &ResponseTimeStats{}
+		}
+		_, err := tx.Exec(
+			"INSERT INTO "+level.Table+" (url_id, bucket_start, checks, failures, samples, min_time, avg_time, p50_time, p90_time, p95_time, p99_time, max_time) "+
+				"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) "+
+				"ON DUPLICATE KEY UPDATE checks = VALUES(checks), failures = VALUES(failures), samples = VALUES(samples), "+
+				"min_time = VALUES(min_time), avg_time = VALUES(avg_time), p50_time = VALUES(p50_time), p90_time = VALUES(p90_time), "+
+				"p95_time = VALUES(p95_time), p99_time = VALUES(p99_time), max_time = VALUES(max_time)",
+			urlID, start, a.checks, a.failures, len(a.times),
+			latency.Min, latency.Avg, latency.P50, latency.P90, latency.P95, latency.P99, latency.Max,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	_, err = tx.Exec(
+		"INSERT INTO log_rollup_state (level, rolled_until) VALUES (?, ?) ON DUPLICATE KEY UPDATE rolled_until = VALUES(rolled_until)",
+		level.Bucket, end,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// longestRetention is the most days any tier keeps a level, 0 for forever.
+func longestRetention(level RollupLevel) int {
+	longest := 0
+	for _, tier := range Tiers {
+		r := RetentionFor(tier)
+		days := r.Hourly
+		if level == DailyRollup {
+			days = r.Daily
+		}
+		if days == 0 {
+			return 0
+		}
+		longest = max(longest, days)
+	}
+	return longest
+}
+
+func applyRetention(now time.Time) error {
+	// Raw logs are only deleted once both rollups have them.
+	rolled := now
+	for _, level := range RollupLevels {
+		until, err := RolledUntil(level)
+		if err != nil {
+			return err
+		}
+		if until.Before(rolled) {
+			rolled = until
+		}
+	}
+
+	for _, tier := range Tiers {
+		r := RetentionFor(tier)
+		if r.Raw > 0 {
+			cutoff := now.AddDate(0, 0, -r.Raw)
+			if rolled.Before(cutoff) {
+				cutoff = rolled
+			}
+			if err := deleteExpired("logs", "checked_at", tier, cutoff); err != nil {
+				return err
+			}
+		}
+		if r.Hourly > 0 {
+			if err := deleteExpired(HourlyRollup.Table, "bucket_start", tier, now.AddDate(0, 0, -r.Hourly)); err != nil {
+				return err
+			}
+		}
+		if r.Daily > 0 {
+			if err := deleteExpired(DailyRollup.Table, "bucket_start", tier, now.AddDate(0, 0, -r.Daily)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteExpired removes rows of the monitors of a tier older than cutoff,
+// in batches.
+func deleteExpired(table, column, tier string, cutoff time.Time) error {
+	total := int64(0)
+	for {
+		result, err := db.DB.Exec(
+			"DELETE FROM "+table+" WHERE "+column+" < ? AND url_id IN "+
+				"(SELECT u.id FROM urls u JOIN users s ON s.id = u.user_id WHERE COALESCE(s.tier, 'free') = ?) LIMIT ?",
+			cutoff, tier, retentionBatch,
+		)
+		if err != nil {
+			return err
+		}
+		n, _ := result.RowsAffected()
+		total += n
+		if n < retentionBatch {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("Deleted %d rows of %s older than %s for %s monitors", total, table, cutoff.Format(time.RFC3339), tier)
+	}
+	return nil
+}
+
+// mergeLatency combines latency of several parts, weighted by their number
+// of samples. Averages stay exact, percentiles are approximated.
+func mergeLatency(parts []LogRollup) *ResponseTimeStats {
+	var (
+		merged  ResponseTimeStats
+		samples int
+		sums    [5]float64
+	)
+	for _, p := range parts {
+		if p.Latency == nil || p.Samples == 0 {
+			continue
+		}
+		if samples == 0 || p.Latency.Min < merged.Min {
+			merged.Min = p.Latency.Min
+		}
+		merged.Max = max(merged.Max, p.Latency.Max)
+		w := float64(p.Samples)
+		sums[0] += w * float64(p.Latency.Avg)
+		sums[1] += w * float64(p.Latency.P50)
+		sums[2] += w * float64(p.Latency.P90)
+		sums[3] += w * float64(p.Latency.P95)
+		sums[4] += w * float64(p.Latency.P99)
+		samples += p.Samples
+	}
+	if samples == 0 {
+		return nil
+	}
+	avg := func(sum float64) int { return int(sum/float64(samples) + 0.5) }
+	merged.Avg, merged.P50, merged.P90, merged.P95, merged.P99 = avg(sums[0]), avg(sums[1]), avg(sums[2]), avg(sums[3]), avg(sums[4])
+	return &merged
+}
@@ -0,0 +1,379 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+// Stats buckets.
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+	BucketWeek = "week"
+)
+
+// MaxStatsRange is the longest period one stats request covers.
+const MaxStatsRange = 366 * 24 * time.Hour
+
+// MaxStatsBuckets keeps hourly buckets over long ranges from blowing up the response.
+const MaxStatsBuckets = 1000
+
+// Stats summarizes the checks and incidents of a monitor over a period.
+type Stats struct {
+	From    time.Time     `json:"from"`
+	To      time.Time     `json:"to"`
+	Bucket  string        `json:"bucket"`
+	Summary StatsSummary  `json:"summary"`
+	Buckets []StatsBucket `json:"buckets"`
+}
+
+// StatsSummary covers the whole period. Durations are in seconds; MTTR and
+// MTBF are nil until there is an incident to compute them from.
+type StatsSummary struct {
+	Checks       int                `json:"checks"`
+	Failures     int                `json:"failures"`
+	Uptime       *float64           `json:"uptime"`
+	Incidents    int                `json:"incidents"`
+	Downtime     int64              `json:"downtime"`
+	MTTR         *int64             `json:"mttr"`
+	MTBF         *int64             `json:"mtbf"`
+	ResponseTime *ResponseTimeStats `json:"response_time"`
+}
+
+// StatsBucket is one hour, day or week of the period.
+type StatsBucket struct {
+	Start        time.Time          `json:"start"`
+	Checks       int                `json:"checks"`
+	Failures     int                `json:"failures"`
+	Uptime       *float64           `json:"uptime"`
+	Incidents    int                `json:"incidents"`
+	Downtime     int64              `json:"downtime"`
+	ResponseTime *ResponseTimeStats `json:"response_time"`
+}
+
+// ResponseTimeStats are computed from successful checks only, in milliseconds.
+type ResponseTimeStats struct {
+	Min int `json:"min"`
+	Avg int `json:"avg"`
+	P50 int `json:"p50"`
+	P90 int `json:"p90"`
+	P95 int `json:"p95"`
+	P99 int `json:"p99"`
+	Max int `json:"max"`
+}
+
+// DefaultBucket picks a bucket that gives a readable number of points.
+func DefaultBucket(from, to time.Time) string {
+	switch span := to.Sub(from); {
+	case span <= 2*24*time.Hour:
+		return BucketHour
+	case span <= 90*24*time.Hour:
+		return BucketDay
+	}
+	return BucketWeek
+}
+
+// truncateBucket returns the start of the bucket t falls in, in UTC. Weeks
+// start on Monday.
+func truncateBucket(t time.Time, bucket string) time.Time {
+	t = t.UTC()
+	switch bucket {
+	case BucketHour:
+		return t.Truncate(time.Hour)
+	case BucketWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func nextBucket(t time.Time, bucket string) time.Time {
+	switch bucket {
+	case BucketHour:
+		return t.Add(time.Hour)
+	case BucketWeek:
+		return t.AddDate(0, 0, 7)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// CheckStatsPeriod validates a period and bucket before any query runs.
+func CheckStatsPeriod(from, to time.Time, bucket string) error {
+	if !to.After(from) {
+		return fmt.Errorf("from must be before to")
+	}
+	if to.Sub(from) > MaxStatsRange {
+		return fmt.Errorf("the period can be at most 366 days")
+	}
+	switch bucket {
+	case BucketHour, BucketDay, BucketWeek:
+	default:
+		return fmt.Errorf("bucket must be one of: hour, day, week")
+	}
+	n := 0
+	for start := truncateBucket(from, bucket); start.Before(to); start = nextBucket(start, bucket) {
+		if n++; n > MaxStatsBuckets {
+			return fmt.Errorf("too many %s buckets for this period, use a larger bucket", bucket)
+		}
+	}
+	return nil
+}
+
+// MonitorStats computes uptime, incident and response time statistics of a
+// monitor between from and to. Completed hours or days come from the
+// rollups, the rest from raw checks streamed once; downtime comes from the
+// incidents overlapping the period. Percentiles that span several rollup
+// buckets are weighted averages of theirs.
+func MonitorStats(urlID int, from, to time.Time, bucket string) (Stats, error) {
+	from, to = from.UTC(), to.UTC()
+	stats := Stats{From: from, To: to, Bucket: bucket, Buckets: []StatsBucket{}}
+
+	index := map[time.Time]int{}
+	for start := truncateBucket(from, bucket); start.Before(to); start = nextBucket(start, bucket) {
+		index[start] = len(stats.Buckets)
+		stats.Buckets = append(stats.Buckets, StatsBucket{Start: start})
+	}
+	times := make([][]int, len(stats.Buckets))
+	parts := make([][]LogRollup, len(stats.Buckets))
+	var all []int
+
+	level := DailyRollup
+	if bucket == BucketHour {
+		level = HourlyRollup
+	}
+	rollFrom, rollTo, err := rollupSpan(level, from, to)
+	if err != nil {
+		return stats, err
+	}
+	rolled := false
+	if rollTo.After(rollFrom) {
+		rows, err := db.DB.Query(
+			"SELECT "+RollupColumns+" FROM "+level.Table+" WHERE url_id = ? AND bucket_start >= ? AND bucket_start < ?",
+			urlID, rollFrom, rollTo,
+		)
+		if err != nil {
+			return stats, err
+		}
+		for rows.Next() {
+			r, err := ScanRollup(rows)
+			if err != nil {
+				rows.Close()
+				return stats, err
+			}
+			i, ok := index[truncateBucket(r.BucketStart, bucket)]
+			if !ok {
+				continue
+			}
+			stats.Buckets[i].Checks += r.Checks
+			stats.Buckets[i].Failures += r.Failures
+			parts[i] = append(parts[i], r)
+			rolled = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return stats, err
+		}
+	}
+
+	rows, err := db.DB.Query(
+		"SELECT checked_at, response_time, status, confirmed FROM logs WHERE url_id = ? AND checked_at >= ? AND checked_at < ? "+
+			"AND NOT (checked_at >= ? AND checked_at < ?)",
+		urlID, from, to, rollFrom, rollTo,
+	)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			checkedAt    time.Time
+			responseTime int
+			status       string
+			confirmed    bool
+		)
+		if err := rows.Scan(&checkedAt, &responseTime, &status, &confirmed); err != nil {
+			return stats, err
+		}
+		i, ok := index[truncateBucket(checkedAt, bucket)]
+		if !ok {
+			continue
+		}
+		b := &stats.Buckets[i]
+		b.Checks++
+		switch {
+		case confirmed && isDown(status):
+			b.Failures++
+		case !isDown(status):
+			times[i] = append(times[i], responseTime)
+			all = append(all, responseTime)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	summary := make([]LogRollup, 0, len(stats.Buckets))
+	for i := range stats.Buckets {
+		b := &stats.Buckets[i]
+		b.Uptime = uptimePercent(b.Checks, b.Failures)
+		samples := len(times[i])
+		b.ResponseTime = responseTimeStats(times[i])
+		if len(parts[i]) > 0 {
+			for _, r := range parts[i] {
+				samples += r.Samples
+			}
+			b.ResponseTime = mergeLatency(append(parts[i], LogRollup{Samples: len(times[i]), Latency: b.ResponseTime}))
+		}
+		summary = append(summary, LogRollup{Samples: samples, Latency: b.ResponseTime})
+		stats.Summary.Checks += b.Checks
+		stats.Summary.Failures += b.Failures
+	}
+	stats.Summary.Uptime = uptimePercent(stats.Summary.Checks, stats.Summary.Failures)
+	if rolled {
+		stats.Summary.ResponseTime = mergeLatency(summary)
+	} else {
+		stats.Summary.ResponseTime = responseTimeStats(all)
+	}
+
+	if err := addIncidentStats(&stats, urlID); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// addIncidentStats fills in incident counts, downtime, MTTR and MTBF.
+func addIncidentStats(stats *Stats, urlID int) error {
+	now := time.Now().UTC()
+	var createdAt time.Time
+	if err := db.DB.QueryRow("SELECT created_at FROM urls WHERE id = ?", urlID).Scan(&createdAt); err != nil {
+		return err
+	}
+
+	rows, err := db.DB.Query(
+		"SELECT started_at, resolved_at FROM incidents WHERE url_id = ? AND started_at < ? AND (resolved_at IS NULL OR resolved_at > ?)",
+		urlID, stats.To, stats.From,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var (
+		repairs  []time.Duration
+		downtime time.Duration
+	)
+	for rows.Next() {
+		var (
+			start    time.Time
+			resolved sql.NullTime
+		)
+		if err := rows.Scan(&start, &resolved); err != nil {
+			return err
+		}
+		start = start.UTC()
+		end := now
+		if resolved.Valid {
+			end = resolved.Time.UTC()
+			if !end.After(stats.To) {
+				repairs = append(repairs, end.Sub(start))
+			}
+		}
+		if !start.Before(stats.From) {
+			stats.Summary.Incidents++
+			if i := bucketOf(stats, start); i >= 0 {
+				stats.Buckets[i].Incidents++
+			}
+		}
+		downtime += overlap(start, end, stats.From, stats.To)
+		// Clip to the period first, the outer buckets reach past it.
+		if start.Before(stats.From) {
+			start = stats.From
+		}
+		if end.After(stats.To) {
+			end = stats.To
+		}
+		for i := range stats.Buckets {
+			b := &stats.Buckets[i]
+			b.Downtime += int64(overlap(start, end, b.Start, nextBucket(b.Start, stats.Bucket)).Seconds())
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	stats.Summary.Downtime = int64(downtime.Seconds())
+
+	if len(repairs) > 0 {
+		var total time.Duration
+		for _, d := range repairs {
+			total += d
+		}
+		mttr := int64((total / time.Duration(len(repairs))).Seconds())
+		stats.Summary.MTTR = &mttr
+	}
+
+	// Time between failures only counts while the monitor existed and was up.
+	observed := overlap(stats.From, stats.To, createdAt.UTC(), now) - downtime
+	if stats.Summary.Incidents > 0 && observed > 0 {
+		mtbf := int64((observed / time.Duration(stats.Summary.Incidents)).Seconds())
+		stats.Summary.MTBF = &mtbf
+	}
+	return nil
+}
+
+func bucketOf(stats *Stats, t time.Time) int {
+	start := truncateBucket(t, stats.Bucket)
+	for i, b := range stats.Buckets {
+		if b.Start.Equal(start) {
+			return i
+		}
+	}
+	return -1
+}
+
+// overlap is how long [aStart, aEnd) and [bStart, bEnd) share.
+func overlap(aStart, aEnd, bStart, bEnd time.Time) time.Duration {
+	start, end := aStart, aEnd
+	if bStart.After(start) {
+		start = bStart
+	}
+	if bEnd.Before(end) {
+		end = bEnd
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// responseTimeStats uses nearest-rank percentiles, nil without samples.
+func responseTimeStats(samples []int) *ResponseTimeStats {
+	if len(samples) == 0 {
+		return nil
+	}
+	sort.Ints(samples)
+	sum := 0
+	for _, v := range samples {
+		sum += v
+	}
+	rank := func(p float64) int {
+		i := int(math.Ceil(p/100*float64(len(samples)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return samples[i]
+	}
+	return &ResponseTimeStats{
+		Min: samples[0],
+		Avg: int(math.Round(float64(sum) / float64(len(samples)))),
+		P50: rank(50),
+		P90: rank(90),
+		P95: rank(95),
+		P99: rank(99),
+		Max: samples[len(samples)-1],
+	}
+}
@@ -0,0 +1,524 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+// UptimeDays is how many daily bars a status page shows.
+const UptimeDays = 90
+
+// MaxStatusPageMonitors caps the monitors listed on one status page.
+const MaxStatusPageMonitors = 50
+
+// Overall and per component states shown on a status page.
+const (
+	StateOperational = "operational"
+	StateDegraded    = "degraded"
+	StateOutage      = "outage"
+	StateMaintenance = "maintenance"
+)
+
+// SlugPattern is what a status page slug may look like in /status/{slug}.
+var SlugPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{1,48}[a-z0-9])$`)
+
+// StatusPage is the public page of one user and the monitors it shows.
+type StatusPage struct {
+	ID           int
+	UserID       int
+	Slug         string
+	Title        string
+	Description  string
+	LogoURL      string
+	CustomDomain string
+	Components   []StatusComponent
+}
+
+// StatusComponent groups monitors under one name, e.g. "API" or "Website".
+type StatusComponent struct {
+	Name     string             `json:"name" validate:"required,min=1,max=100"`
+	Monitors []StatusPageMember `json:"monitors" validate:"required,min=1,dive"`
+}
+
+// StatusPageMember is a monitor listed on a page. Name replaces the monitor
+// name publicly, the monitored URL is never shown.
+type StatusPageMember struct {
+	URLID int    `json:"url_id" validate:"required,min=1"`
+	Name  string `json:"name" validate:"omitempty,max=100"`
+}
+
+// StatusPageView is everything rendered on the public page.
+type StatusPageView struct {
+	Slug        string            `json:"slug"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	LogoURL     string            `json:"logo_url"`
+	Status      string            `json:"status"`
+	Components  []ComponentView   `json:"components"`
+	Incidents   []IncidentView    `json:"incidents"`
+	Maintenance []MaintenanceView `json:"maintenance"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+type ComponentView struct {
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Monitors []MonitorView `json:"monitors"`
+}
+
+type MonitorView struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Uptime is the percentage over all days with data, nil without any.
+	Uptime *float64    `json:"uptime"`
+	Days   []UptimeDay `json:"days"`
+}
+
+// UptimeDay is one bar of the uptime history. Failures only count confirmed
+// down checks, so retried blips don't show up.
+type UptimeDay struct {
+	Date     string   `json:"date"`
+	Checks   int      `json:"checks"`
+	Failures int      `json:"failures"`
+	Uptime   *float64 `json:"uptime"`
+}
+
+// IncidentView is an active incident without the monitor's error details.
+type IncidentView struct {
+	Monitor      string    `json:"monitor"`
+	Status       string    `json:"status"`
+	StartedAt    time.Time `json:"started_at"`
+	Acknowledged bool      `json:"acknowledged"`
+}
+
+type MaintenanceView struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	Active      bool      `json:"active"`
+}
+
+// Level sorts a day into the bar colors of the HTML page.
+func (d UptimeDay) Level() string {
+	switch {
+	case d.Uptime == nil:
+		return "none"
+	case *d.Uptime >= 99.9:
+		return "up"
+	case *d.Uptime >= 95:
+		return "partial"
+	}
+	return "down"
+}
+
+// monitorState maps a monitor status to what the public sees.
+func monitorState(status string) string {
+	switch status {
+	case "online":
+		return StateOperational
+	case "warning":
+		return StateDegraded
+	}
+	return StateOutage
+}
+
+// worstState returns the more severe of two states.
+func worstState(a, b string) string {
+	rank := map[string]int{StateOperational: 0, StateDegraded: 1, StateOutage: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// MonitorIDs lists the monitors of a page in display order.
+func (p StatusPage) MonitorIDs() []int {
+	var ids []int
+	for _, comp := range p.Components {
+		for _, m := range comp.Monitors {
+			ids = append(ids, m.URLID)
+		}
+	}
+	return ids
+}
+
+// LoadStatusPage reads a page and its components by a column that identifies
+// it, "id", "slug" or "custom_domain".
+func LoadStatusPage(column string, value any) (StatusPage, error) {
+	var (
+		p                             StatusPage
+		description, logo, customHost sql.NullString
+	)
+	err := db.DB.QueryRow(
+		"SELECT id, user_id, slug, title, description, logo_url, custom_domain FROM status_pages WHERE "+column+" = ?", value,
+	).Scan(&p.ID, &p.UserID, &p.Slug, &p.Title, &description, &logo, &customHost)
+	if err != nil {
+		return p, err
+	}
+	p.Description, p.LogoURL, p.CustomDomain = description.String, logo.String, customHost.String
+
+	rows, err := db.DB.Query(
+		"SELECT component, url_id, display_name FROM status_page_monitors WHERE page_id = ? ORDER BY position",
+		p.ID,
+	)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			component string
+			member    StatusPageMember
+			name      sql.NullString
+		)
+		if err := rows.Scan(&component, &member.URLID, &name); err != nil {
+			return p, err
+		}
+		member.Name = name.String
+		if n := len(p.Components); n > 0 && p.Components[n-1].Name == component {
+			p.Components[n-1].Monitors = append(p.Components[n-1].Monitors, member)
+		} else {
+			p.Components = append(p.Components, StatusComponent{Name: component, Monitors: []StatusPageMember{member}})
+		}
+	}
+	return p, rows.Err()
+}
+
+// SaveStatusPageMonitors replaces the components of a page.
+func SaveStatusPageMonitors(tx *sql.Tx, pageID int, components []StatusComponent) error {
+	if _, err := tx.Exec("DELETE FROM status_page_monitors WHERE page_id = ?", pageID); err != nil {
+		return err
+	}
+	position := 0
+	for _, comp := range components {
+		for _, m := range comp.Monitors {
+			_, err := tx.Exec(
+				"INSERT INTO status_page_monitors (page_id, url_id, component, display_name, position) VALUES (?, ?, ?, ?, ?)",
+				pageID, m.URLID, comp.Name, sql.NullString{String: m.Name, Valid: m.Name != ""}, position,
+			)
+			if err != nil {
+				return err
+			}
+			position++
+		}
+	}
+	return nil
+}
+
+// BuildStatusPageView gathers the current status, uptime history, active
+// incidents and maintenance windows of a page.
+func BuildStatusPageView(p StatusPage) (StatusPageView, error) {
+	now := time.Now()
+	view := StatusPageView{
+		Slug:        p.Slug,
+		Title:       p.Title,
+		Description: p.Description,
+		LogoURL:     p.LogoURL,
+		Status:      StateOperational,
+		Components:  []ComponentView{},
+		Incidents:   []IncidentView{},
+		Maintenance: []MaintenanceView{},
+		UpdatedAt:   now.UTC(),
+	}
+
+	ids := p.MonitorIDs()
+	type monitorInfo struct{ name, status string }
+	monitors := map[int]monitorInfo{}
+	if len(ids) > 0 {
+		args := append([]any{p.UserID}, intArgs(ids)...)
+		rows, err := db.DB.Query(
+			"SELECT id, name, status FROM urls WHERE user_id = ? AND id IN ("+placeholders(len(ids))+")",
+			args...,
+		)
+		if err != nil {
+			return view, err
+		}
+		for rows.Next() {
+			var (
+				id     int
+				name   sql.NullString
+				status string
+			)
+			if err := rows.Scan(&id, &name, &status); err != nil {
+				rows.Close()
+				return view, err
+			}
+			monitors[id] = monitorInfo{name: name.String, status: status}
+		}
+		rows.Close()
+	}
+
+	days, err := DailyUptime(ids, UptimeDays, now)
+	if err != nil {
+		return view, err
+	}
+
+	names := map[int]string{}
+	for _, comp := range p.Components {
+		cv := ComponentView{Name: comp.Name, Status: StateOperational, Monitors: []MonitorView{}}
+		for _, m := range comp.Monitors {
+			info, ok := monitors[m.URLID]
+			if !ok {
+				// Deleted or no longer owned by the page owner.
+				continue
+			}
+			name := m.Name
+			if name == "" {
+				name = info.name
+			}
+			if name == "" {
+				name = comp.Name
+			}
+			names[m.URLID] = name
+			mv := MonitorView{Name: name, Status: monitorState(info.status), Days: days[m.URLID]}
+			mv.Uptime = totalUptime(mv.Days)
+			cv.Status = worstState(cv.Status, mv.Status)
+			cv.Monitors = append(cv.Monitors, mv)
+		}
+		if len(cv.Monitors) == 0 {
+			continue
+		}
+		view.Status = worstState(view.Status, cv.Status)
+		view.Components = append(view.Components, cv)
+	}
+
+	if len(names) > 0 {
+		active := make([]int, 0, len(names))
+		for id := range names {
+			active = append(active, id)
+		}
+		rows, err := db.DB.Query(
+			"SELECT url_id, status, started_at FROM incidents WHERE status <> ? AND url_id IN ("+placeholders(len(active))+") ORDER BY started_at DESC",
+			append([]any{IncidentResolved}, intArgs(active)...)...,
+		)
+		if err != nil {
+			return view, err
+		}
+		for rows.Next() {
+			var (
+				urlID  int
+				status string
+				iv     IncidentView
+			)
+			if err := rows.Scan(&urlID, &status, &iv.StartedAt); err != nil {
+				rows.Close()
+				return view, err
+			}
+			iv.Monitor = names[urlID]
+			iv.Status = monitorState(monitors[urlID].status)
+			iv.Acknowledged = status == IncidentAcknowledged
+			view.Incidents = append(view.Incidents, iv)
+		}
+		rows.Close()
+	}
+
+	// Windows that are running or start within the next week.
+	rows, err := db.DB.Query(
+		"SELECT id, title, description, starts_at, ends_at FROM status_page_maintenance WHERE page_id = ? AND ends_at > ? AND starts_at < ? ORDER BY starts_at",
+		p.ID, now, now.Add(7*24*time.Hour),
+	)
+	if err != nil {
+		return view, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			mv          MaintenanceView
+			description sql.NullString
+		)
+		if err := rows.Scan(&mv.ID, &mv.Title, &description, &mv.StartsAt, &mv.EndsAt); err != nil {
+			return view, err
+		}
+		mv.Description = description.String
+		mv.Active = !now.Before(mv.StartsAt)
+		if mv.Active {
+			view.Status = StateMaintenance
+		}
+		view.Maintenance = append(view.Maintenance, mv)
+	}
+	return view, rows.Err()
+}
+
+// DailyUptime returns the last `days` days of uptime per monitor, oldest
+// first, ending with today.
+func DailyUptime(ids []int, days int, now time.Time) (map[int][]UptimeDay, error) {
+	result := make(map[int][]UptimeDay, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from := today.AddDate(0, 0, -(days - 1))
+
+	// Completed days come from the daily rollups, today from raw logs.
+	rollFrom, rollTo, err := rollupSpan(DailyRollup, from, now)
+	if err != nil {
+		return nil, err
+	}
+	args := intArgs(ids)
+	queries := []struct {
+		query string
+		args  []any
+	}{
+		{
+			"SELECT url_id, DATE_FORMAT(bucket_start, '%Y-%m-%d'), checks, failures FROM " + DailyRollup.Table + " " +
+				"WHERE bucket_start >= ? AND bucket_start < ? AND url_id IN (" + placeholders(len(ids)) + ")",
+			append([]any{rollFrom, rollTo}, args...),
+		},
+		{
+			"SELECT url_id, DATE_FORMAT(checked_at, '%Y-%m-%d'), COUNT(*), " +
+				"SUM(CASE WHEN confirmed AND status IN ('offline', 'error') THEN 1 ELSE 0 END) " +
+				"FROM logs WHERE checked_at >= ? AND NOT (checked_at >= ? AND checked_at < ?) AND url_id IN (" + placeholders(len(ids)) + ") " +
+				"GROUP BY url_id, DATE_FORMAT(checked_at, '%Y-%m-%d')",
+			append([]any{from, rollFrom, rollTo}, args...),
+		},
+	}
+
+	counts := map[int]map[string][2]int{}
+	for _, q := range queries {
+		rows, err := db.DB.Query(q.query, q.args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var (
+				id               int
+				date             string
+				checks, failures int
+			)
+			if err := rows.Scan(&id, &date, &checks, &failures); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if counts[id] == nil {
+				counts[id] = map[string][2]int{}
+			}
+			c := counts[id][date]
+			counts[id][date] = [2]int{c[0] + checks, c[1] + failures}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range ids {
+		series := make([]UptimeDay, days)
+		for i := range series {
+			date := from.AddDate(0, 0, i).Format("2006-01-02")
+			c := counts[id][date]
+			series[i] = UptimeDay{Date: date, Checks: c[0], Failures: c[1], Uptime: uptimePercent(c[0], c[1])}
+		}
+		result[id] = series
+	}
+	return result, nil
+}
+
+func totalUptime(days []UptimeDay) *float64 {
+	var checks, failures int
+	for _, d := range days {
+		checks += d.Checks
+		failures += d.Failures
+	}
+	return uptimePercent(checks, failures)
+}
+
+// uptimePercent rounds to three decimals so 99.999 doesn't show as 100.
+func uptimePercent(checks, failures int) *float64 {
+	if checks == 0 {
+		return nil
+	}
+	pct := float64(int(float64(checks-failures)/float64(checks)*100000)) / 1000
+	return &pct
+}
+
+func placeholders(n int) string {
+	return "?" + strings.Repeat(", ?", n-1)
+}
+
+func intArgs(ids []int) []any {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+// statusDomains caches custom domain to page id, so requests on the API
+// host don't hit the database every time.
+var statusDomains = struct {
+	sync.Mutex
+	pages  map[string]int
+	loaded time.Time
+}{}
+
+const statusDomainsTTL = time.Minute
+
+// StatusPageForHost returns the page served on a custom domain, 0 if none.
+func StatusPageForHost(host string) int {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if i := strings.LastIndex(host, ":"); i > 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+
+	statusDomains.Lock()
+	defer statusDomains.Unlock()
+	if time.Since(statusDomains.loaded) > statusDomainsTTL {
+		pages, err := loadStatusDomains()
+		if err != nil {
+			log.Printf("Error loading status page domains: %v", err)
+		} else {
+			statusDomains.pages = pages
+		}
+		statusDomains.loaded = time.Now()
+	}
+	return statusDomains.pages[host]
+}
+
+// ForgetStatusDomains makes the next request reload the custom domains
+// after a page was changed.
+func ForgetStatusDomains() {
+	statusDomains.Lock()
+	statusDomains.loaded = time.Time{}
+	statusDomains.Unlock()
+}
+
+func loadStatusDomains() (map[string]int, error) {
+	rows, err := db.DB.Query("SELECT id, custom_domain FROM status_pages WHERE custom_domain IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pages := map[string]int{}
+	for rows.Next() {
+		var (
+			id     int
+			domain string
+		)
+		if err := rows.Scan(&id, &domain); err != nil {
+			return nil, err
+		}
+		pages[strings.ToLower(domain)] = id
+	}
+	return pages, rows.Err()
+}
+
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z][a-z0-9-]{0,61}[a-z0-9]$`)
+
+// NormalizeDomain validates a custom domain and returns it lowercased.
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if len(domain) > 253 || !domainPattern.MatchString(domain) {
+		return "", fmt.Errorf("custom_domain must be a host name such as status.example.com")
+	}
+	return domain, nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	tcpDialTimeout   = 10 * time.Second
+	tcpBannerTimeout = 5 * time.Second
+	tcpMaxBanner     = 4096
+)
+
+// checkTCP connects to tcp://host:port, optionally writes the payload and
+// asserts that the reply starts with the expected banner.
+func checkTCP(m Monitor) (res CheckResult) {
+	u, err := url.Parse(m.URL)
+	if err != nil || u.Hostname() == "" || u.Port() == "" {
+		res.fail("error", fmt.Sprintf("Invalid TCP address %q", m.URL))
+		return
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), tcpDialTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, u.Hostname())
+	dnsDone := time.Now()
+	res.Timings.DNS = int(dnsDone.Sub(start).Milliseconds())
+	if err != nil {
+		res.ResponseTime = res.Timings.DNS
+		res.fail("error", fmt.Sprintf("DNS lookup failed: %v", err))
+		return
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addrs[0], u.Port()))
+	connected := time.Now()
+	res.Timings.Connect = int(connected.Sub(dnsDone).Milliseconds())
+	res.ResponseTime = int(connected.Sub(start).Milliseconds())
+	if err != nil {
+		res.fail("error", fmt.Sprintf("Connection failed: %v", err))
+		return
+	}
+	defer conn.Close()
+
+	if m.Payload != "" {
+		conn.SetWriteDeadline(time.Now().Add(tcpBannerTimeout))
+		if _, err := conn.Write([]byte(m.Payload)); err != nil {
+			res.fail("offline", fmt.Sprintf("Failed to send payload: %v", err))
+			return
+		}
+	}
+
+	if m.ExpectBanner != "" {
+		sent := time.Now()
+		banner, err := readBanner(conn, len(m.ExpectBanner))
+		firstByte := time.Now()
+		res.Timings.TTFB = int(firstByte.Sub(sent).Milliseconds())
+		res.ResponseTime = int(firstByte.Sub(start).Milliseconds())
+		if !strings.HasPrefix(banner, m.ExpectBanner) {
+			if err != nil && banner == "" {
+				res.fail("offline", fmt.Sprintf("No banner received: %v", err))
+			} else {
+				res.fail("offline", fmt.Sprintf("Banner %q does not start with %q", truncate(banner, 100), m.ExpectBanner))
+			}
+			return
+		}
+	}
+
+	res.Status = "online"
+	return
+}
+
+// readBanner reads until at least want bytes arrived, the peer stopped
+// sending, or the banner timeout expired.
+func readBanner(conn net.Conn, want int) (string, error) {
+	conn.SetReadDeadline(time.Now().Add(tcpBannerTimeout))
+	buf := make([]byte, 0, tcpMaxBanner)
+	chunk := make([]byte, 1024)
+	for len(buf) < want && len(buf) < tcpMaxBanner {
+		n, err := conn.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if err != nil {
+			return string(buf), err
+		}
+	}
+	return string(buf), nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings is the per-phase breakdown of a single check, in milliseconds.
+// Phases that did not happen (e.g. DNS for an IP address, TLS over plain HTTP) are 0.
+type Timings struct {
+	DNS      int `json:"dns_ms"`
+	Connect  int `json:"connect_ms"`
+	TLS      int `json:"tls_ms"`
+	TTFB     int `json:"ttfb_ms"`
+	Download int `json:"download_ms"`
+}
+
+// TimingTrace records phase timestamps through net/http/httptrace.
+type TimingTrace struct {
+	mu                       sync.Mutex
+	dnsStart, dnsDone        time.Time
+	connectStart, connectEnd time.Time
+	tlsStart, tlsDone        time.Time
+	wroteRequest, firstByte  time.Time
+	bodyDone                 time.Time
+}
+
+// TraceRequest attaches a TimingTrace to the request's context.
+func TraceRequest(req *http.Request) (*http.Request, *TimingTrace) {
+	t := &TimingTrace{}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
+		ConnectStart: func(string, string) {
+			// Dual-stack dialing may start several connects; keep the first.
+			t.mu.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				t.mark(&t.connectEnd)
+			}
+		},
+		TLSHandshakeStart:    func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.mark(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), t
+}
+
+func (t *TimingTrace) mark(at *time.Time) {
+	t.mu.Lock()
+	*at = time.Now()
+	t.mu.Unlock()
+}
+
+// BodyDone marks the end of the body transfer.
+func (t *TimingTrace) BodyDone() {
+	t.mark(&t.bodyDone)
+}
+
+// Timings converts the recorded timestamps into phase durations.
+func (t *TimingTrace) Timings() Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Timings{
+		DNS:      phaseMs(t.dnsStart, t.dnsDone),
+		Connect:  phaseMs(t.connectStart, t.connectEnd),
+		TLS:      phaseMs(t.tlsStart, t.tlsDone),
+		TTFB:     phaseMs(t.wroteRequest, t.firstByte),
+		Download: phaseMs(t.firstByte, t.bodyDone),
+	}
+}
+
+func phaseMs(start, end time.Time) int {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return int(end.Sub(start).Milliseconds())
+}
+
+// NullTimings holds timing columns read from logs; rows written before the
+// columns existed have them all NULL.
+type NullTimings struct {
+	DNS, Connect, TLS, TTFB, Download sql.NullInt64
+}
+
+// Dest returns scan targets in column order:
+// dns_time, connect_time, tls_time, ttfb_time, download_time.
+func (n *NullTimings) Dest() []any {
+	return []any{&n.DNS, &n.Connect, &n.TLS, &n.TTFB, &n.Download}
+}
+
+// Get returns the timings and whether they were recorded.
+func (n NullTimings) Get() (Timings, bool) {
+	if !n.DNS.Valid {
+		return Timings{}, false
+	}
+	return Timings{
+		DNS:      int(n.DNS.Int64),
+		Connect:  int(n.Connect.Int64),
+		TLS:      int(n.TLS.Int64),
+		TTFB:     int(n.TTFB.Int64),
+		Download: int(n.Download.Int64),
+	}, true
+}
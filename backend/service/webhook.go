@@ -0,0 +1,260 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+	"github.com/MrPurushotam/web-visitor/utils"
+)
+
+// Webhook events.
+const (
+	EventMonitorDown = "monitor.down"
+	EventMonitorUp   = "monitor.up"
+	// EventMonitorStillDown reminds about an incident nobody acknowledged yet.
+	EventMonitorStillDown = "monitor.still_down"
+	EventTest             = "test"
+)
+
+// Webhook delivery headers. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret, so receivers can reject
+// replayed requests by checking the timestamp.
+const (
+	SignatureHeader = "X-WebVisitor-Signature"
+	TimestampHeader = "X-WebVisitor-Timestamp"
+	EventHeader     = "X-WebVisitor-Event"
+	DeliveryHeader  = "X-WebVisitor-Delivery"
+)
+
+// Retry policy of a delivery: attempts are WebhookBackoff, 2*WebhookBackoff,
+// 4*WebhookBackoff, ... apart.
+const (
+	WebhookMaxAttempts = 5
+	WebhookBackoff     = 2 * time.Second
+)
+
+// maxWebhookResponse caps how much of a receiver's reply is kept in the delivery log.
+const maxWebhookResponse = 1000
+
+// webhookClient doesn't follow redirects, a receiver has to answer itself.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// WebhookMonitor identifies the monitor in a webhook payload.
+type WebhookMonitor struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// WebhookPayload is the JSON body posted to webhooks.
+type WebhookPayload struct {
+	Event          string          `json:"event"`
+	DeliveryID     string          `json:"delivery_id"`
+	Timestamp      string          `json:"timestamp"`
+	Monitor        *WebhookMonitor `json:"monitor,omitempty"`
+	PreviousStatus string          `json:"previous_status,omitempty"`
+	Status         string          `json:"status,omitempty"`
+	ResponseCode   int             `json:"response_code,omitempty"`
+	ErrorMessage   string          `json:"error_message,omitempty"`
+	DownSince      string          `json:"down_since,omitempty"`
+	// DowntimeSeconds is set on monitor.up events.
+	DowntimeSeconds int64  `json:"downtime_seconds,omitempty"`
+	Message         string `json:"message,omitempty"`
+}
+
+// Webhook is a delivery target of one user.
+type Webhook struct {
+	ID     int
+	URL    string
+	Secret string
+}
+
+// WebhookDelivery is the outcome of one delivery attempt.
+type WebhookDelivery struct {
+	Attempt      int
+	StatusCode   int
+	ErrorMessage string
+	Response     string
+	Duration     int
+	Success      bool
+}
+
+// webhookPayload builds the payload describing an alert.
+func webhookPayload(a Alert) WebhookPayload {
+	p := WebhookPayload{
+		Event:          EventMonitorDown,
+		Timestamp:      a.At.UTC().Format(time.RFC3339),
+		Monitor:        &WebhookMonitor{ID: a.MonitorID, Name: a.Name, URL: a.URL},
+		PreviousStatus: a.From,
+		Status:         a.To,
+		ResponseCode:   a.ResponseCode,
+		ErrorMessage:   a.ErrorMessage,
+	}
+	if !a.DownSince.IsZero() {
+		p.DownSince = a.DownSince.UTC().Format(time.RFC3339)
+	}
+	if a.Repeat {
+		p.Event = EventMonitorStillDown
+	} else if a.Recovered() {
+		p.Event = EventMonitorUp
+		p.DowntimeSeconds = int64(a.Downtime.Seconds())
+	}
+	return p
+}
+
+// TestWebhookPayload is sent by the "send test event" endpoint.
+func TestWebhookPayload() WebhookPayload {
+	return WebhookPayload{
+		Event:     EventTest,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Message:   "This is a test event from Web Visitor",
+	}
+}
+
+// SignWebhook returns the signature header value for a delivery.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// dispatchWebhooks delivers an alert to every active webhook of its owner.
+func dispatchWebhooks(a Alert) {
+	rows, err := db.DB.Query("SELECT id, url, secret FROM webhooks WHERE user_id = ? AND is_active = TRUE", a.UserID)
+	if err != nil {
+		log.Printf("[Monitor %d] Error loading webhooks: %v", a.MonitorID, err)
+		return
+	}
+	var hooks []Webhook
+	for rows.Next() {
+		var w Webhook
+		if err := rows.Scan(&w.ID, &w.URL, &w.Secret); err != nil {
+			log.Printf("[Monitor %d] Error scanning webhook: %v", a.MonitorID, err)
+			continue
+		}
+		hooks = append(hooks, w)
+	}
+	rows.Close()
+
+	payload := webhookPayload(a)
+	for _, w := range hooks {
+		go DeliverWebhook(w, payload, WebhookMaxAttempts)
+	}
+}
+
+// DeliverWebhook posts payload to w, retrying failed attempts with exponential
+// backoff up to maxAttempts times. Every attempt is written to
+// webhook_deliveries. It returns the last attempt.
+func DeliverWebhook(w Webhook, payload WebhookPayload, maxAttempts int) WebhookDelivery {
+	if payload.DeliveryID == "" {
+		id, err := utils.GenerateSessionToken()
+		if err != nil {
+			log.Printf("[Webhook %d] Error generating delivery id: %v", w.ID, err)
+			return WebhookDelivery{ErrorMessage: err.Error()}
+		}
+		payload.DeliveryID = id[:32]
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("[Webhook %d] Error encoding payload: %v", w.ID, err)
+		return WebhookDelivery{ErrorMessage: err.Error()}
+	}
+
+	var d WebhookDelivery
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		d = postWebhook(w, payload, body)
+		d.Attempt = attempt
+		if err := saveWebhookDelivery(w.ID, payload, body, d); err != nil {
+			log.Printf("[Webhook %d] Error saving delivery: %v", w.ID, err)
+		}
+		if d.Success || !retryable(d) || attempt == maxAttempts {
+			break
+		}
+		delay := WebhookBackoff << (attempt - 1)
+		log.Printf("[Webhook %d] Delivery %s attempt %d failed (%s), retrying in %s",
+			w.ID, payload.DeliveryID, attempt, d.summary(), delay)
+		time.Sleep(delay)
+	}
+	if !d.Success {
+		log.Printf("[Webhook %d] Delivery %s of %s failed after %d attempts: %s",
+			w.ID, payload.DeliveryID, payload.Event, d.Attempt, d.summary())
+	}
+	return d
+}
+
+func postWebhook(w Webhook, payload WebhookPayload, body []byte) (d WebhookDelivery) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		d.ErrorMessage = err.Error()
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "WebVisitor-Webhook/1.0")
+	req.Header.Set(EventHeader, payload.Event)
+	req.Header.Set(DeliveryHeader, payload.DeliveryID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, SignWebhook(w.Secret, timestamp, body))
+
+	start := time.Now()
+	resp, err := webhookClient.Do(req)
+	d.Duration = int(time.Since(start).Milliseconds())
+	if err != nil {
+		d.ErrorMessage = err.Error()
+		return
+	}
+	defer resp.Body.Close()
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponse))
+	d.StatusCode = resp.StatusCode
+	d.Response = string(reply)
+	d.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !d.Success {
+		d.ErrorMessage = fmt.Sprintf("Unexpected status %s", resp.Status)
+	}
+	return
+}
+
+// retryable reports whether a failed attempt may succeed later. Client errors
+// other than timeouts and rate limits won't.
+func retryable(d WebhookDelivery) bool {
+	if d.StatusCode == 0 || d.StatusCode >= 500 {
+		return true
+	}
+	return d.StatusCode == http.StatusRequestTimeout || d.StatusCode == http.StatusTooManyRequests
+}
+
+func (d WebhookDelivery) summary() string {
+	if d.ErrorMessage != "" {
+		return d.ErrorMessage
+	}
+	return strconv.Itoa(d.StatusCode)
+}
+
+func saveWebhookDelivery(webhookID int, payload WebhookPayload, body []byte, d WebhookDelivery) error {
+	_, err := db.DB.Exec(
+		"INSERT INTO webhook_deliveries (webhook_id, delivery_id, event, payload, attempt, status_code, response_body, error_message, duration, success) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		webhookID, payload.DeliveryID, payload.Event, string(body), d.Attempt,
+		sql.NullInt64{Int64: int64(d.StatusCode), Valid: d.StatusCode > 0},
+		sql.NullString{String: d.Response, Valid: d.Response != ""},
+		sql.NullString{String: d.ErrorMessage, Valid: d.ErrorMessage != ""},
+		d.Duration, d.Success,
+	)
+	return err
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+// deliveryLog is a database/sql driver that only accepts the INSERTs of
+// saveWebhookDelivery and keeps their attempt numbers.
+type deliveryLog struct {
+	mu       sync.Mutex
+	attempts []int64
+}
+
+func (l *deliveryLog) Open(string) (driver.Conn, error) { return deliveryConn{l}, nil }
+
+type deliveryConn struct{ log *deliveryLog }
+
+func (c deliveryConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c deliveryConn) Close() error                        { return nil }
+func (c deliveryConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c deliveryConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if !strings.HasPrefix(query, "INSERT INTO webhook_deliveries") {
+		return nil, errors.New("unexpected query: " + query)
+	}
+	c.log.mu.Lock()
+	defer c.log.mu.Unlock()
+	c.log.attempts = append(c.log.attempts, args[4].Value.(int64))
+	return driver.RowsAffected(1), nil
+}
+
+var (
+	deliveries       = &deliveryLog{}
+	registerDelivery sync.Once
+)
+
+// useDeliveryLog points db.DB at deliveryLog for the duration of a test.
+func useDeliveryLog(t *testing.T) *deliveryLog {
+	registerDelivery.Do(func() { sql.Register("webhook-deliveries", deliveries) })
+	conn, err := sql.Open("webhook-deliveries", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := db.DB
+	db.DB = conn
+	deliveries.mu.Lock()
+	deliveries.attempts = nil
+	deliveries.mu.Unlock()
+	t.Cleanup(func() {
+		db.DB = previous
+		conn.Close()
+	})
+	return deliveries
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"event":"test"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte("1700000000." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := SignWebhook("s3cret", "1700000000", body); got != want {
+		t.Errorf("SignWebhook = %q, want %q", got, want)
+	}
+	if SignWebhook("other", "1700000000", body) == want {
+		t.Error("signature doesn't depend on the secret")
+	}
+	if SignWebhook("s3cret", "1700000001", body) == want {
+		t.Error("signature doesn't depend on the timestamp")
+	}
+}
+
+func TestDeliverWebhookSignsRequests(t *testing.T) {
+	saved := useDeliveryLog(t)
+	var got *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	d := DeliverWebhook(Webhook{ID: 1, URL: server.URL, Secret: "s3cret"}, TestWebhookPayload(), 3)
+	if !d.Success || d.Attempt != 1 {
+		t.Fatalf("delivery = %+v, want success on the first attempt", d)
+	}
+
+	timestamp := got.Header.Get(TimestampHeader)
+	if sig := got.Header.Get(SignatureHeader); sig != SignWebhook("s3cret", timestamp, body) {
+		t.Errorf("signature %q doesn't match the body and timestamp %q", sig, timestamp)
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != EventTest || got.Header.Get(EventHeader) != EventTest {
+		t.Errorf("event = %q, header %q, want %q", payload.Event, got.Header.Get(EventHeader), EventTest)
+	}
+	if payload.DeliveryID == "" || got.Header.Get(DeliveryHeader) != payload.DeliveryID {
+		t.Errorf("delivery id = %q, header %q", payload.DeliveryID, got.Header.Get(DeliveryHeader))
+	}
+	if len(saved.attempts) != 1 {
+		t.Errorf("saved %d deliveries, want 1", len(saved.attempts))
+	}
+}
+
+func TestDeliverWebhookRetries(t *testing.T) {
+	saved := useDeliveryLog(t)
+	var (
+		mu  sync.Mutex
+		ids []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids = append(ids, r.Header.Get(DeliveryHeader))
+		n := len(ids)
+		mu.Unlock()
+		if n == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	d := DeliverWebhook(Webhook{ID: 1, URL: server.URL, Secret: "s3cret"}, TestWebhookPayload(), 2)
+	if !d.Success || d.Attempt != 2 {
+		t.Fatalf("delivery = %+v, want success on the second attempt", d)
+	}
+	if len(ids) != 2 || ids[0] != ids[1] {
+		t.Errorf("delivery ids = %v, want the same id on both attempts", ids)
+	}
+	if got := saved.attempts; len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("saved attempts %v, want [1 2]", got)
+	}
+}
+
+func TestDeliverWebhookGivesUpOnClientErrors(t *testing.T) {
+	saved := useDeliveryLog(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	d := DeliverWebhook(Webhook{ID: 1, URL: server.URL, Secret: "s3cret"}, TestWebhookPayload(), 3)
+	if d.Success || d.Attempt != 1 || d.StatusCode != http.StatusGone {
+		t.Fatalf("delivery = %+v, want one failed attempt", d)
+	}
+	if requests != 1 || len(saved.attempts) != 1 {
+		t.Errorf("got %d requests and %d saved deliveries, want 1 each", requests, len(saved.attempts))
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{0, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusRequestTimeout, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusBadRequest, false},
+		{http.StatusUnauthorized, false},
+		{http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(WebhookDelivery{StatusCode: tt.status}); got != tt.want {
+			t.Errorf("retryable(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+// APIKeyPrefix starts every API key so they are easy to tell from session
+// tokens and to spot in leaked code.
+const APIKeyPrefix = "wvk_"
+
+// apiKeyDisplayLength is how much of a key is kept in clear to tell keys apart.
+const apiKeyDisplayLength = 12
+
+// APIKeyScopes are the scopes a key can be granted. Reading is "<area>:read",
+// everything else "<area>:write".
+var APIKeyScopes = []string{
+	"uri:read", "uri:write",
+	"logs:read",
+	"incidents:read", "incidents:write",
+	"status-pages:read", "status-pages:write",
+	"webhooks:read", "webhooks:write",
+	"channels:read", "channels:write",
+}
+
+var (
+	ErrAPIKeyInvalid   = errors.New("invalid, revoked or expired API key")
+	ErrAPIKeyForbidden = errors.New("API key is not allowed from this IP address")
+)
+
+// APIKey is the stored part of a key; the key itself is only shown once.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// IsAPIKey reports whether a bearer token is an API key rather than a session.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// ValidAPIKeyScope reports whether scope is one of APIKeyScopes.
+func ValidAPIKeyScope(scope string) bool {
+	for _, s := range APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeAllowedIPs checks an allow-list of IP addresses and CIDR ranges
+// and returns it in canonical form.
+func NormalizeAllowedIPs(entries []string) ([]string, error) {
+	normalized := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			normalized = append(normalized, network.String())
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", entry)
+		}
+		normalized = append(normalized, ip.String())
+	}
+	return normalized, nil
+}
+
+func ipAllowed(allowList []string, clientIP string) bool {
+	if len(allowList) == 0 {
+		return true
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range allowList {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKey stores a new key for a user and returns it with the secret,
+// which isn't kept anywhere.
+func CreateAPIKey(userID int, name string, scopes, allowedIPs []string, expiresAt *time.Time) (APIKey, string, error) {
+	random, err := GenerateSessionToken()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	secret := APIKeyPrefix + random
+	key := APIKey{
+		Name:       name,
+		Prefix:     secret[:apiKeyDisplayLength],
+		Scopes:     scopes,
+		AllowedIPs: allowedIPs,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  time.Now().UTC(),
+	}
+	var expires sql.NullTime
+	if expiresAt != nil {
+		expires = sql.NullTime{Time: expiresAt.UTC(), Valid: true}
+	}
+	result, err := db.DB.Exec(
+		"INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, allowed_ips, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		userID, name, key.Prefix, HashToken(secret), strings.Join(scopes, ","),
+		sql.NullString{String: strings.Join(allowedIPs, ","), Valid: len(allowedIPs) > 0}, expires,
+	)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	id, err := result.LastInsertId()
+	key.ID = int(id)
+	return key, secret, err
+}
+
+// ValidateAPIKey resolves a key to its owner and scopes and records its use.
+func ValidateAPIKey(secret, clientIP string) (userID int, scopes []string, err error) {
+	var (
+		id         int
+		scopeList  string
+		allowedIPs sql.NullString
+	)
+	err = db.DB.QueryRow(
+		"SELECT id, user_id, scopes, allowed_ips FROM api_keys "+
+			"WHERE key_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())",
+		HashToken(secret),
+	).Scan(&id, &userID, &scopeList, &allowedIPs)
+	if err == sql.ErrNoRows {
+		return 0, nil, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if !ipAllowed(splitList(allowedIPs.String), clientIP) {
+		return 0, nil, ErrAPIKeyForbidden
+	}
+
+	// A CI job can call many times a minute; the minute is precise enough.
+	_, err = db.DB.Exec(
+		"UPDATE api_keys SET last_used_at = NOW(), last_used_ip = ? "+
+			"WHERE id = ? AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL 1 MINUTE OR last_used_ip <> ?)",
+		clientIP, id, clientIP,
+	)
+	return userID, splitList(scopeList), err
+}
+
+// ListAPIKeys returns the keys of a user that aren't revoked, newest first.
+func ListAPIKeys(userID int) ([]APIKey, error) {
+	rows, err := db.DB.Query(
+		"SELECT id, name, prefix, scopes, allowed_ips, expires_at, last_used_at, last_used_ip, created_at "+
+			"FROM api_keys WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at DESC, id DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var (
+			k                   APIKey
+			scopes              string
+			allowedIPs, lastIP  sql.NullString
+			expiresAt, lastUsed sql.NullTime
+		)
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &scopes, &allowedIPs, &expiresAt, &lastUsed, &lastIP, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		k.Scopes = splitList(scopes)
+		k.AllowedIPs = splitList(allowedIPs.String)
+		if expiresAt.Valid {
+			k.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsed.Valid {
+			k.LastUsedAt = &lastUsed.Time
+		}
+		k.LastUsedIP = lastIP.String
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey stops a key from working. It reports false when the user has
+// no such active key.
+func RevokeAPIKey(userID int, id string) (bool, error) {
+	result, err := db.DB.Exec(
+		"UPDATE api_keys SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL", id, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
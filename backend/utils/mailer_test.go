@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestCheckMailConfig(t *testing.T) {
+	tests := []struct {
+		host, username, mode string
+		ok                   bool
+	}{
+		{"", "alerts", "none", true},
+		{"smtp.example.com", "alerts", "starttls", true},
+		{"smtp.example.com", "alerts", "tls", true},
+		{"smtp.example.com", "", "none", true},
+		{"localhost", "alerts", "none", true},
+		{"127.0.0.1", "alerts", "NONE", true},
+		{"smtp.example.com", "alerts", "none", false},
+		{"10.0.0.5", "alerts", "None", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("SMTP_HOST", tt.host)
+		t.Setenv("SMTP_USERNAME", tt.username)
+		t.Setenv("SMTP_TLS", tt.mode)
+		if err := CheckMailConfig(); (err == nil) != tt.ok {
+			t.Errorf("CheckMailConfig(%s, %q, %s) = %v, want ok %v", tt.host, tt.username, tt.mode, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+package utils
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	htmltemplate "html/template"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+// Role is what a member may do in an organization. Each role includes the
+// ones below it.
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+	RoleOwner  Role = "owner"
+)
+
+var roleRank = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3, RoleOwner: 4}
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	return roleRank[r] > 0
+}
+
+// Can reports whether r includes the rights of min.
+func (r Role) Can(min Role) bool {
+	return r.Valid() && roleRank[r] >= roleRank[min]
+}
+
+const (
+	// InvitationTTL is how long an invitation link works.
+	InvitationTTL = 7 * 24 * time.Hour
+	// MaxPendingInvitations caps open invitations per organization.
+	MaxPendingInvitations = 50
+)
+
+var (
+	ErrNotMember           = errors.New("not a member of this organization")
+	ErrLastOwner           = errors.New("an organization needs at least one owner")
+	ErrInvitationEmail     = errors.New("the invitation was sent to a different email address")
+	ErrAlreadyMember       = errors.New("already a member of this organization")
+	ErrInvitationsExceeded = errors.New("too many pending invitations")
+
+	ErrOrganizationHasMonitors = errors.New("delete or move the organization's monitors first")
+)
+
+// Organization is an organization as seen by one of its members.
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Role      Role      `json:"role"`
+	Members   int       `json:"members"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Member struct {
+	UserID   int       `json:"user_id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Role     Role      `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type Invitation struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	Role      Role      `json:"role"`
+	InvitedBy string    `json:"invited_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MonitorAccess is the SQL condition for monitors a user can see: personal
+// monitors of the user and those of organizations the user belongs to. It
+// takes the user ID twice.
+const MonitorAccess = "((urls.organization_id IS NULL AND urls.user_id = ?) OR " +
+	"urls.organization_id IN (SELECT organization_id FROM organization_members WHERE user_id = ?))"
+
+// MonitorRole returns the role a user has on a monitor: owner of personal
+// monitors, the member role for organization monitors. It returns
+// sql.ErrNoRows when the user can't see the monitor.
+func MonitorRole(userID int, monitorID string) (Role, error) {
+	var (
+		personal bool
+		role     sql.NullString
+	)
+	err := db.DB.QueryRow(
+		"SELECT urls.organization_id IS NULL, m.role FROM urls "+
+			"LEFT JOIN organization_members m ON m.organization_id = urls.organization_id AND m.user_id = ? "+
+			"WHERE urls.id = ? AND "+MonitorAccess,
+		userID, monitorID, userID, userID,
+	).Scan(&personal, &role)
+	if err != nil {
+		return "", err
+	}
+	if personal {
+		return RoleOwner, nil
+	}
+	return Role(role.String), nil
+}
+
+// MemberRole returns the role of a user in an organization, or ErrNotMember.
+func MemberRole(orgID, userID int) (Role, error) {
+	var role string
+	err := db.DB.QueryRow(
+		"SELECT role FROM organization_members WHERE organization_id = ? AND user_id = ?", orgID, userID,
+	).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotMember
+	}
+	return Role(role), err
+}
+
+// CreateOrganization creates an organization owned by its creator.
+func CreateOrganization(userID int, name string) (Organization, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Organization{}, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO organizations (name, created_by) VALUES (?, ?)", name, userID)
+	if err != nil {
+		return Organization{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Organization{}, err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO organization_members (organization_id, user_id, role) VALUES (?, ?, ?)", id, userID, RoleOwner,
+	)
+	if err != nil {
+		return Organization{}, err
+	}
+	org := Organization{ID: int(id), Name: name, Role: RoleOwner, Members: 1, CreatedAt: time.Now().UTC()}
+	return org, tx.Commit()
+}
+
+const organizationColumns = `o.id, o.name, m.role, o.created_at,
+	(SELECT COUNT(*) FROM organization_members c WHERE c.organization_id = o.id)`
+
+func scanOrganization(row interface{ Scan(...any) error }) (Organization, error) {
+	var o Organization
+	err := row.Scan(&o.ID, &o.Name, &o.Role, &o.CreatedAt, &o.Members)
+	return o, err
+}
+
+// GetOrganization returns an organization as seen by one of its members, or
+// ErrNotMember.
+func GetOrganization(orgID, userID int) (Organization, error) {
+	org, err := scanOrganization(db.DB.QueryRow(
+		"SELECT "+organizationColumns+" FROM organizations o "+
+			"JOIN organization_members m ON m.organization_id = o.id AND m.user_id = ? WHERE o.id = ?",
+		userID, orgID,
+	))
+	if err == sql.ErrNoRows {
+		return Organization{}, ErrNotMember
+	}
+	return org, err
+}
+
+// ListOrganizations returns the organizations a user belongs to.
+func ListOrganizations(userID int) ([]Organization, error) {
+	rows, err := db.DB.Query(
+		"SELECT "+organizationColumns+" FROM organizations o "+
+			"JOIN organization_members m ON m.organization_id = o.id AND m.user_id = ? ORDER BY o.name, o.id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []Organization{}
+	for rows.Next() {
+		o, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+	return orgs, rows.Err()
+}
+
+// RenameOrganization changes the name of an organization.
+func RenameOrganization(orgID int, name string) error {
+	_, err := db.DB.Exec("UPDATE organizations SET name = ? WHERE id = ?", name, orgID)
+	return err
+}
+
+// DeleteOrganization deletes an organization with its members and
+// invitations. Organizations that still own monitors are refused with
+// ErrOrganizationHasMonitors, so no monitor is deleted by accident.
+func DeleteOrganization(orgID int) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var monitors int
+	err = tx.QueryRow("SELECT COUNT(*) FROM urls WHERE organization_id = ? FOR UPDATE", orgID).Scan(&monitors)
+	if err != nil {
+		return err
+	}
+	if monitors > 0 {
+		return ErrOrganizationHasMonitors
+	}
+	if _, err := tx.Exec("DELETE FROM organizations WHERE id = ?", orgID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListMembers returns the members of an organization, owners first.
+func ListMembers(orgID int) ([]Member, error) {
+	rows, err := db.DB.Query(`
+		SELECT u.id, u.name, u.email, m.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = ?
+		ORDER BY FIELD(m.role, 'owner', 'admin', 'editor', 'viewer'), u.name`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.UserID, &m.Name, &m.Email, &m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SetMemberRole changes the role of a member, keeping at least one owner.
+func SetMemberRole(orgID, userID int, role Role) error {
+	return changeMember(orgID, userID, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			"UPDATE organization_members SET role = ? WHERE organization_id = ? AND user_id = ?", role, orgID, userID,
+		)
+		return err
+	})
+}
+
+// RemoveMember takes a user out of an organization, keeping at least one
+// owner. The monitors the user created stay with the organization.
+func RemoveMember(orgID, userID int) error {
+	return changeMember(orgID, userID, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?", orgID, userID)
+		return err
+	})
+}
+
+// changeMember applies change to a member and refuses it when it leaves the
+// organization without an owner.
+func changeMember(orgID, userID int, change func(tx *sql.Tx) error) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the owners serializes concurrent demotions of the last two.
+	var owners int
+	err = tx.QueryRow(
+		"SELECT COUNT(*) FROM organization_members WHERE organization_id = ? AND role = 'owner' FOR UPDATE", orgID,
+	).Scan(&owners)
+	if err != nil {
+		return err
+	}
+	var role string
+	err = tx.QueryRow(
+		"SELECT role FROM organization_members WHERE organization_id = ? AND user_id = ? FOR UPDATE", orgID, userID,
+	).Scan(&role)
+	if err == sql.ErrNoRows {
+		return ErrNotMember
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := change(tx); err != nil {
+		return err
+	}
+	if Role(role) == RoleOwner && owners == 1 {
+		var still int
+		err := tx.QueryRow(
+			"SELECT COUNT(*) FROM organization_members WHERE organization_id = ? AND role = 'owner'", orgID,
+		).Scan(&still)
+		if err != nil {
+			return err
+		}
+		if still == 0 {
+			return ErrLastOwner
+		}
+	}
+	return tx.Commit()
+}
+
+type invitationMail struct {
+	Organization string
+	InvitedBy    string
+	Role         Role
+	Link         string
+	Expires      string
+}
+
+const invitationTextTemplate = `Hi,
+
+{{.InvitedBy}} invited you to join {{.Organization}} on Web Visitor as {{.Role}}. Accept the invitation here:
+
+{{.Link}}
+
+Log in or sign up with this email address first. The link works once, for {{.Expires}}. If you don't know the sender, ignore this email.
+
+-- Web Visitor
+`
+
+const invitationHTMLTemplate = `<!DOCTYPE html>
+<html><body style="font-family: sans-serif; color: #222;">
+<p>Hi,</p>
+<p>{{.InvitedBy}} invited you to join <strong>{{.Organization}}</strong> on Web Visitor as {{.Role}}.</p>
+<p><a href="{{.Link}}">Accept the invitation</a></p>
+<p>Log in or sign up with this email address first. The link works once, for {{.Expires}}. If you don't know the sender, ignore this email.</p>
+<p>&mdash; Web Visitor</p>
+</body></html>
+`
+
+var (
+	invitationText = template.Must(template.New("invitation").Parse(invitationTextTemplate))
+	invitationHTML = htmltemplate.Must(htmltemplate.New("invitation").Parse(invitationHTMLTemplate))
+)
+
+// invitationURL is the page the emailed link opens, from INVITATION_URL. It
+// gets the token as ?token= and posts it to the accept endpoint.
+func invitationURL() string {
+	if page := os.Getenv("INVITATION_URL"); page != "" {
+		return page
+	}
+	return AppURL() + "/invitations/accept"
+}
+
+// CreateInvitation stores an invitation to join an organization and emails
+// its link. A new invitation replaces a pending one for the same address.
+func CreateInvitation(orgID, invitedBy int, email string, role Role) (Invitation, error) {
+	var member bool
+	err := db.DB.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM organization_members m JOIN users u ON u.id = m.user_id "+
+			"WHERE m.organization_id = ? AND LOWER(u.email) = LOWER(?))",
+		orgID, email,
+	).Scan(&member)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if member {
+		return Invitation{}, ErrAlreadyMember
+	}
+
+	var pending int
+	err = db.DB.QueryRow(
+		"SELECT COUNT(*) FROM organization_invitations WHERE organization_id = ? AND accepted_at IS NULL "+
+			"AND expires_at > NOW() AND LOWER(email) <> LOWER(?)",
+		orgID, email,
+	).Scan(&pending)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if pending >= MaxPendingInvitations {
+		return Invitation{}, ErrInvitationsExceeded
+	}
+
+	var orgName, inviterName string
+	err = db.DB.QueryRow(
+		"SELECT o.name, u.name FROM organizations o, users u WHERE o.id = ? AND u.id = ?", orgID, invitedBy,
+	).Scan(&orgName, &inviterName)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	token, err := GenerateSessionToken()
+	if err != nil {
+		return Invitation{}, err
+	}
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Invitation{}, err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(
+		"DELETE FROM organization_invitations WHERE organization_id = ? AND LOWER(email) = LOWER(?) AND accepted_at IS NULL",
+		orgID, email,
+	)
+	if err != nil {
+		return Invitation{}, err
+	}
+	result, err := tx.Exec(
+		"INSERT INTO organization_invitations (organization_id, email, role, token_hash, invited_by, expires_at) "+
+			"VALUES (?, ?, ?, ?, ?, NOW() + INTERVAL ? SECOND)",
+		orgID, email, role, HashToken(token), invitedBy, int(InvitationTTL.Seconds()),
+	)
+	if err != nil {
+		return Invitation{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Invitation{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Invitation{}, err
+	}
+
+	now := time.Now().UTC()
+	invitation := Invitation{
+		ID:        int(id),
+		Email:     email,
+		Role:      role,
+		InvitedBy: inviterName,
+		ExpiresAt: now.Add(InvitationTTL),
+		CreatedAt: now,
+	}
+	if !MailConfigured() {
+		log.Printf("SMTP_HOST not set, skipping invitation email for organization %d", orgID)
+		return invitation, nil
+	}
+	data := invitationMail{
+		Organization: orgName,
+		InvitedBy:    inviterName,
+		Role:         role,
+		Link:         invitationURL() + "?token=" + url.QueryEscape(token),
+		Expires:      "7 days",
+	}
+	var text, html bytes.Buffer
+	if err := invitationText.Execute(&text, data); err != nil {
+		return invitation, err
+	}
+	if err := invitationHTML.Execute(&html, data); err != nil {
+		return invitation, err
+	}
+	return invitation, SendMail(Mail{
+		To:      email,
+		Subject: "Join " + orgName + " on Web Visitor",
+		Text:    text.String(),
+		HTML:    html.String(),
+	})
+}
+
+// ListInvitations returns the pending invitations of an organization.
+func ListInvitations(orgID int) ([]Invitation, error) {
+	rows, err := db.DB.Query(`
+		SELECT i.id, i.email, i.role, COALESCE(u.name, ''), i.expires_at, i.created_at
+		FROM organization_invitations i
+		LEFT JOIN users u ON u.id = i.invited_by
+		WHERE i.organization_id = ? AND i.accepted_at IS NULL AND i.expires_at > NOW()
+		ORDER BY i.created_at DESC, i.id DESC`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var i Invitation
+		if err := rows.Scan(&i.ID, &i.Email, &i.Role, &i.InvitedBy, &i.ExpiresAt, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, i)
+	}
+	return invitations, rows.Err()
+}
+
+// RevokeInvitation deletes a pending invitation. It reports false when the
+// organization has no such invitation.
+func RevokeInvitation(orgID int, invitationID string) (bool, error) {
+	result, err := db.DB.Exec(
+		"DELETE FROM organization_invitations WHERE id = ? AND organization_id = ? AND accepted_at IS NULL",
+		invitationID, orgID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// AcceptInvitation adds a user to the organization of an invitation sent to
+// the user's email address, and returns the organization ID.
+func AcceptInvitation(token string, userID int) (int, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var (
+		id, orgID     int
+		email, role   string
+		used, expired bool
+	)
+	err = tx.QueryRow(
+		"SELECT id, organization_id, email, role, accepted_at IS NOT NULL, expires_at <= NOW() "+
+			"FROM organization_invitations WHERE token_hash = ? FOR UPDATE",
+		HashToken(token),
+	).Scan(&id, &orgID, &email, &role, &used, &expired)
+	if err == sql.ErrNoRows || used {
+		return 0, ErrTokenInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+	if expired {
+		return 0, ErrTokenExpired
+	}
+
+	var userEmail string
+	if err := tx.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&userEmail); err != nil {
+		return 0, err
+	}
+	if !strings.EqualFold(userEmail, email) {
+		return 0, ErrInvitationEmail
+	}
+
+	result, err := tx.Exec(
+		"INSERT IGNORE INTO organization_members (organization_id, user_id, role) VALUES (?, ?, ?)", orgID, userID, role,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return 0, ErrAlreadyMember
+	}
+	if _, err := tx.Exec("UPDATE organization_invitations SET accepted_at = NOW() WHERE id = ?", id); err != nil {
+		return 0, err
+	}
+	return orgID, tx.Commit()
+}
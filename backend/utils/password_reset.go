@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"bytes"
+	"database/sql"
+	htmltemplate "html/template"
+	"log"
+	"net/url"
+	"os"
+	"text/template"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+const (
+	// PasswordResetTTL is how long a reset link works.
+	PasswordResetTTL = time.Hour
+	// PasswordResetCooldown is the least time between two reset emails.
+	PasswordResetCooldown = 2 * time.Minute
+	// MaxPasswordResetsPerDay caps reset emails per user.
+	MaxPasswordResetsPerDay = 5
+)
+
+type passwordResetMail struct {
+	Name    string
+	Link    string
+	Expires string
+}
+
+const passwordResetTextTemplate = `Hi {{.Name}},
+
+Someone asked to reset the password of your Web Visitor account. Choose a new one here:
+
+{{.Link}}
+
+The link works once, for {{.Expires}}. If it wasn't you, ignore this email; your password stays the same.
+
+-- Web Visitor
+`
+
+const passwordResetHTMLTemplate = `<!DOCTYPE html>
+<html><body style="font-family: sans-serif; color: #222;">
+<p>Hi {{.Name}},</p>
+<p>Someone asked to reset the password of your Web Visitor account.</p>
+<p><a href="{{.Link}}">Choose a new password</a></p>
+<p>The link works once, for {{.Expires}}. If it wasn't you, ignore this email; your password stays the same.</p>
+<p>&mdash; Web Visitor</p>
+</body></html>
+`
+
+var (
+	passwordResetText = template.Must(template.New("password-reset").Parse(passwordResetTextTemplate))
+	passwordResetHTML = htmltemplate.Must(htmltemplate.New("password-reset").Parse(passwordResetHTMLTemplate))
+)
+
+// passwordResetURL is the page the emailed link opens, from
+// PASSWORD_RESET_URL. It gets the token as ?token= and posts it back with
+// the new password.
+func passwordResetURL() string {
+	if page := os.Getenv("PASSWORD_RESET_URL"); page != "" {
+		return page
+	}
+	return AppURL() + "/reset-password"
+}
+
+// SendPasswordReset emails a reset link to the account of an email address.
+// Unknown addresses and throttled accounts are skipped silently, so callers
+// can't tell them apart.
+func SendPasswordReset(email string) error {
+	var (
+		userID int
+		name   string
+	)
+	err := db.DB.QueryRow("SELECT id, name FROM users WHERE email = ?", email).Scan(&userID, &name)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var sentToday, sentRecently int
+	err = db.DB.QueryRow(
+		"SELECT COUNT(*), COALESCE(SUM(created_at > NOW() - INTERVAL ? SECOND), 0) FROM password_resets "+
+			"WHERE user_id = ? AND created_at > NOW() - INTERVAL 1 DAY",
+		int(PasswordResetCooldown.Seconds()), userID,
+	).Scan(&sentToday, &sentRecently)
+	if err != nil {
+		return err
+	}
+	if sentRecently > 0 || sentToday >= MaxPasswordResetsPerDay {
+		log.Printf("Skipped password reset email to user %d: throttled", userID)
+		return nil
+	}
+
+	token, err := GenerateSessionToken()
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.Exec(
+		"INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES (?, ?, NOW() + INTERVAL ? SECOND)",
+		userID, HashToken(token), int(PasswordResetTTL.Seconds()),
+	)
+	if err != nil {
+		return err
+	}
+
+	if !MailConfigured() {
+		log.Printf("SMTP_HOST not set, skipping password reset email for user %d", userID)
+		return nil
+	}
+	data := passwordResetMail{
+		Name:    name,
+		Link:    passwordResetURL() + "?token=" + url.QueryEscape(token),
+		Expires: "1 hour",
+	}
+	var text, html bytes.Buffer
+	if err := passwordResetText.Execute(&text, data); err != nil {
+		return err
+	}
+	if err := passwordResetHTML.Execute(&html, data); err != nil {
+		return err
+	}
+	if err := SendMail(Mail{
+		To:      email,
+		Subject: "Reset your Web Visitor password",
+		Text:    text.String(),
+		HTML:    html.String(),
+	}); err != nil {
+		return err
+	}
+	log.Printf("Sent password reset email to user %d", userID)
+	return nil
+}
+
+// ResetPassword sets a new bcrypt hash for the owner of a reset token, uses
+// up every outstanding reset token and signs out all sessions of the user.
+// Receiving the link proves the email address, so it verifies it too.
+func ResetPassword(token, passwordHash string) (int, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var (
+		userID        int
+		used, expired bool
+	)
+	err = tx.QueryRow(
+		"SELECT user_id, used_at IS NOT NULL, expires_at <= NOW() FROM password_resets WHERE token_hash = ? FOR UPDATE",
+		HashToken(token),
+	).Scan(&userID, &used, &expired)
+	if err == sql.ErrNoRows || used {
+		return 0, ErrTokenInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+	if expired {
+		return 0, ErrTokenExpired
+	}
+
+	_, err = tx.Exec(
+		"UPDATE users SET password = ?, verified = TRUE, verified_at = COALESCE(verified_at, NOW()) WHERE id = ?",
+		passwordHash, userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE password_resets SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL", userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE auth_tokens SET is_active = FALSE WHERE user_id = ? AND is_active = TRUE", userID); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
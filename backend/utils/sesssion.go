@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"log"
 	"time"
+	"unicode/utf8"
 
 	db "github.com/MrPurushotam/web-visitor/config"
 )
@@ -18,44 +19,146 @@ func GenerateSessionToken() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-func CreateSession(userId int) (string, error) {
+const (
+	// SessionIdleTimeout ends a session that isn't used for this long. Every
+	// request moves the expiry forward again.
+	SessionIdleTimeout = time.Hour
+	// SessionMaxAge ends a session however active it is.
+	SessionMaxAge = 30 * 24 * time.Hour
+	// sessionSweepBatch bounds each DELETE of the sweeper.
+	sessionSweepBatch = 5000
+)
+
+// Session is a login as shown to its user; the token itself is never listed.
+type Session struct {
+	ID         int        `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Current    bool       `json:"current"`
+}
+
+// CreateSession opens a session and records the device it was opened from.
+func CreateSession(userId int, userAgent, ipAddress string) (string, error) {
 	token, err := GenerateSessionToken()
 	if err != nil {
 		return "", err
 	}
-	expiresAt := time.Now().Add(1 * time.Hour)
-	query := "INSERT INTO auth_tokens(user_id,token,expires_at) VALUES (?,?,?)"
+	query := "INSERT INTO auth_tokens(user_id,token,expires_at,last_used_at,user_agent,ip_address) VALUES (?,?,NOW() + INTERVAL ? SECOND,NOW(),?,?)"
 
-	_, err = db.DB.Exec(query, userId, token, expiresAt)
+	_, err = db.DB.Exec(query, userId, token, int(SessionIdleTimeout.Seconds()), truncate(userAgent, 255), truncate(ipAddress, 45))
 	if err != nil {
 		return "", err
 	}
 	return token, nil
 }
 
-func ValidateSession(token string) (int, error) {
-	var userID int
-	var expiresAt sql.NullTime
+// ValidateSession returns the user and session ID of a token and slides its
+// expiry forward, up to SessionMaxAge after login.
+func ValidateSession(token string) (userID, sessionID int, err error) {
+	query := `SELECT id, user_id FROM auth_tokens WHERE token=? AND is_active=TRUE AND expires_at >= NOW()`
 
-	query := `SELECT user_id, expires_at FROM auth_tokens WHERE token=? AND is_active=TRUE AND expires_at >= NOW()`
-
-	err := db.DB.QueryRow(query, token).Scan(&userID, &expiresAt)
+	err = db.DB.QueryRow(query, token).Scan(&sessionID, &userID)
 	if err != nil {
-		log.Printf("%s%v", token, err)
-		return 0, err
+		return 0, 0, err
 	}
 
-	updateQuery := `UPDATE auth_tokens SET last_used_at = NOW() WHERE token=?`
-	_, updateErr := db.DB.Exec(updateQuery, token)
+	updateQuery := `UPDATE auth_tokens SET last_used_at = NOW(),
+		expires_at = LEAST(NOW() + INTERVAL ? SECOND, created_at + INTERVAL ? SECOND) WHERE id=?`
+	_, updateErr := db.DB.Exec(updateQuery, int(SessionIdleTimeout.Seconds()), int(SessionMaxAge.Seconds()), sessionID)
 	if updateErr != nil {
-		log.Printf("Failed to update last_used_at: %v", updateErr)
+		log.Printf("Failed to refresh session: %v", updateErr)
+	}
+
+	return userID, sessionID, nil
+}
+
+// ListSessions returns the active sessions of a user, most recently used
+// first. currentID marks the session making the request.
+func ListSessions(userID, currentID int) ([]Session, error) {
+	rows, err := db.DB.Query(
+		"SELECT id, COALESCE(user_agent, ''), COALESCE(ip_address, ''), created_at, last_used_at, expires_at "+
+			"FROM auth_tokens WHERE user_id = ? AND is_active = TRUE AND expires_at >= NOW() "+
+			"ORDER BY COALESCE(last_used_at, created_at) DESC, id DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var (
+			s        Session
+			lastUsed sql.NullTime
+		)
+		if err := rows.Scan(&s.ID, &s.UserAgent, &s.IPAddress, &s.CreatedAt, &lastUsed, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			s.LastUsedAt = &lastUsed.Time
+		}
+		s.Current = s.ID == currentID
+		sessions = append(sessions, s)
 	}
+	return sessions, rows.Err()
+}
 
-	return userID, nil
+// RevokeSession ends one session of a user. It reports false when the user
+// has no such active session.
+func RevokeSession(userID, sessionID int) (bool, error) {
+	result, err := db.DB.Exec(
+		"UPDATE auth_tokens SET is_active = FALSE WHERE id = ? AND user_id = ? AND is_active = TRUE", sessionID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
 }
 
-func InvalidateSession(token string) error {
-	query := `UPDATE auth_tokens SET is_active=FALSE WHERE token=?`
-	_, err := db.DB.Exec(query, token)
-	return err
+// RevokeAllSessions ends every session of a user except keepID, which may be
+// 0 to end them all, and returns how many were ended.
+func RevokeAllSessions(userID, keepID int) (int64, error) {
+	result, err := db.DB.Exec(
+		"UPDATE auth_tokens SET is_active = FALSE WHERE user_id = ? AND id <> ? AND is_active = TRUE", userID, keepID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SweepSessions deletes sessions that expired or were logged out, in batches
+// so a large backlog doesn't lock the table for long.
+func SweepSessions() {
+	total := int64(0)
+	for {
+		result, err := db.DB.Exec(
+			"DELETE FROM auth_tokens WHERE is_active = FALSE OR expires_at < NOW() LIMIT ?", sessionSweepBatch,
+		)
+		if err != nil {
+			log.Printf("Error sweeping sessions: %v", err)
+			return
+		}
+		n, _ := result.RowsAffected()
+		total += n
+		if n < sessionSweepBatch {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("Deleted %d expired or logged out sessions", total)
+	}
+}
+
+func truncate(s string, max int) string {
+	for len(s) > max {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return s
 }
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// HashToken signs a token emailed to a user with TOKEN_SECRET. Only the
+// signature is stored, so the database alone can't produce a working link.
+func HashToken(token string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("TOKEN_SECRET")))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AppURL is the public address links in emails point to, from APP_URL.
+func AppURL() string {
+	if url := strings.TrimRight(os.Getenv("APP_URL"), "/"); url != "" {
+		return url
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return "http://localhost:" + port
+}
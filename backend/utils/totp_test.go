@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors,
+// "12345678901234567890", in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B, SHA-1, truncated to our 6 digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestMatchTOTPVectors(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		at := time.Unix(v.unix, 0)
+		step, ok := MatchTOTP(rfc6238Secret, v.code, at)
+		if !ok {
+			t.Errorf("MatchTOTP(%s at %d) didn't match", v.code, v.unix)
+			continue
+		}
+		if want := v.unix / 30; step != want {
+			t.Errorf("MatchTOTP(%s at %d) matched step %d, want %d", v.code, v.unix, step, want)
+		}
+	}
+}
+
+func TestMatchTOTPSkew(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	for _, offset := range []time.Duration{-30 * time.Second, 30 * time.Second} {
+		if _, ok := MatchTOTP(rfc6238Secret, "050471", at.Add(offset)); !ok {
+			t.Errorf("code wasn't accepted %s away", offset)
+		}
+	}
+	for _, offset := range []time.Duration{-90 * time.Second, 90 * time.Second} {
+		if _, ok := MatchTOTP(rfc6238Secret, "050471", at.Add(offset)); ok {
+			t.Errorf("code was accepted %s away", offset)
+		}
+	}
+}
+
+func TestMatchTOTPInput(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	accepted := []string{"005924", " 005 924 ", "005924\n"}
+	for _, code := range accepted {
+		if _, ok := MatchTOTP(rfc6238Secret, code, at); !ok {
+			t.Errorf("MatchTOTP(%q) didn't match", code)
+		}
+	}
+	if _, ok := MatchTOTP(strings.ToLower(rfc6238Secret), "005924", at); !ok {
+		t.Error("lower case secret didn't match")
+	}
+
+	rejected := []string{"", "5924", "0059245", "005925", "abcdef"}
+	for _, code := range rejected {
+		if _, ok := MatchTOTP(rfc6238Secret, code, at); ok {
+			t.Errorf("MatchTOTP(%q) matched", code)
+		}
+	}
+	if _, ok := MatchTOTP("not base32!", "005924", at); ok {
+		t.Error("invalid secret matched")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes (%v), want 20", secret, len(key), err)
+	}
+
+	now := time.Now()
+	code := totpCode(key, now.Unix()/30)
+	if _, ok := MatchTOTP(secret, code, now); !ok {
+		t.Error("code of a generated secret didn't match")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI(rfc6238Secret, "jane@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Web Visitor:jane@example.com" {
+		t.Errorf("uri = %s", uri)
+	}
+	query := uri.Query()
+	if query.Get("secret") != rfc6238Secret || query.Get("issuer") != TOTPIssuer ||
+		query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("query = %v", query)
+	}
+}
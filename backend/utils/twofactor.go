@@ -0,0 +1,287 @@
+package utils
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+const (
+	// LoginChallengeTTL is how long the second login step can take.
+	LoginChallengeTTL = 5 * time.Minute
+	// MaxChallengeAttempts is how many wrong codes end a login challenge.
+	MaxChallengeAttempts = 5
+	// RecoveryCodeCount is how many recovery codes enrollment hands out.
+	RecoveryCodeCount = 10
+)
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotStarted = errors.New("start two-factor setup first")
+	ErrTwoFactorDisabled   = errors.New("two-factor authentication is not enabled")
+	ErrInvalidCode         = errors.New("the code is invalid")
+)
+
+// TwoFactorEnabled reports whether a user has confirmed TOTP enrollment.
+func TwoFactorEnabled(userID int) (bool, error) {
+	var enabled bool
+	err := db.DB.QueryRow("SELECT totp_enabled FROM users WHERE id = ?", userID).Scan(&enabled)
+	return enabled, err
+}
+
+// BeginTOTPEnrollment stores a new, not yet active secret for a user and
+// returns it with its provisioning URI. Starting over replaces the secret.
+func BeginTOTPEnrollment(userID int) (secret, uri string, err error) {
+	var (
+		email   string
+		enabled bool
+	)
+	err = db.DB.QueryRow("SELECT email, totp_enabled FROM users WHERE id = ?", userID).Scan(&email, &enabled)
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", ErrTwoFactorEnabled
+	}
+	if secret, err = GenerateTOTPSecret(); err != nil {
+		return "", "", err
+	}
+	if _, err = db.DB.Exec("UPDATE users SET totp_secret = ?, totp_last_step = NULL WHERE id = ?", secret, userID); err != nil {
+		return "", "", err
+	}
+	return secret, TOTPProvisioningURI(secret, email), nil
+}
+
+// ConfirmTOTPEnrollment turns two-factor on once the user proves the app
+// produces valid codes, and returns fresh recovery codes.
+func ConfirmTOTPEnrollment(userID int, code string) ([]string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		secret  sql.NullString
+		enabled bool
+	)
+	err = tx.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE id = ? FOR UPDATE", userID).Scan(&secret, &enabled)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if !secret.Valid {
+		return nil, ErrTwoFactorNotStarted
+	}
+	step, ok := MatchTOTP(secret.String, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+	if _, err := tx.Exec("UPDATE users SET totp_enabled = TRUE, totp_last_step = ? WHERE id = ?", step, userID); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// DisableTwoFactor turns two-factor off after checking a current code or a
+// recovery code, and drops the secret and recovery codes.
+func DisableTwoFactor(userID int, code string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkSecondFactor(tx, userID, code); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = NULL WHERE id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of a user after
+// checking a second factor.
+func RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkSecondFactor(tx, userID, code); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// CreateLoginChallenge is issued after a correct password when two-factor
+// is on. Only its token can finish the login.
+func CreateLoginChallenge(userID int) (string, error) {
+	token, err := GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.DB.Exec(
+		"INSERT INTO login_challenges (user_id, token_hash, expires_at) VALUES (?, ?, NOW() + INTERVAL ? SECOND)",
+		userID, HashToken(token), int(LoginChallengeTTL.Seconds()),
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CompleteLoginChallenge exchanges a challenge token and a TOTP or recovery
+// code for the user ID to open a session for. The challenge is used up on
+// success and after MaxChallengeAttempts wrong codes.
+func CompleteLoginChallenge(token, code string) (int, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var (
+		id, userID, attempts int
+		expired              bool
+	)
+	err = tx.QueryRow(
+		"SELECT id, user_id, attempts, expires_at <= NOW() FROM login_challenges WHERE token_hash = ? FOR UPDATE",
+		HashToken(token),
+	).Scan(&id, &userID, &attempts, &expired)
+	if err == sql.ErrNoRows || (err == nil && attempts >= MaxChallengeAttempts) {
+		return 0, ErrTokenInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+	if expired {
+		return 0, ErrTokenExpired
+	}
+
+	err = checkSecondFactor(tx, userID, code)
+	if errors.Is(err, ErrInvalidCode) {
+		// Count the miss even though the login fails.
+		if _, err := tx.Exec("UPDATE login_challenges SET attempts = attempts + 1 WHERE id = ?", id); err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+		return 0, ErrInvalidCode
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM login_challenges WHERE id = ? OR expires_at <= NOW()", id); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// checkSecondFactor accepts a TOTP code newer than the last one used, or an
+// unused recovery code, which it uses up.
+func checkSecondFactor(tx *sql.Tx, userID int, code string) error {
+	var (
+		secret   sql.NullString
+		enabled  bool
+		lastStep sql.NullInt64
+	)
+	err := tx.QueryRow(
+		"SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = ? FOR UPDATE", userID,
+	).Scan(&secret, &enabled, &lastStep)
+	if err != nil {
+		return err
+	}
+	if !enabled || !secret.Valid {
+		return ErrTwoFactorDisabled
+	}
+
+	if step, ok := MatchTOTP(secret.String, code, time.Now()); ok {
+		if lastStep.Valid && step <= lastStep.Int64 {
+			return ErrInvalidCode
+		}
+		_, err := tx.Exec("UPDATE users SET totp_last_step = ? WHERE id = ?", step, userID)
+		return err
+	}
+
+	result, err := tx.Exec(
+		"UPDATE recovery_codes SET used_at = NOW() WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		userID, HashToken(normalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// recoveryAlphabet leaves out look-alike characters.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		raw, err := randomString(10, recoveryAlphabet)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = raw[:5] + "-" + raw[5:]
+		_, err = tx.Exec(
+			"INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)",
+			userID, HashToken(normalizeRecoveryCode(codes[i])),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// randomString draws n characters uniformly from alphabet, skipping bytes
+// that would favor its first characters.
+func randomString(n int, alphabet string) (string, error) {
+	limit := 256 - 256%len(alphabet)
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(out) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(out) < n {
+				out = append(out, alphabet[int(b)%len(alphabet)])
+			}
+		}
+	}
+	return string(out), nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes when comparing.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	htmltemplate "html/template"
+	"log"
+	"net/url"
+	"text/template"
+	"time"
+
+	db "github.com/MrPurushotam/web-visitor/config"
+)
+
+const (
+	// VerificationTTL is how long a verification link works.
+	VerificationTTL = 24 * time.Hour
+	// VerificationCooldown is the least time between two verification emails.
+	VerificationCooldown = 2 * time.Minute
+	// MaxVerificationsPerDay caps verification emails per user.
+	MaxVerificationsPerDay = 5
+	// UnverifiedMonitorLimit is how many monitors an unverified account can add.
+	UnverifiedMonitorLimit = 2
+)
+
+var (
+	ErrTokenInvalid          = errors.New("the link is invalid or was already used")
+	ErrTokenExpired          = errors.New("the link has expired")
+	ErrAlreadyVerified       = errors.New("the email address is already verified")
+	ErrVerificationThrottled = errors.New("a verification email was sent recently")
+)
+
+type verificationMail struct {
+	Name    string
+	Link    string
+	Expires string
+}
+
+const verificationTextTemplate = `Hi {{.Name}},
+
+Confirm your email address to finish setting up your Web Visitor account:
+
+{{.Link}}
+
+The link works for {{.Expires}}. If you didn't sign up, ignore this email.
+
+-- Web Visitor
+`
+
+const verificationHTMLTemplate = `<!DOCTYPE html>
+<html><body style="font-family: sans-serif; color: #222;">
+<p>Hi {{.Name}},</p>
+<p>Confirm your email address to finish setting up your Web Visitor account:</p>
+<p><a href="{{.Link}}">Verify my email</a></p>
+<p>The link works for {{.Expires}}. If you didn't sign up, ignore this email.</p>
+<p>&mdash; Web Visitor</p>
+</body></html>
+`
+
+var (
+	verificationText = template.Must(template.New("verification").Parse(verificationTextTemplate))
+	verificationHTML = htmltemplate.Must(htmltemplate.New("verification").Parse(verificationHTMLTemplate))
+)
+
+// SendVerification issues a new verification token for a user and emails
+// the link. Earlier links keep working until they expire.
+func SendVerification(userID int) error {
+	var (
+		email, name string
+		verified    sql.NullBool
+	)
+	err := db.DB.QueryRow("SELECT email, name, verified FROM users WHERE id = ?", userID).Scan(&email, &name, &verified)
+	if err != nil {
+		return err
+	}
+	if verified.Bool {
+		return ErrAlreadyVerified
+	}
+
+	var sentToday, sentRecently int
+	err = db.DB.QueryRow(
+		"SELECT COUNT(*), COALESCE(SUM(created_at > NOW() - INTERVAL ? SECOND), 0) FROM email_verifications "+
+			"WHERE user_id = ? AND created_at > NOW() - INTERVAL 1 DAY",
+		int(VerificationCooldown.Seconds()), userID,
+	).Scan(&sentToday, &sentRecently)
+	if err != nil {
+		return err
+	}
+	if sentRecently > 0 || sentToday >= MaxVerificationsPerDay {
+		return ErrVerificationThrottled
+	}
+
+	token, err := GenerateSessionToken()
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.Exec(
+		"INSERT INTO email_verifications (user_id, token_hash, expires_at) VALUES (?, ?, NOW() + INTERVAL ? SECOND)",
+		userID, HashToken(token), int(VerificationTTL.Seconds()),
+	)
+	if err != nil {
+		return err
+	}
+
+	if !MailConfigured() {
+		log.Printf("SMTP_HOST not set, skipping verification email for user %d", userID)
+		return nil
+	}
+	data := verificationMail{
+		Name:    name,
+		Link:    AppURL() + "/api/v1/user/verify/?token=" + url.QueryEscape(token),
+		Expires: "24 hours",
+	}
+	var text, html bytes.Buffer
+	if err := verificationText.Execute(&text, data); err != nil {
+		return err
+	}
+	if err := verificationHTML.Execute(&html, data); err != nil {
+		return err
+	}
+	return SendMail(Mail{
+		To:      email,
+		Subject: "Verify your Web Visitor email address",
+		Text:    text.String(),
+		HTML:    html.String(),
+	})
+}
+
+// VerifyEmail marks the owner of a verification token as verified and
+// invalidates every outstanding token of that user.
+func VerifyEmail(token string) (int, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var (
+		userID        int
+		used, expired bool
+	)
+	err = tx.QueryRow(
+		"SELECT user_id, used_at IS NOT NULL, expires_at <= NOW() FROM email_verifications WHERE token_hash = ? FOR UPDATE",
+		HashToken(token),
+	).Scan(&userID, &used, &expired)
+	if err == sql.ErrNoRows || used {
+		return 0, ErrTokenInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+	if expired {
+		return 0, ErrTokenExpired
+	}
+
+	if _, err := tx.Exec("UPDATE users SET verified = TRUE, verified_at = NOW() WHERE id = ?", userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE email_verifications SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL", userID); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// IsVerified reports whether a user confirmed their email address.
+func IsVerified(userID int) (bool, error) {
+	var verified sql.NullBool
+	err := db.DB.QueryRow("SELECT verified FROM users WHERE id = ?", userID).Scan(&verified)
+	return verified.Bool, err
+}